@@ -0,0 +1,312 @@
+package sqlog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregation functions
+const (
+	AggCount = "count"
+	AggSum   = "sum"
+	AggAvg   = "avg"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggP50   = "p50"
+	AggP95   = "p95"
+	AggP99   = "p99"
+)
+
+const aggregateMaxGroupBy = 3
+
+// AggregateMaxSamples is the maximum size of the random sample of values used to compute the percentiles of each row
+const AggregateMaxSamples = 10000
+
+var (
+	aggregateFuncs = map[string]float64{
+		AggCount: 0, AggSum: 0, AggAvg: 0, AggMin: 0, AggMax: 0,
+		AggP50: 0.50, AggP95: 0.95, AggP99: 0.99,
+	}
+	aggregationRegex = regexp.MustCompile(`^\s*(\w+)\s*\(\s*([^()\s]*)\s*\)\s*$`)
+	aggregateField   = regexp.MustCompile(`^[\w.\-\[\]]+$`)
+)
+
+// Aggregation is an aggregation function over a numeric field. Ex. Aggregation{Func: "p95", Field: "duration"}
+type Aggregation struct {
+	Func  string `json:"fn"`
+	Field string `json:"field,omitempty"` // Not required for count
+}
+
+// String returns the aggregation as "fn(field)"
+func (a Aggregation) String() string {
+	return a.Func + "(" + a.Field + ")"
+}
+
+// IsPercentile checks if the function is p50, p95 or p99
+func (a Aggregation) IsPercentile() bool {
+	return aggregateFuncs[a.Func] > 0
+}
+
+// ParseAggregation parses an aggregation in the format "fn(field)". Ex. "count()", "avg(duration)"
+func ParseAggregation(s string) (Aggregation, error) {
+	m := aggregationRegex.FindStringSubmatch(s)
+	if m == nil {
+		return Aggregation{}, fmt.Errorf("[sqlog] invalid aggregation %q", s)
+	}
+	a := Aggregation{Func: strings.ToLower(m[1]), Field: m[2]}
+	return a, a.validate()
+}
+
+func (a Aggregation) validate() error {
+	if _, exists := aggregateFuncs[a.Func]; !exists {
+		return fmt.Errorf("[sqlog] invalid aggregation function %q", a.Func)
+	}
+	if a.Field == "" && a.Func != AggCount {
+		return fmt.Errorf("[sqlog] field is required for %s()", a.Func)
+	}
+	if a.Field != "" && !aggregateField.MatchString(a.Field) {
+		return fmt.Errorf("[sqlog] invalid field %q", a.Field)
+	}
+	return nil
+}
+
+type AggregateInput struct {
+	Expr         string        `json:"expr"`
+	Level        []string      `json:"level"`        // ["debug","info","warn","error"]
+	EpochStart   int64         `json:"epoch_start"`  // (Default: EpochEnd - 1 hour)
+	EpochEnd     int64         `json:"epoch"`        // (Default: now)
+	IntervalSec  int           `json:"interval"`     // Size of the time buckets (Default: 0, a single bucket)
+	Aggregations []Aggregation `json:"aggregations"` // (Default: count())
+	GroupBy      []string      `json:"by"`           // Up to 3 fields
+	MaxResult    int           `json:"limit"`        // (Default: 1000)
+	Top          int           `json:"top"`          // Only the rows with more entries of each database (Default: 0, all)
+	Source       string        `json:"source"`       // Label of the attached source, empty for the live storage
+	Streams      []string      `json:"streams"`      // Names of the streams (Default: all)
+}
+
+// Validate checks the input and sets the default values
+func (i *AggregateInput) Validate() error {
+	if i.EpochEnd <= 0 {
+		i.EpochEnd = time.Now().Unix()
+	}
+	if i.EpochStart <= 0 || i.EpochStart >= i.EpochEnd {
+		i.EpochStart = i.EpochEnd - 3600
+	}
+	if i.IntervalSec < 0 {
+		i.IntervalSec = 0
+	}
+	if i.MaxResult <= 0 {
+		i.MaxResult = 1000
+	}
+	if i.Top < 0 {
+		i.Top = 0
+	}
+	if len(i.Aggregations) == 0 {
+		i.Aggregations = []Aggregation{{Func: AggCount}}
+	}
+	for _, a := range i.Aggregations {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	if len(i.GroupBy) > aggregateMaxGroupBy {
+		return fmt.Errorf("[sqlog] group by supports up to %d fields", aggregateMaxGroupBy)
+	}
+	for _, field := range i.GroupBy {
+		if !aggregateField.MatchString(field) {
+			return fmt.Errorf("[sqlog] invalid field %q", field)
+		}
+	}
+	return nil
+}
+
+// AggregateRow is a row of the aggregation result, for a time bucket and the group by values
+type AggregateRow struct {
+	Start    int64               `json:"epoch_start"`
+	End      int64               `json:"epoch_end"`
+	Groups   []any               `json:"groups,omitempty"` // Values of AggregateInput.GroupBy
+	Values   []any               `json:"values"`           // Result of each AggregateInput.Aggregations (nil when there is no value)
+	Partials []*AggregatePartial `json:"-"`                // Partial state, used to merge results from multiple databases
+}
+
+// AggregatePartial is the partial state of an aggregation
+type AggregatePartial struct {
+	Count   int64     // Number of values (or rows, for count())
+	Sum     float64   //
+	Min     float64   //
+	Max     float64   //
+	Samples []float64 // Random sample of the values (up to AggregateMaxSamples), only for percentiles
+}
+
+func (p *AggregatePartial) merge(o *AggregatePartial) {
+	if o.Count == 0 {
+		return
+	}
+	if p.Count == 0 {
+		p.Min, p.Max = o.Min, o.Max
+	} else {
+		p.Min, p.Max = min(p.Min, o.Min), max(p.Max, o.Max)
+	}
+	p.Samples = mergeSamples(p.Samples, p.Count, o.Samples, o.Count)
+	p.Count += o.Count
+	p.Sum += o.Sum
+}
+
+// mergeSamples merges the samples of two sets of values, keeping up to AggregateMaxSamples values in proportion
+// to the number of values of each set
+func mergeSamples(a []float64, countA int64, b []float64, countB int64) []float64 {
+	if len(a)+len(b) <= AggregateMaxSamples {
+		return append(a, b...)
+	}
+	na := int(float64(AggregateMaxSamples) * float64(countA) / float64(countA+countB))
+	na = min(max(na, AggregateMaxSamples-len(b)), len(a))
+	nb := min(AggregateMaxSamples-na, len(b))
+
+	merged := make([]float64, 0, na+nb)
+	merged = append(merged, randomSample(a, na)...)
+	return append(merged, randomSample(b, nb)...)
+}
+
+// randomSample returns n values chosen at random
+func randomSample(values []float64, n int) []float64 {
+	if n >= len(values) {
+		return values
+	}
+	sample := slices.Clone(values)
+	for i := 0; i < n; i++ {
+		j := i + rand.IntN(len(sample)-i)
+		sample[i], sample[j] = sample[j], sample[i]
+	}
+	return sample[:n]
+}
+
+func (p *AggregatePartial) value(a Aggregation) any {
+	if a.Func == AggCount {
+		return p.Count
+	}
+	if p.Count == 0 {
+		return nil
+	}
+	switch a.Func {
+	case AggSum:
+		return p.Sum
+	case AggAvg:
+		return p.Sum / float64(p.Count)
+	case AggMin:
+		return p.Min
+	case AggMax:
+		return p.Max
+	default:
+		return percentile(p.Samples, aggregateFuncs[a.Func])
+	}
+}
+
+// percentile computes the percentile using linear interpolation between the closest ranks
+func percentile(samples []float64, p float64) any {
+	if len(samples) == 0 {
+		return nil
+	}
+	if !sort.Float64sAreSorted(samples) {
+		sort.Float64s(samples)
+	}
+	rank := p * float64(len(samples)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return samples[lower] + (samples[upper]-samples[lower])*(rank-float64(lower))
+}
+
+func aggregateRowKey(row *AggregateRow) string {
+	return fmt.Sprintf("%d|%v", row.Start, row.Groups)
+}
+
+// MergeAggregateRows merges the partial rows (same time bucket and groups) of src into dst
+func MergeAggregateRows(dst []*AggregateRow, src []*AggregateRow) []*AggregateRow {
+	index := make(map[string]*AggregateRow, len(dst))
+	for _, row := range dst {
+		index[aggregateRowKey(row)] = row
+	}
+	for _, row := range src {
+		key := aggregateRowKey(row)
+		if o, exists := index[key]; exists {
+			for i, p := range row.Partials {
+				o.Partials[i].merge(p)
+			}
+		} else {
+			index[key] = row
+			dst = append(dst, row)
+		}
+	}
+	return dst
+}
+
+// FinalizeAggregateRows computes the values of the rows, sorted by time and group values, limited by MaxResult
+func FinalizeAggregateRows(input *AggregateInput, rows []*AggregateRow) []*AggregateRow {
+	for _, row := range rows {
+		row.Values = make([]any, len(input.Aggregations))
+		for i, a := range input.Aggregations {
+			if i < len(row.Partials) {
+				row.Values[i] = row.Partials[i].value(a)
+			}
+		}
+	}
+
+	slices.SortStableFunc(rows, func(a, b *AggregateRow) int {
+		if a.Start != b.Start {
+			return cmp.Compare(a.Start, b.Start)
+		}
+		return strings.Compare(fmt.Sprint(a.Groups...), fmt.Sprint(b.Groups...))
+	})
+
+	if len(rows) > input.MaxResult {
+		rows = rows[:input.MaxResult]
+	}
+	return rows
+}
+
+// waitScheduled waits for the scheduled results of the storage, calling fn for each completed result.
+// A missing result is an error, the output would be incomplete.
+func waitScheduled(ctx context.Context, storage StorageWithApi, taskIds []int32, fn func(*Output) error) error {
+	pending := taskIds
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			for _, id := range pending {
+				storage.Cancel(id)
+			}
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		var next []int32
+		for _, id := range pending {
+			result, err := storage.Result(id)
+			if err != nil {
+				return err
+			}
+			if result == nil {
+				// evicted by the storage (result TTL) or lost, the output would be incomplete
+				return fmt.Errorf("[sqlog] result of the task %d is not available", id)
+			}
+			if result.Scheduled {
+				next = append(next, id)
+				continue
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if err = fn(result); err != nil {
+				return err
+			}
+		}
+		pending = next
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package sqlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Aggregate_Parse(t *testing.T) {
+	a, err := ParseAggregation(" P95( duration ) ")
+	assert.Nil(t, err)
+	assert.Equal(t, Aggregation{Func: AggP95, Field: "duration"}, a)
+	assert.True(t, a.IsPercentile())
+	assert.Equal(t, "p95(duration)", a.String())
+
+	a, err = ParseAggregation("count()")
+	assert.Nil(t, err)
+	assert.Equal(t, Aggregation{Func: AggCount}, a)
+
+	for _, invalid := range []string{"avg()", "median(duration)", "count", "sum(a b)", "max(a'--)"} {
+		_, err = ParseAggregation(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+
+	input := &AggregateInput{GroupBy: []string{"a", "b", "c", "d"}}
+	assert.NotNil(t, input.Validate())
+
+	input = &AggregateInput{EpochEnd: 7200}
+	assert.Nil(t, input.Validate())
+	assert.Equal(t, int64(3600), input.EpochStart)
+	assert.Equal(t, []Aggregation{{Func: AggCount}}, input.Aggregations)
+}
+
+func Test_Aggregate_Scheduled(t *testing.T) {
+	input := &AggregateInput{
+		Aggregations: []Aggregation{{Func: AggCount}, {Func: AggAvg, Field: "duration"}, {Func: AggMax, Field: "duration"}, {Func: AggP50, Field: "duration"}},
+		GroupBy:      []string{"route"},
+	}
+
+	partial := func(route string, count int64, samples ...float64) *AggregateRow {
+		p := &AggregatePartial{Count: int64(len(samples)), Samples: samples}
+		for i, v := range samples {
+			p.Sum += v
+			if i == 0 || v < p.Min {
+				p.Min = v
+			}
+			p.Max = max(p.Max, v)
+		}
+		clone := func() *AggregatePartial {
+			c := *p
+			return &c
+		}
+		return &AggregateRow{Groups: []any{route}, Partials: []*AggregatePartial{{Count: count}, clone(), clone(), clone()}}
+	}
+
+	storage := &testMockApiStorage{
+		aggregate: func(i *AggregateInput) (*Output, error) {
+			return &Output{
+				Aggregate: []*AggregateRow{partial("/users", 2, 10, 20)},
+				Scheduled: true,
+				TaskIds:   []int32{1},
+			}, nil
+		},
+		results: map[int32]*Output{
+			1: {Aggregate: []*AggregateRow{partial("/users", 2, 30, 40), partial("/orders", 1)}},
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	out, err := log.Aggregate(input)
+	assert.Nil(t, err)
+	assert.False(t, out.Scheduled)
+	assert.Equal(t, 2, len(out.Aggregate))
+	assert.Equal(t, []any{"/orders"}, out.Aggregate[0].Groups)
+	assert.Equal(t, []any{int64(1), nil, nil, nil}, out.Aggregate[0].Values)
+	assert.Equal(t, []any{"/users"}, out.Aggregate[1].Groups)
+	assert.Equal(t, []any{int64(4), 25.0, 40.0, 25.0}, out.Aggregate[1].Values)
+}
+
+func Test_Aggregate_Samples(t *testing.T) {
+	samples := func(n int, v float64) []float64 {
+		list := make([]float64, n)
+		for i := range list {
+			list[i] = v
+		}
+		return list
+	}
+
+	p := &AggregatePartial{Count: 8000, Samples: samples(8000, 1)}
+	p.merge(&AggregatePartial{Count: 24000, Samples: samples(8000, 2)})
+	assert.Equal(t, int64(32000), p.Count)
+	assert.Equal(t, AggregateMaxSamples, len(p.Samples))
+
+	// in proportion to the number of values
+	ones := 0
+	for _, v := range p.Samples {
+		if v == 1 {
+			ones++
+		}
+	}
+	assert.Equal(t, 2500, ones)
+
+	// small samples are kept
+	p = &AggregatePartial{Count: 2, Samples: []float64{1, 2}}
+	p.merge(&AggregatePartial{Count: 1, Samples: []float64{3}})
+	assert.Equal(t, []float64{1, 2, 3}, p.Samples)
+}
@@ -0,0 +1,401 @@
+package sqlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertState state of an alert rule
+type AlertState string
+
+const (
+	AlertInactive AlertState = "inactive" // Condition not met
+	AlertPending  AlertState = "pending"  // Condition met, waiting AlertRule.ForSec
+	AlertFiring   AlertState = "firing"   // Condition met, notified
+	AlertResolved AlertState = "resolved" // Condition no longer met after firing, notified
+)
+
+// AlertRule fires when more than Threshold entries matching Expr and Level are
+// found in the last WindowSec seconds. Ex. `status:>=500` more than 50 times in 5m
+//
+//	AlertRule{Name: "http 5xx", Expr: "status:>=500", WindowSec: 300, Threshold: 50}
+type AlertRule struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Expr      string   `json:"expr"`
+	Level     []string `json:"level"`     // ["debug","info","warn","error"]
+	WindowSec int      `json:"window"`    // Time window evaluated, in seconds (Default: 300)
+	Threshold int64    `json:"threshold"` // The rule is active when count > Threshold
+	ForSec    int      `json:"for"`       // How long the rule must be active before firing (Default: 0, fires immediately)
+	RepeatSec int      `json:"repeat"`    // Interval to notify again while firing (Default: 0, notifies only once)
+}
+
+// AlertStatus is the rule with its current state
+type AlertStatus struct {
+	AlertRule
+	State      AlertState `json:"state"`
+	Count      int64      `json:"count"`           // Count of the last evaluation
+	Since      int64      `json:"since,omitempty"` // Epoch of the last state change
+	EvaluateAt int64      `json:"evaluated,omitempty"`
+	Error      string     `json:"error,omitempty"` // Error of the last evaluation
+}
+
+// AlertEvent is sent to the notifiers when an alert is firing or is resolved
+type AlertEvent struct {
+	Rule      AlertRule  `json:"rule"`
+	State     AlertState `json:"state"`
+	Count     int64      `json:"count"`
+	Since     time.Time  `json:"since"`
+	Time      time.Time  `json:"time"`
+	Repeating bool       `json:"repeating,omitempty"` // Notification repeated while firing
+}
+
+// Notifier delivers alert events (webhook, slog.Handler, e-mail, ...)
+type Notifier interface {
+	Notify(ctx context.Context, event *AlertEvent) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface
+type NotifierFunc func(ctx context.Context, event *AlertEvent) error
+
+func (f NotifierFunc) Notify(ctx context.Context, event *AlertEvent) error {
+	return f(ctx, event)
+}
+
+type AlertsConfig struct {
+	Rules     []*AlertRule // Initial rules
+	Notifiers []Notifier   // Receive the events of all rules
+
+	// File used to persist the rules changed by the api. When the file exists, the rules are loaded from it.
+	// (Default: "", rules are kept in memory).
+	File string
+
+	// Interval (in seconds) between the evaluations of the rules.
+	// (Default: 60 seconds).
+	IntervalSec int32
+}
+
+type alertRule struct {
+	AlertStatus
+	notifiedAt time.Time
+}
+
+var errAlertNotFound = errors.New("[sqlog] alert rule not found")
+
+var alertLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// Alerts evaluates the alert rules periodically against the storage
+type Alerts struct {
+	mu      sync.Mutex
+	config  *AlertsConfig
+	storage StorageWithApi
+	rules   map[string]*alertRule
+	seq     int64
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func newAlerts(config *AlertsConfig, storage Storage) (*Alerts, error) {
+	if config == nil {
+		config = &AlertsConfig{}
+	}
+	if config.IntervalSec <= 0 {
+		config.IntervalSec = 60
+	}
+
+	a := &Alerts{
+		config: config,
+		rules:  map[string]*alertRule{},
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	rules := config.Rules
+	if config.File != "" {
+		if data, err := os.ReadFile(config.File); err == nil {
+			rules = nil
+			if err = json.Unmarshal(data, &rules); err != nil {
+				return nil, errors.Join(errors.New("[sqlog] invalid alerts file"), err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	for _, rule := range rules {
+		if _, err := a.save(*rule); err != nil {
+			return nil, err
+		}
+	}
+
+	if s, ok := storage.(StorageWithApi); ok {
+		a.storage = s
+		go a.routineEvaluate()
+	} else {
+		close(a.done)
+	}
+
+	return a, nil
+}
+
+// Rules returns the rules with their current state, sorted by name
+func (a *Alerts) Rules() []AlertStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	list := make([]AlertStatus, 0, len(a.rules))
+	for _, r := range a.rules {
+		list = append(list, r.AlertStatus)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name == list[j].Name {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Save creates (empty ID) or updates a rule. The state is kept when the rule is updated.
+func (a *Alerts) Save(rule AlertRule) (AlertRule, error) {
+	rule, err := a.save(rule)
+	if err == nil {
+		err = a.persist()
+	}
+	return rule, err
+}
+
+// Delete removes a rule
+func (a *Alerts) Delete(id string) error {
+	a.mu.Lock()
+	_, exists := a.rules[id]
+	delete(a.rules, id)
+	a.mu.Unlock()
+
+	if !exists {
+		return errAlertNotFound
+	}
+	return a.persist()
+}
+
+func (a *Alerts) save(rule AlertRule) (AlertRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Expr = strings.TrimSpace(rule.Expr)
+	if rule.Name == "" {
+		return rule, errors.New("[sqlog] alert name is required")
+	}
+	if rule.Threshold < 0 || rule.ForSec < 0 || rule.RepeatSec < 0 {
+		return rule, errors.New("[sqlog] invalid alert rule")
+	}
+	if rule.WindowSec <= 0 {
+		rule.WindowSec = 300
+	}
+	// invalid rules are rejected here, instead of failing on every evaluation
+	if _, err := exprValidator(rule.Expr); err != nil {
+		return rule, errors.Join(errors.New("[sqlog] invalid alert expression"), err)
+	}
+	for _, level := range rule.Level {
+		if !alertLevels[level] {
+			return rule, fmt.Errorf("[sqlog] invalid alert level %q", level)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if rule.ID == "" {
+		a.seq++
+		rule.ID = strconv.FormatInt(time.Now().UnixNano(), 36) + strconv.FormatInt(a.seq, 36)
+	}
+
+	if r, exists := a.rules[rule.ID]; exists {
+		r.AlertRule = rule
+	} else {
+		a.rules[rule.ID] = &alertRule{AlertStatus: AlertStatus{AlertRule: rule, State: AlertInactive}}
+	}
+	return rule, nil
+}
+
+// persist saves the rules in AlertsConfig.File
+func (a *Alerts) persist() error {
+	if a.config.File == "" {
+		return nil
+	}
+
+	var rules []AlertRule
+	for _, r := range a.Rules() {
+		rules = append(rules, r.AlertRule)
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := a.config.File + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.config.File)
+}
+
+func (a *Alerts) routineEvaluate() {
+	defer close(a.done)
+
+	d := time.Duration(a.config.IntervalSec) * time.Second
+	tick := time.NewTicker(d)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			ctx, cancel := context.WithTimeout(context.Background(), d)
+			a.Evaluate(ctx)
+			cancel()
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+// Evaluate checks all rules now, notifying the state changes
+func (a *Alerts) Evaluate(ctx context.Context) {
+	a.evaluate(ctx, time.Now)
+}
+
+func (a *Alerts) evaluate(ctx context.Context, clock func() time.Time) {
+	if a.storage == nil {
+		return
+	}
+
+	var rules []AlertRule
+	for _, r := range a.Rules() {
+		rules = append(rules, r.AlertRule)
+	}
+
+	for _, rule := range rules {
+		now := clock()
+		count, err := a.count(ctx, rule, now)
+		if event := a.transition(rule.ID, count, err, now); event != nil {
+			a.notify(ctx, event)
+		}
+	}
+}
+
+// count the entries matching the rule in the window, waiting for scheduled results
+func (a *Alerts) count(ctx context.Context, rule AlertRule, now time.Time) (int64, error) {
+	output, err := a.storage.Ticks(&TicksInput{
+		Expr:        rule.Expr,
+		Level:       rule.Level,
+		EpochEnd:    now.Unix(),
+		IntervalSec: rule.WindowSec,
+		MaxResult:   1,
+	})
+	if err != nil || output == nil {
+		return 0, err
+	}
+
+	count := countTicks(output.Ticks)
+	err = waitScheduled(ctx, a.storage, output.TaskIds, func(result *Output) error {
+		count += countTicks(result.Ticks)
+		return nil
+	})
+	return count, err
+}
+
+func countTicks(ticks []*Tick) (count int64) {
+	for _, t := range ticks {
+		count += t.Count
+	}
+	return
+}
+
+// transition updates the state of the rule, returning the event to be notified (if any)
+func (a *Alerts) transition(id string, count int64, err error, now time.Time) *AlertEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r, exists := a.rules[id]
+	if !exists {
+		return nil // deleted during evaluation
+	}
+
+	r.EvaluateAt = now.Unix()
+	if err != nil {
+		r.Error = err.Error()
+		return nil
+	}
+	r.Error = ""
+	r.Count = count
+
+	var (
+		state     = r.State
+		active    = count > r.Threshold
+		repeating bool
+	)
+	switch {
+	case active && (state == AlertInactive || state == AlertResolved):
+		state = AlertPending
+		if r.ForSec == 0 {
+			state = AlertFiring
+		}
+	case active && state == AlertPending:
+		if now.Unix()-r.Since >= int64(r.ForSec) {
+			state = AlertFiring
+		}
+	case active && state == AlertFiring:
+		repeating = r.RepeatSec > 0 && now.Sub(r.notifiedAt) >= time.Duration(r.RepeatSec)*time.Second
+	case !active && state == AlertFiring:
+		state = AlertResolved
+	case !active && state == AlertPending:
+		state = AlertInactive
+	}
+
+	changed := state != r.State
+	if changed {
+		r.State = state
+		r.Since = now.Unix()
+	}
+
+	if (changed && (state == AlertFiring || state == AlertResolved)) || repeating {
+		r.notifiedAt = now
+		return &AlertEvent{
+			Rule:      r.AlertRule,
+			State:     state,
+			Count:     count,
+			Since:     time.Unix(r.Since, 0),
+			Time:      now,
+			Repeating: repeating,
+		}
+	}
+	return nil
+}
+
+func (a *Alerts) notify(ctx context.Context, event *AlertEvent) {
+	for _, n := range a.config.Notifiers {
+		if err := n.Notify(ctx, event); err != nil {
+			slog.Warn(
+				"[sqlog] error notifying alert",
+				slog.String("alert", event.Rule.Name),
+				slog.Any("error", err),
+			)
+		}
+	}
+}
+
+// close stops the evaluation routine
+func (a *Alerts) close() {
+	select {
+	case <-a.quit:
+	default:
+		close(a.quit)
+	}
+	<-a.done
+}
@@ -0,0 +1,89 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier sends the alert events as JSON (POST) to an url
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client // (Default: http.Client with 10 seconds timeout)
+}
+
+// NewWebhookNotifier creates a notifier that posts the events to the url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event *AlertEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("[sqlog] webhook %s returned status %d", n.URL, res.StatusCode)
+	}
+	return nil
+}
+
+// HandlerNotifier writes the alert events to a slog.Handler.
+// Firing alerts are logged as ERROR and resolved alerts as INFO.
+type HandlerNotifier struct {
+	Handler slog.Handler
+}
+
+// NewHandlerNotifier creates a notifier that writes the events to the handler
+func NewHandlerNotifier(handler slog.Handler) *HandlerNotifier {
+	return &HandlerNotifier{Handler: handler}
+}
+
+func (n *HandlerNotifier) Notify(ctx context.Context, event *AlertEvent) error {
+	level := slog.LevelError
+	if event.State == AlertResolved {
+		level = slog.LevelInfo
+	}
+	if !n.Handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	record := slog.NewRecord(event.Time, level, "[sqlog] alert "+string(event.State)+": "+event.Rule.Name, 0)
+	record.AddAttrs(slog.Group("alert",
+		slog.String("id", event.Rule.ID),
+		slog.String("name", event.Rule.Name),
+		slog.String("state", string(event.State)),
+		slog.String("expr", event.Rule.Expr),
+		slog.Int64("count", event.Count),
+		slog.Int64("threshold", event.Rule.Threshold),
+		slog.Int("window", event.Rule.WindowSec),
+		slog.Time("since", event.Since),
+	))
+	return n.Handler.Handle(ctx, record)
+}
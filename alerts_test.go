@@ -0,0 +1,230 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMockApiStorage struct {
+	DummyStorage
+	ticks     func(input *TicksInput) (*Output, error)
+	entries   func(input *EntriesInput) (*Output, error)
+	aggregate func(input *AggregateInput) (*Output, error)
+	fields    func(input *FieldsInput) (*Output, error)
+	results   map[int32]*Output
+}
+
+func (s *testMockApiStorage) Ticks(input *TicksInput) (*Output, error) {
+	return s.ticks(input)
+}
+
+func (s *testMockApiStorage) Entries(input *EntriesInput) (*Output, error) {
+	if s.entries == nil {
+		return &Output{}, nil
+	}
+	return s.entries(input)
+}
+
+func (s *testMockApiStorage) GetEntry(id string) (*Output, error) {
+	epoch, nanos, err := ParseEntryID(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.Entries(&EntriesInput{Direction: "after", EpochStart: epoch, NanosStart: nanos - 1, MaxResult: 10})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range out.Entries {
+		if e.ID == id {
+			return &Output{Entries: []*EntryView{e}}, nil
+		}
+	}
+	return &Output{}, nil
+}
+
+func (s *testMockApiStorage) Aggregate(input *AggregateInput) (*Output, error) {
+	return s.aggregate(input)
+}
+
+func (s *testMockApiStorage) Fields(input *FieldsInput) (*Output, error) {
+	return s.fields(input)
+}
+
+func (s *testMockApiStorage) Result(taskId int32) (*Output, error) {
+	return s.results[taskId], nil
+}
+
+func (s *testMockApiStorage) Cancel(taskId int32) error {
+	delete(s.results, taskId)
+	return nil
+}
+
+func Test_Alerts_Transitions(t *testing.T) {
+	var (
+		count  int64
+		input  *TicksInput
+		events []*AlertEvent
+	)
+
+	storage := &testMockApiStorage{ticks: func(i *TicksInput) (*Output, error) {
+		input = i
+		return &Output{Ticks: []*Tick{{Count: count}}}, nil
+	}}
+
+	alerts, err := newAlerts(&AlertsConfig{
+		Rules: []*AlertRule{{ID: "5xx", Name: "http 5xx", Expr: "status:>=500", Threshold: 50, ForSec: 60}},
+		Notifiers: []Notifier{NotifierFunc(func(ctx context.Context, event *AlertEvent) error {
+			events = append(events, event)
+			return nil
+		})},
+	}, storage)
+	assert.Nil(t, err)
+	defer alerts.close()
+
+	now := time.Now()
+	evaluate := func(elapsed time.Duration) AlertState {
+		alerts.evaluate(context.Background(), func() time.Time { return now.Add(elapsed) })
+		return alerts.Rules()[0].State
+	}
+
+	count = 10
+	assert.Equal(t, AlertInactive, evaluate(0))
+	assert.Equal(t, "status:>=500", input.Expr)
+	assert.Equal(t, 300, input.IntervalSec)
+	assert.Equal(t, 1, input.MaxResult)
+
+	count = 51
+	assert.Equal(t, AlertPending, evaluate(time.Minute))
+	assert.Equal(t, AlertPending, evaluate(90*time.Second))
+	assert.Equal(t, AlertFiring, evaluate(2*time.Minute))
+	assert.Equal(t, AlertFiring, evaluate(3*time.Minute)) // de-duplicated
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, AlertFiring, events[0].State)
+	assert.Equal(t, int64(51), events[0].Count)
+
+	count = 0
+	assert.Equal(t, AlertResolved, evaluate(4*time.Minute))
+	assert.Equal(t, AlertResolved, evaluate(5*time.Minute))
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, AlertResolved, events[1].State)
+}
+
+func Test_Alerts_Scheduled(t *testing.T) {
+	storage := &testMockApiStorage{
+		ticks: func(i *TicksInput) (*Output, error) {
+			return &Output{Ticks: []*Tick{{Count: 3}}, Scheduled: true, TaskIds: []int32{1, 2}}, nil
+		},
+		results: map[int32]*Output{
+			1: {Ticks: []*Tick{{Count: 4}}},
+			2: {Ticks: []*Tick{{Count: 5}}},
+		},
+	}
+
+	alerts, err := newAlerts(&AlertsConfig{Rules: []*AlertRule{{Name: "errors", Level: []string{"error"}, Threshold: 10}}}, storage)
+	assert.Nil(t, err)
+	defer alerts.close()
+
+	alerts.Evaluate(context.Background())
+	rule := alerts.Rules()[0]
+	assert.Equal(t, int64(12), rule.Count)
+	assert.Equal(t, AlertFiring, rule.State)
+
+	// evicted result, unknown state in this evaluation
+	delete(storage.results, 2)
+	alerts.Evaluate(context.Background())
+	rule = alerts.Rules()[0]
+	assert.Equal(t, int64(12), rule.Count)
+	assert.Equal(t, AlertFiring, rule.State)
+	assert.Contains(t, rule.Error, "result of the task 2 is not available")
+}
+
+func Test_Alerts_Save(t *testing.T) {
+	alerts, err := newAlerts(nil, nil)
+	assert.Nil(t, err)
+	defer alerts.close()
+
+	_, err = alerts.Save(AlertRule{Name: "errors", Expr: "status:>=500 AND path:a:b"})
+	assert.ErrorContains(t, err, "invalid alert expression")
+
+	_, err = alerts.Save(AlertRule{Name: "errors", Level: []string{"fatal"}})
+	assert.ErrorContains(t, err, `invalid alert level "fatal"`)
+
+	_, err = alerts.Save(AlertRule{Name: "errors", Expr: "status:>=500", Level: []string{"warn", "error"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(alerts.Rules()))
+}
+
+func Test_Alerts_Notifiers(t *testing.T) {
+	var received *AlertEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = &AlertEvent{}
+		json.NewDecoder(r.Body).Decode(received)
+	}))
+	defer server.Close()
+
+	event := &AlertEvent{
+		Rule:  AlertRule{ID: "1", Name: "errors", Threshold: 10, WindowSec: 60},
+		State: AlertFiring,
+		Count: 11,
+		Time:  time.Now(),
+	}
+
+	assert.Nil(t, NewWebhookNotifier(server.URL).Notify(context.Background(), event))
+	assert.Equal(t, "errors", received.Rule.Name)
+	assert.Equal(t, int64(11), received.Count)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, NewHandlerNotifier(slog.NewJSONHandler(buf, nil)).Notify(context.Background(), event))
+	assert.Contains(t, buf.String(), `"level":"ERROR","msg":"[sqlog] alert firing: errors","alert":{"id":"1","name":"errors","state":"firing"`)
+}
+
+func Test_Http_Alerts(t *testing.T) {
+	file := path.Join(t.TempDir(), "alerts.json")
+	log, err := New(&Config{Alerts: &AlertsConfig{File: file}})
+	assert.Nil(t, err)
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/api/alerts", strings.NewReader(`{"name":"errors","expr":"status:>=500","threshold":50}`))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	rule := AlertRule{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&rule))
+	assert.NotEmpty(t, rule.ID)
+	assert.Equal(t, 300, rule.WindowSec)
+	log.Stop()
+
+	// reload from file
+	log, err = New(&Config{Alerts: &AlertsConfig{File: file}})
+	assert.Nil(t, err)
+	defer log.Stop()
+	handler = log.HttpHandler()
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/alerts", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	var list []AlertStatus
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&list))
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, rule.ID, list[0].ID)
+	assert.Equal(t, AlertInactive, list[0].State)
+
+	req = httptest.NewRequest(http.MethodDelete, "/logs/api/alerts?id="+rule.ID, nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, 0, len(log.Alerts().Rules()))
+}
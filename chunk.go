@@ -11,6 +11,7 @@ type Entry struct {
 	Time    time.Time
 	Level   int8
 	Content []byte
+	Stream  string // Name of the stream, empty for the default (see Log.WithStream)
 }
 
 // Chunk stores up to 900 log entries that will be persisted in the storage
@@ -147,6 +148,29 @@ func (c *Chunk) List() []*Entry {
 	return c.entries[:atomic.LoadInt32(&c.write)]
 }
 
+// Streams splits the written entries by stream (see Entry.Stream), each stream receiving a new chunk.
+// Returns this chunk when all the entries belong to the same stream.
+func (c *Chunk) Streams() map[string]*Chunk {
+	streams := map[string]*Chunk{}
+	for _, e := range c.List() {
+		if e == nil {
+			continue
+		}
+		sc, exists := streams[e.Stream]
+		if !exists {
+			sc = NewChunk(c.cap)
+			streams[e.Stream] = sc
+		}
+		sc.Put(e)
+	}
+	if len(streams) <= 1 {
+		for stream := range streams {
+			return map[string]*Chunk{stream: c}
+		}
+	}
+	return streams
+}
+
 // Put attempts to write the log entry into this chunk.
 // Returns the chunk that accepted the entry.
 // If the chunk that accepted the entry is the same, it returns false in the second parameter.
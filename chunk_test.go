@@ -109,3 +109,24 @@ func Test_Chunk_Put(t *testing.T) {
 	assert.NotEqual(t, chunk, resultChunk, "A new chunk should accept the entry after the current chunk is full")
 	assert.True(t, isFull, "Original chunk should be full after the second insertion")
 }
+
+func Test_Chunk_Streams(t *testing.T) {
+	chunk := NewChunk(10)
+	chunk.Put(&Entry{Time: time.Unix(100, 0)})
+	chunk.Put(&Entry{Time: time.Unix(200, 0)})
+
+	streams := chunk.Streams()
+	assert.Equal(t, map[string]*Chunk{"": chunk}, streams, "Chunk with a single stream should not be split")
+
+	chunk.Put(&Entry{Time: time.Unix(150, 0), Stream: "billing"})
+	chunk.Put(&Entry{Time: time.Unix(300, 0), Stream: "billing"})
+
+	streams = chunk.Streams()
+	assert.Len(t, streams, 2)
+	assert.Len(t, streams[""].List(), 2)
+	assert.Len(t, streams["billing"].List(), 2)
+	assert.Equal(t, int64(100), streams[""].First())
+	assert.Equal(t, int64(200), streams[""].Last())
+	assert.Equal(t, int64(150), streams["billing"].First())
+	assert.Equal(t, int64(300), streams["billing"].Last())
+}
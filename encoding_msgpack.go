@@ -0,0 +1,564 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MessagePack content type
+// See https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	ContentTypeJSON    = "json"
+	ContentTypeMsgpack = "msgpack"
+)
+
+var errMsgpackInvalid = errors.New("[sqlog] invalid msgpack content")
+
+// MsgpackEncoder encodes the log records using MessagePack, with the same structure as slog.JSONHandler.
+// Reduces storage size and encoding cost. Ex.
+//
+//	sqlog.Config{Handler: &sqlog.HandlerConfig{Encoder: sqlog.MsgpackEncoder}}
+func MsgpackEncoder(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	return NewMsgpackHandler(w, opts)
+}
+
+// msgpackFrame attributes added by WithAttrs inside a group opened by WithGroup
+type msgpackFrame struct {
+	group string
+	attrs []slog.Attr
+}
+
+// MsgpackHandler a slog.Handler that writes records as MessagePack maps
+type MsgpackHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	opts   slog.HandlerOptions
+	frames []msgpackFrame // frames[0] is the root
+}
+
+// NewMsgpackHandler creates a MsgpackHandler that writes to w, using the given options.
+func NewMsgpackHandler(w io.Writer, opts *slog.HandlerOptions) *MsgpackHandler {
+	h := &MsgpackHandler{mu: &sync.Mutex{}, w: w, frames: []msgpackFrame{{}}}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *MsgpackHandler) Enabled(_ context.Context, l slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return l >= minLevel
+}
+
+func (h *MsgpackHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	o := *h
+	o.frames = slices.Clone(h.frames)
+	last := &o.frames[len(o.frames)-1]
+	last.attrs = append(slices.Clip(last.attrs), attrs...)
+	return &o
+}
+
+func (h *MsgpackHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	o := *h
+	o.frames = append(slices.Clip(h.frames), msgpackFrame{group: name})
+	return &o
+}
+
+func (h *MsgpackHandler) Handle(_ context.Context, r slog.Record) error {
+	var (
+		b        = make([]byte, 0, 512)
+		builtins []slog.Attr
+	)
+
+	if !r.Time.IsZero() {
+		builtins = append(builtins, slog.Time(slog.TimeKey, r.Time))
+	}
+	builtins = append(builtins, slog.Any(slog.LevelKey, r.Level))
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		builtins = append(builtins, slog.Any(slog.SourceKey, &slog.Source{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		}))
+	}
+	builtins = append(builtins, slog.String(slog.MessageKey, r.Message))
+
+	var recordAttrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		recordAttrs = append(recordAttrs, a)
+		return true
+	})
+
+	root := h.collect(nil, builtins)
+	root = append(root, h.collect(nil, h.frameAttrs(0, recordAttrs))...)
+	b = appendMsgpackAttrs(b, root)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b)
+	return err
+}
+
+// frameAttrs nests the attributes of the frames (groups), the record attributes are in the last frame
+func (h *MsgpackHandler) frameAttrs(index int, recordAttrs []slog.Attr) []slog.Attr {
+	attrs := slices.Clip(h.frames[index].attrs)
+	if index == len(h.frames)-1 {
+		return append(attrs, recordAttrs...)
+	}
+	next := h.frames[index+1]
+	return append(attrs, slog.Attr{Key: next.group, Value: slog.GroupValue(h.frameAttrs(index+1, recordAttrs)...)})
+}
+
+// collect resolves the attributes and applies HandlerOptions.ReplaceAttr, removing empty
+// attributes and groups and inlining groups without key (same rules of slog.JSONHandler)
+func (h *MsgpackHandler) collect(groups []string, attrs []slog.Attr) []slog.Attr {
+	var list []slog.Attr
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() == slog.KindGroup {
+			if a.Key == "" {
+				list = append(list, h.collect(groups, a.Value.Group())...)
+			} else if group := h.collect(append(slices.Clip(groups), a.Key), a.Value.Group()); len(group) > 0 {
+				list = append(list, slog.Attr{Key: a.Key, Value: slog.GroupValue(group...)})
+			}
+			continue
+		}
+		if h.opts.ReplaceAttr != nil {
+			a = h.opts.ReplaceAttr(groups, a)
+			a.Value = a.Value.Resolve()
+		}
+		if a.Key == "" || (a.Value.Kind() == slog.KindGroup && len(a.Value.Group()) == 0) {
+			continue
+		}
+		list = append(list, a)
+	}
+	return list
+}
+
+// appendMsgpackAttrs writes the attributes (already collected) as a map
+func appendMsgpackAttrs(b []byte, attrs []slog.Attr) []byte {
+	b = appendMsgpackMapHeader(b, len(attrs))
+	for _, a := range attrs {
+		b = appendMsgpackString(b, a.Key)
+		if a.Value.Kind() == slog.KindGroup {
+			b = appendMsgpackAttrs(b, a.Value.Group())
+		} else {
+			b = appendMsgpackValue(b, a.Value)
+		}
+	}
+	return b
+}
+
+// appendMsgpackValue writes a slog.Value, using the same representation as slog.JSONHandler
+func appendMsgpackValue(b []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendMsgpackString(b, v.String())
+	case slog.KindInt64:
+		return appendMsgpackInt(b, v.Int64())
+	case slog.KindUint64:
+		return appendMsgpackUint(b, v.Uint64())
+	case slog.KindFloat64:
+		return appendMsgpackFloat(b, v.Float64())
+	case slog.KindBool:
+		return appendMsgpackBool(b, v.Bool())
+	case slog.KindDuration:
+		return appendMsgpackInt(b, int64(v.Duration()))
+	case slog.KindTime:
+		return appendMsgpackString(b, v.Time().Format(time.RFC3339Nano))
+	default:
+		return appendMsgpackAny(b, v.Any())
+	}
+}
+
+// appendMsgpackAny writes any value, unknown types are converted through encoding/json
+func appendMsgpackAny(b []byte, v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case string:
+		return appendMsgpackString(b, x)
+	case bool:
+		return appendMsgpackBool(b, x)
+	case int:
+		return appendMsgpackInt(b, int64(x))
+	case int64:
+		return appendMsgpackInt(b, x)
+	case uint64:
+		return appendMsgpackUint(b, x)
+	case float64:
+		return appendMsgpackFloat(b, x)
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return appendMsgpackInt(b, n)
+		}
+		f, _ := x.Float64()
+		return appendMsgpackFloat(b, f)
+	case slog.Level:
+		return appendMsgpackString(b, x.String())
+	case *slog.Source:
+		b = appendMsgpackMapHeader(b, 3)
+		b = appendMsgpackString(b, "function")
+		b = appendMsgpackString(b, x.Function)
+		b = appendMsgpackString(b, "file")
+		b = appendMsgpackString(b, x.File)
+		b = appendMsgpackString(b, "line")
+		return appendMsgpackInt(b, int64(x.Line))
+	case error:
+		if _, isMarshaler := x.(json.Marshaler); !isMarshaler {
+			return appendMsgpackString(b, x.Error())
+		}
+	case []any:
+		b = appendMsgpackArrayHeader(b, len(x))
+		for _, item := range x {
+			b = appendMsgpackAny(b, item)
+		}
+		return b
+	case map[string]any:
+		b = appendMsgpackMapHeader(b, len(x))
+		for k, item := range x {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpackAny(b, item)
+		}
+		return b
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendMsgpackString(b, fmt.Sprintf("!ERROR:%v", err))
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var generic any
+	if err = d.Decode(&generic); err != nil {
+		return appendMsgpackString(b, fmt.Sprintf("!ERROR:%v", err))
+	}
+	return appendMsgpackAny(b, generic)
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(b, uint64(n))
+	case n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
+
+func appendMsgpackUint(b []byte, n uint64) []byte {
+	switch {
+	case n <= 0x7f:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), n)
+	}
+}
+
+func appendMsgpackFloat(b []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f))
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+// IsMsgpack checks if the content is a MessagePack map (JSON content starts with '{')
+func IsMsgpack(content []byte) bool {
+	if len(content) == 0 {
+		return false
+	}
+	c := content[0]
+	return (c >= 0x80 && c <= 0x8f) || c == 0xde || c == 0xdf
+}
+
+// DecodeMsgpack decodes MessagePack content into Go values
+// (map[string]any, []any, string, int64, uint64, float64, bool, []byte, nil).
+func DecodeMsgpack(content []byte) (any, error) {
+	d := &msgpackDecoder{b: content}
+	return d.decode()
+}
+
+// MsgpackToJSON converts MessagePack content to JSON, keeping the order of the keys
+func MsgpackToJSON(content []byte) ([]byte, error) {
+	d := &msgpackDecoder{b: content}
+	return d.appendJSON(make([]byte, 0, len(content)+len(content)/4))
+}
+
+type msgpackDecoder struct {
+	b []byte
+	i int
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.i+n > len(d.b) {
+		return nil, errMsgpackInvalid
+	}
+	v := d.b[d.i : d.i+n]
+	d.i += n
+	return v, nil
+}
+
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	v, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(v[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(v)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(v)), nil
+	default:
+		return binary.BigEndian.Uint64(v), nil
+	}
+}
+
+// header reads the type of the next value: 'm'=map, 'a'=array or 'v'=value, with its length or value
+func (d *msgpackDecoder) header() (kind byte, length int, value any, err error) {
+	t, err := d.read(1)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	c := t[0]
+
+	var n uint64
+	switch {
+	case c <= 0x7f:
+		return 'v', 0, int64(c), nil
+	case c >= 0xe0:
+		return 'v', 0, int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return 'm', int(c & 0x0f), nil, nil
+	case c >= 0x90 && c <= 0x9f:
+		return 'a', int(c & 0x0f), nil, nil
+	case c >= 0xa0 && c <= 0xbf:
+		s, err := d.read(int(c & 0x1f))
+		return 'v', 0, string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return 'v', 0, nil, nil
+	case 0xc2:
+		return 'v', 0, false, nil
+	case 0xc3:
+		return 'v', 0, true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := map[byte]int{0xc4: 1, 0xc5: 2, 0xc6: 4, 0xd9: 1, 0xda: 2, 0xdb: 4}[c]
+		if n, err = d.readUint(size); err != nil {
+			return 0, 0, nil, err
+		}
+		s, err := d.read(int(n))
+		if c <= 0xc6 {
+			return 'v', 0, bytes.Clone(s), err
+		}
+		return 'v', 0, string(s), err
+	case 0xca:
+		n, err = d.readUint(4)
+		return 'v', 0, float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err = d.readUint(8)
+		return 'v', 0, math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err = d.readUint(1 << (c - 0xcc))
+		if err == nil && n <= math.MaxInt64 {
+			return 'v', 0, int64(n), nil
+		}
+		return 'v', 0, n, err
+	case 0xd0:
+		n, err = d.readUint(1)
+		return 'v', 0, int64(int8(n)), err
+	case 0xd1:
+		n, err = d.readUint(2)
+		return 'v', 0, int64(int16(n)), err
+	case 0xd2:
+		n, err = d.readUint(4)
+		return 'v', 0, int64(int32(n)), err
+	case 0xd3:
+		n, err = d.readUint(8)
+		return 'v', 0, int64(n), err
+	case 0xdc, 0xdd:
+		if n, err = d.readUint(2 << (c - 0xdc)); err == nil && n > uint64(len(d.b)-d.i) {
+			// each item has at least one byte, corrupted lengths are not allocated
+			err = errMsgpackInvalid
+		}
+		return 'a', int(n), nil, err
+	case 0xde, 0xdf:
+		if n, err = d.readUint(2 << (c - 0xde)); err == nil && n > uint64(len(d.b)-d.i) {
+			err = errMsgpackInvalid
+		}
+		return 'm', int(n), nil, err
+	}
+	return 0, 0, nil, errMsgpackInvalid
+}
+
+func (d *msgpackDecoder) decode() (any, error) {
+	kind, length, value, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 'm':
+		m := make(map[string]any, length)
+		for i := 0; i < length; i++ {
+			k, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, nil
+	case 'a':
+		a := make([]any, 0, length)
+		for i := 0; i < length; i++ {
+			v, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	}
+	return value, nil
+}
+
+func (d *msgpackDecoder) appendJSON(b []byte) ([]byte, error) {
+	kind, length, value, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 'm':
+		b = append(b, '{')
+		for i := 0; i < length; i++ {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			k, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			b = appendJSONValue(b, fmt.Sprint(k))
+			b = append(b, ':')
+			if b, err = d.appendJSON(b); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	case 'a':
+		b = append(b, '[')
+		for i := 0; i < length; i++ {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = d.appendJSON(b); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	}
+	return appendJSONValue(b, value), nil
+}
+
+func appendJSONValue(b []byte, v any) []byte {
+	switch x := v.(type) {
+	case nil:
+		return append(b, "null"...)
+	case int64:
+		return strconv.AppendInt(b, x, 10)
+	case uint64:
+		return strconv.AppendUint(b, x, 10)
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return strconv.AppendQuote(b, strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(b, x, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(b, x)
+	default:
+		data, _ := json.Marshal(x)
+		return append(b, data...)
+	}
+}
@@ -0,0 +1,103 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Msgpack_Handler(t *testing.T) {
+	var (
+		jsonBuf    = &bytes.Buffer{}
+		msgpackBuf = &bytes.Buffer{}
+		opts       = &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == "password" {
+					return slog.String(a.Key, "***")
+				}
+				return a
+			},
+		}
+	)
+
+	record := slog.NewRecord(time.Date(2024, 10, 1, 10, 30, 0, 123456789, time.UTC), slog.LevelWarn, "message", 0)
+	record.AddAttrs(
+		slog.String("str", "value"),
+		slog.Int("int", -42),
+		slog.Uint64("uint", 42),
+		slog.Float64("float", 1.5),
+		slog.Bool("bool", true),
+		slog.Duration("duration", time.Second),
+		slog.Any("error", errors.New("failed")),
+		slog.Any("map", map[string]any{"a": []int{1, 2}}),
+		slog.String("password", "secret"),
+		slog.Group("empty"),
+		slog.Group("", slog.String("inline", "yes")),
+	)
+
+	for _, handler := range []slog.Handler{slog.NewJSONHandler(jsonBuf, opts), NewMsgpackHandler(msgpackBuf, opts)} {
+		h := handler.WithAttrs([]slog.Attr{slog.String("app", "sqlog")}).WithGroup("request").WithAttrs([]slog.Attr{slog.Int("id", 7)})
+		assert.Nil(t, h.Handle(context.Background(), record))
+		assert.Nil(t, handler.WithGroup("unused").Handle(context.Background(), slog.NewRecord(record.Time, slog.LevelInfo, "empty", 0)))
+	}
+
+	assert.True(t, IsMsgpack(msgpackBuf.Bytes()))
+	assert.Less(t, msgpackBuf.Len(), jsonBuf.Len())
+
+	var (
+		expected = json.NewDecoder(jsonBuf)
+		content  = msgpackBuf.Bytes()
+	)
+	for len(content) > 0 {
+		d := &msgpackDecoder{b: content}
+		converted, err := d.appendJSON(nil)
+		assert.Nil(t, err)
+		content = content[d.i:]
+
+		var want, got map[string]any
+		assert.Nil(t, expected.Decode(&want))
+		assert.Nil(t, json.Unmarshal(converted, &got))
+		assert.Equal(t, want, got)
+	}
+}
+
+func Test_Msgpack_Decode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewMsgpackHandler(buf, nil))
+	logger.Info("hello", slog.Group("user", slog.Int("id", 300), slog.String("name", "alex")))
+
+	value, err := DecodeMsgpack(buf.Bytes())
+	assert.Nil(t, err)
+
+	m := value.(map[string]any)
+	assert.Equal(t, "hello", m["msg"])
+	assert.Equal(t, "INFO", m["level"])
+	assert.Equal(t, map[string]any{"id": int64(300), "name": "alex"}, m["user"])
+
+	data, err := MsgpackToJSON(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"msg":"hello","user":{"id":300,"name":"alex"}}`)
+
+	_, err = DecodeMsgpack(buf.Bytes()[:10])
+	assert.Equal(t, errMsgpackInvalid, err)
+
+	// corrupted lengths of maps and arrays
+	for _, content := range [][]byte{
+		{0xdf, 0xff, 0xff, 0xff, 0xff, 0xa1, 'a', 0x01},
+		{0xdd, 0x7f, 0xff, 0xff, 0xff, 0x01},
+		{0xde, 0x00, 0x03, 0xa1, 'a', 0x01},
+	} {
+		_, err = DecodeMsgpack(content)
+		assert.Equal(t, errMsgpackInvalid, err)
+		_, err = MsgpackToJSON(content)
+		assert.Equal(t, errMsgpackInvalid, err)
+	}
+	assert.False(t, IsMsgpack([]byte(`{"msg":"hello"}`)))
+}
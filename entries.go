@@ -0,0 +1,221 @@
+package sqlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errEntryNotFound = errors.New("[sqlog] entry not found")
+	errEntryID       = errors.New("[sqlog] invalid entry id")
+)
+
+// EntryView is a log entry returned by the api
+type EntryView struct {
+	ID      string         `json:"id"`               // Stable identifier (see EntryID)
+	Time    time.Time      `json:"time"`             //
+	Epoch   int64          `json:"epoch"`            // Time in seconds, used for pagination
+	Nanos   int            `json:"nanos"`            // Nanoseconds of the time, used for pagination
+	Level   slog.Level     `json:"level"`            //
+	Message string         `json:"msg"`              //
+	Attrs   map[string]any `json:"attrs"`            // Parsed content (including time, level and msg)
+	Stream  string         `json:"stream,omitempty"` // Stream of the entry, empty for the default
+	Content []byte         `json:"-"`                // Raw content, as encoded (JSON or msgpack)
+}
+
+// NewEntryView creates the view of an entry, parsing the content (JSON or msgpack)
+func NewEntryView(epoch int64, nanos int, level int, content []byte) (*EntryView, error) {
+	e := &EntryView{
+		ID:      EntryID(epoch, nanos, content),
+		Time:    time.Unix(epoch, int64(nanos)),
+		Epoch:   epoch,
+		Nanos:   nanos,
+		Level:   slog.Level(level),
+		Content: content,
+	}
+
+	if IsMsgpack(content) {
+		value, err := DecodeMsgpack(content)
+		if err != nil {
+			return nil, err
+		}
+		e.Attrs, _ = value.(map[string]any)
+	} else if err := json.Unmarshal(content, &e.Attrs); err != nil {
+		return nil, err
+	}
+
+	e.Message, _ = e.Attrs[slog.MessageKey].(string)
+	return e, nil
+}
+
+// EntryID returns the stable identifier of an entry, in the format "epoch.nanos.hash" (fnv-1a of the content).
+// Ex. "1729000000.123456789.9f3a1c2b"
+func EntryID(epoch int64, nanos int, content []byte) string {
+	h := fnv.New32a()
+	h.Write(content)
+	return strconv.FormatInt(epoch, 10) + "." + strconv.Itoa(nanos) + "." + fmt.Sprintf("%08x", h.Sum32())
+}
+
+// ParseEntryID returns the epoch and nanos of the identifier (see EntryID)
+func ParseEntryID(id string) (epoch int64, nanos int, err error) {
+	parts := strings.Split(id, ".")
+	if len(parts) != 3 || len(parts[2]) != 8 {
+		return 0, 0, errEntryID
+	}
+	if epoch, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, 0, errEntryID
+	}
+	if nanos, err = strconv.Atoi(parts[1]); err != nil || nanos < 0 || nanos > 999999999 {
+		return 0, 0, errEntryID
+	}
+	return epoch, nanos, nil
+}
+
+type EntriesContextInput struct {
+	ID      string   `json:"id"`      // Entry id (see EntryID)
+	Expr    string   `json:"expr"`    // Filter of the surrounding entries, the current search is ignored. Ex. "host:web-1"
+	Before  int      `json:"before"`  // Number of entries before (Default: 50, max 500)
+	After   int      `json:"after"`   // Number of entries after (Default: 50, max 500)
+	Source  string   `json:"source"`  // Label of the attached source of the entry, empty for the live storage
+	Streams []string `json:"streams"` // Names of the streams (Default: all)
+}
+
+// GetEntry returns the entry by id, waiting for the scheduled results (up to 30 seconds)
+func (l *sqlog) GetEntry(id string) (*EntryView, error) {
+	s, ok := l.storage.(StorageWithApi)
+	if !ok {
+		return nil, errEntryNotFound
+	}
+	if _, _, err := ParseEntryID(id); err != nil {
+		return nil, err
+	}
+
+	out, err := s.GetEntry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := out.Entries
+	if out.Scheduled {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err = waitScheduled(ctx, s, out.TaskIds, func(result *Output) error {
+			entries = append(entries, result.Entries...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, errEntryNotFound
+}
+
+// EntriesContext returns the entries surrounding the entry (oldest first, including the entry),
+// reading the database of the entry and its neighbours.
+func (l *sqlog) EntriesContext(input *EntriesContextInput) (*Output, error) {
+	s, ok := l.storage.(StorageWithApi)
+	if !ok {
+		return &Output{}, nil
+	}
+
+	entry, err := l.GetEntry(input.ID)
+	if err != nil {
+		return nil, err
+	}
+	epoch, nanos := entry.Epoch, entry.Nanos
+	if input.Before < 0 || input.Before > 500 {
+		input.Before = 500
+	} else if input.Before == 0 {
+		input.Before = 50
+	}
+	if input.After < 0 || input.After > 500 {
+		input.After = 500
+	} else if input.After == 0 {
+		input.After = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var before, after []*EntryView
+	err = readEntries(ctx, s, EntriesInput{Expr: input.Expr, Source: input.Source, Streams: input.Streams, Direction: "before", EpochStart: epoch, NanosStart: nanos, MaxResult: min(input.Before, 100)}, func(e *EntryView) bool {
+		before = append(before, e)
+		return len(before) < input.Before
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readEntries(ctx, s, EntriesInput{Expr: input.Expr, Source: input.Source, Streams: input.Streams, Direction: "after", EpochStart: epoch, NanosStart: nanos, MaxResult: min(input.After, 100)}, func(e *EntryView) bool {
+		after = append(after, e)
+		return len(after) < input.After
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(before)
+	entries := append(before, entry)
+	return &Output{Entries: append(entries, after...)}, nil
+}
+
+// entriesContext fetches the page, interrupted when the context is done if the storage supports it
+func entriesContext(ctx context.Context, s StorageWithApi, input *EntriesInput) (*Output, error) {
+	if sc, ok := s.(StorageWithContext); ok {
+		return sc.EntriesContext(ctx, input)
+	}
+	return s.Entries(input)
+}
+
+// readEntries reads the entries page by page (keyset pagination) in the direction of the input,
+// waiting for the scheduled results, until fn returns false or there are no more entries.
+func readEntries(ctx context.Context, s StorageWithApi, input EntriesInput, fn func(entry *EntryView) bool) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		out, err := entriesContext(ctx, s, &input)
+		if err != nil {
+			return err
+		}
+
+		entries := out.Entries
+		err = waitScheduled(ctx, s, out.TaskIds, func(result *Output) error {
+			entries = append(entries, result.Entries...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		next := false
+		for _, e := range entries {
+			if e.Epoch != input.EpochStart || e.Nanos != input.NanosStart {
+				next = true
+			}
+			input.EpochStart, input.NanosStart = e.Epoch, e.Nanos
+			if !fn(e) {
+				return nil
+			}
+		}
+		if !next {
+			return nil
+		}
+	}
+}
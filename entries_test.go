@@ -0,0 +1,164 @@
+package sqlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Entries_ID(t *testing.T) {
+	id := EntryID(1729000000, 123456789, []byte(`{"msg":"hello"}`))
+	assert.Regexp(t, `^1729000000\.123456789\.[0-9a-f]{8}$`, id)
+	assert.Equal(t, id, EntryID(1729000000, 123456789, []byte(`{"msg":"hello"}`)))
+	assert.NotEqual(t, id, EntryID(1729000000, 123456789, []byte(`{"msg":"world"}`)))
+
+	epoch, nanos, err := ParseEntryID(id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1729000000), epoch)
+	assert.Equal(t, 123456789, nanos)
+
+	for _, invalid := range []string{"", "1.2", "a.2.00000000", "1.b.00000000", "1.2.abc", "1.-2.00000000"} {
+		_, _, err = ParseEntryID(invalid)
+		assert.Equal(t, errEntryID, err, invalid)
+	}
+}
+
+func testEntryView(epoch int64, content string) *EntryView {
+	e, err := NewEntryView(epoch, 0, 0, []byte(content))
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+func Test_Entries_View(t *testing.T) {
+	e, err := NewEntryView(1729000000, 5, 4, []byte(`{"time":"2024-10-15T13:46:40Z","level":"WARN","msg":"hello","http":{"status":500}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, EntryID(1729000000, 5, e.Content), e.ID)
+	assert.Equal(t, int64(1729000000000000005), e.Time.UnixNano())
+	assert.Equal(t, slog.LevelWarn, e.Level)
+	assert.Equal(t, "hello", e.Message)
+	assert.Equal(t, map[string]any{"status": 500.0}, e.Attrs["http"])
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(MsgpackEncoder(buf, nil))
+	logger.Info("hello", "n", 1)
+
+	e, err = NewEntryView(1729000000, 0, 0, buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", e.Message)
+	assert.Equal(t, int64(1), e.Attrs["n"])
+
+	_, err = NewEntryView(1729000000, 0, 0, []byte("{"))
+	assert.NotNil(t, err)
+}
+
+func Test_Http_Entry(t *testing.T) {
+	entry := testEntryView(100, `{"msg":"hello"}`)
+	storage := &testMockApiStorage{
+		entries: func(i *EntriesInput) (*Output, error) {
+			return &Output{Entries: []*EntryView{entry}}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/entry?id="+entry.ID, nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	view := &EntryView{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(view))
+	assert.Equal(t, entry.ID, view.ID)
+	assert.Equal(t, "hello", view.Message)
+	assert.Equal(t, slog.LevelInfo, view.Level)
+	assert.Equal(t, entry.Time.UnixNano(), view.Time.UnixNano())
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/entry?id=100.0.00000000", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/entry?id=invalid", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func Test_Http_EntriesContext(t *testing.T) {
+	// 10 entries, epoch 100 to 109
+	var all []*EntryView
+	for i := range 10 {
+		all = append(all, testEntryView(int64(100+i), `{"msg":"`+string(rune('a'+i))+`"}`))
+	}
+
+	var exprs []string
+	storage := &testMockApiStorage{
+		entries: func(i *EntriesInput) (*Output, error) {
+			exprs = append(exprs, i.Expr)
+			var list []*EntryView
+			if i.Direction == "before" {
+				for j := len(all) - 1; j >= 0 && len(list) < i.MaxResult; j-- {
+					if all[j].Epoch < i.EpochStart {
+						list = append(list, all[j])
+					}
+				}
+			} else {
+				for j := 0; j < len(all) && len(list) < i.MaxResult; j++ {
+					if all[j].Epoch > i.EpochStart || (all[j].Epoch == i.EpochStart && all[j].Nanos > i.NanosStart) {
+						list = append(list, all[j])
+					}
+				}
+			}
+			return &Output{Entries: list}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	id := all[5].ID
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/entries/context?before=2&after=3&expr=host:web-1&id="+id, nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	out := &Output{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(out))
+
+	var msgs []string
+	for _, e := range out.Entries {
+		msgs = append(msgs, e.Message)
+	}
+	assert.Equal(t, []string{"d", "e", "f", "g", "h", "i"}, msgs)
+	assert.Equal(t, id, out.Entries[2].ID)
+	assert.Equal(t, "", exprs[0]) // the entry itself, ignoring the filter
+	assert.Equal(t, "host:web-1", exprs[len(exprs)-1])
+
+	// unknown hash
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/entries/context?id=105.0.00000000", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, res.Body.String(), errEntryNotFound.Error())
+
+	// permalink
+	req = httptest.NewRequest(http.MethodGet, "/logs/entry/"+id, nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), "<html")
+}
@@ -190,3 +190,20 @@ func NewExprBuilder[E any](factory ExprBuilderFactory[E]) func(expression string
 		return exp, nil
 	}
 }
+
+// exprValidator parses the expression without building it, used to reject invalid expressions early (see AlertRule)
+var exprValidator = NewExprBuilder(func(expression string) (ExprBuilder[struct{}], string) {
+	return exprNoop{}, expression
+})
+
+type exprNoop struct{}
+
+func (exprNoop) Build() struct{}                                      { return struct{}{} }
+func (exprNoop) GroupStart()                                          {}
+func (exprNoop) GroupEnd()                                            {}
+func (exprNoop) Operator(op string)                                   {}
+func (exprNoop) Text(field, term string, isSequence, isWildcard bool) {}
+func (exprNoop) Number(field, condition string, value float64)        {}
+func (exprNoop) Between(field string, x, y float64)                   {}
+func (exprNoop) TextIn(field string, values []string)                 {}
+func (exprNoop) NumberIn(field string, values []float64)              {}
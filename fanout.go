@@ -0,0 +1,206 @@
+package sqlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrFanoutQueueFull is reported when a record is dropped because the fanout queue is full
+var ErrFanoutQueueFull = errors.New("[sqlog] fanout queue is full, record dropped")
+
+// DropPolicy defines what happens when the queue of an asynchronous fanout handler is full
+type DropPolicy int8
+
+const (
+	DropNewest DropPolicy = iota // Discards the record being logged
+	DropOldest                   // Discards the oldest record in the queue
+	Block                        // Waits for space in the queue
+)
+
+// FanoutConfig configures how a fanout handler receives the log records
+type FanoutConfig struct {
+	// Redact applies HandlerConfig.Redaction to the records sent to this handler
+	Redact bool
+
+	// QueueSize enables asynchronous delivery, the records are sent to this handler
+	// by its own worker through a bounded queue.
+	// (Default: 0, records are delivered inline).
+	QueueSize int
+
+	// DropPolicy defines what happens when the queue is full (Default: DropNewest).
+	DropPolicy DropPolicy
+
+	// OnError receives the errors (and panics) of this handler and
+	// ErrFanoutQueueFull for each dropped record.
+	OnError func(err error)
+}
+
+// fanoutHandler a slog.Handler with its fanout configuration
+type fanoutHandler struct {
+	handler slog.Handler
+	config  *FanoutConfig
+	queue   *fanoutQueue // Shared by all handlers derived from this one (WithAttrs, WithGroup)
+	root    slog.Handler // Handler registered on Log.Fanout, before the calls of the chain
+	chain   handlerChain // WithAttrs and WithGroup calls since the registration
+}
+
+// NewFanout configures a handler individually, to be used with Log.Fanout.
+// A nil config uses the defaults from HandlerConfig.
+func NewFanout(handler slog.Handler, config *FanoutConfig) slog.Handler {
+	return &fanoutHandler{handler: handler, config: config, root: handler}
+}
+
+func (f *fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return f.handler.Enabled(ctx, l)
+}
+
+// Handle delivers the record inline or through the queue, never returning the handler error.
+// Errors are reported to FanoutConfig.OnError.
+func (f *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	if f.queue != nil {
+		f.queue.push(&fanoutJob{handler: f.handler, ctx: context.WithoutCancel(ctx), record: record})
+	} else {
+		f.report(safeHandle(f.handler, ctx, record))
+	}
+	return nil
+}
+
+func (f *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &fanoutHandler{
+		handler: f.handler.WithAttrs(attrs),
+		config:  f.config,
+		queue:   f.queue,
+		root:    f.root,
+		chain:   f.chain.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) }),
+	}
+}
+
+func (f *fanoutHandler) WithGroup(name string) slog.Handler {
+	return &fanoutHandler{
+		handler: f.handler.WithGroup(name),
+		config:  f.config,
+		queue:   f.queue,
+		root:    f.root,
+		chain:   f.chain.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) }),
+	}
+}
+
+// withTopAttrs returns the handler with the attributes at the top level, outside the groups of the chain
+func (f *fanoutHandler) withTopAttrs(attrs []slog.Attr) *fanoutHandler {
+	if f.root == nil {
+		return f.WithAttrs(attrs).(*fanoutHandler)
+	}
+	return &fanoutHandler{
+		handler: f.chain.build(f.root, attrs),
+		config:  f.config,
+		queue:   f.queue,
+		root:    f.root,
+		chain:   f.chain,
+	}
+}
+
+func (f *fanoutHandler) report(err error) {
+	if err != nil && f.config != nil && f.config.OnError != nil {
+		f.config.OnError(err)
+	}
+}
+
+type fanoutJob struct {
+	handler slog.Handler
+	ctx     context.Context
+	record  slog.Record
+}
+
+// fanoutQueue bounded queue with a single worker delivering records to a fanout handler
+type fanoutQueue struct {
+	mu      sync.RWMutex // (closed) only, prevents sending on a closed channel
+	closed  bool
+	jobs    chan *fanoutJob
+	done    chan struct{}
+	dropped atomic.Int64
+	policy  DropPolicy
+	report  func(err error)
+}
+
+func newFanoutQueue(config *FanoutConfig, report func(err error)) *fanoutQueue {
+	q := &fanoutQueue{
+		jobs:   make(chan *fanoutJob, config.QueueSize),
+		done:   make(chan struct{}),
+		policy: config.DropPolicy,
+		report: report,
+	}
+	go q.work()
+	return q
+}
+
+// push adds the job to the queue, applying the drop policy if it's full
+func (q *fanoutQueue) push(job *fanoutJob) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return
+	}
+
+	switch q.policy {
+	case Block:
+		q.jobs <- job
+	case DropOldest:
+		for {
+			select {
+			case q.jobs <- job:
+				return
+			default:
+			}
+			select {
+			case <-q.jobs:
+				q.drop()
+			default:
+			}
+		}
+	default:
+		select {
+		case q.jobs <- job:
+		default:
+			q.drop()
+		}
+	}
+}
+
+func (q *fanoutQueue) drop() {
+	q.dropped.Add(1)
+	q.report(ErrFanoutQueueFull)
+}
+
+// work delivers the queued records until the queue is closed
+func (q *fanoutQueue) work() {
+	defer close(q.done)
+	for job := range q.jobs {
+		q.report(safeHandle(job.handler, job.ctx, job.record))
+	}
+}
+
+// close stops accepting records and waits for the queued ones to be delivered
+func (q *fanoutQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+// safeHandle isolates the caller from panics in the handler
+func safeHandle(h slog.Handler, ctx context.Context, record slog.Record) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("[sqlog] fanout handler panic: %v", rec)
+		}
+	}()
+	return h.Handle(ctx, record)
+}
@@ -0,0 +1,142 @@
+package sqlog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testMockHandler slog.Handler that counts the records
+type testMockHandler struct {
+	handle func(record slog.Record) error
+}
+
+func (m *testMockHandler) Enabled(ctx context.Context, l slog.Level) bool { return true }
+func (m *testMockHandler) WithAttrs(attrs []slog.Attr) slog.Handler       { return m }
+func (m *testMockHandler) WithGroup(name string) slog.Handler             { return m }
+func (m *testMockHandler) Handle(ctx context.Context, record slog.Record) error {
+	return m.handle(record)
+}
+
+func Test_Fanout_Async(t *testing.T) {
+	var (
+		handled atomic.Int32
+		release = make(chan struct{})
+	)
+
+	handler := newHandler(&testMockIngester{}, nil)
+	handler.fanout(NewFanout(&testMockHandler{handle: func(record slog.Record) error {
+		<-release // slow handler
+		handled.Add(1)
+		return nil
+	}}, &FanoutConfig{QueueSize: 10}))
+
+	logger := slog.New(handler).With(slog.String("attr", "value"))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		logger.Info("test message")
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, int32(0), handled.Load())
+
+	close(release)
+	handler.close()
+	assert.Equal(t, int32(5), handled.Load())
+}
+
+func Test_Fanout_DropPolicy(t *testing.T) {
+	for _, policy := range []DropPolicy{DropNewest, DropOldest} {
+		var (
+			dropped  atomic.Int32
+			messages []string
+			release  = make(chan struct{})
+		)
+
+		handler := newHandler(&testMockIngester{}, nil)
+		handler.fanout(NewFanout(&testMockHandler{handle: func(record slog.Record) error {
+			<-release
+			messages = append(messages, record.Message)
+			return nil
+		}}, &FanoutConfig{
+			QueueSize:  2,
+			DropPolicy: policy,
+			OnError: func(err error) {
+				if errors.Is(err, ErrFanoutQueueFull) {
+					dropped.Add(1)
+				}
+			},
+		}))
+
+		logger := slog.New(handler)
+		logger.Info("first") // taken by the worker
+		waitMax(time.Second, func() bool { return len(handler.fanouts()[0].queue.jobs) == 0 })
+		for _, msg := range []string{"a", "b", "c", "d"} {
+			logger.Info(msg)
+		}
+
+		close(release)
+		handler.close()
+
+		assert.Equal(t, int32(2), dropped.Load())
+		if policy == DropNewest {
+			assert.Equal(t, []string{"first", "a", "b"}, messages)
+		} else {
+			assert.Equal(t, []string{"first", "c", "d"}, messages)
+		}
+	}
+}
+
+func Test_Fanout_Errors(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		errs   []error
+		config = &FanoutConfig{OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}}
+	)
+
+	handler := newHandler(&testMockIngester{}, nil)
+	handler.fanout(
+		NewFanout(&testMockHandler{handle: func(record slog.Record) error {
+			return errors.New("handler error")
+		}}, config),
+		NewFanout(&testMockHandler{handle: func(record slog.Record) error {
+			panic("handler panic")
+		}}, config),
+	)
+
+	logger := slog.New(handler)
+	assert.NotPanics(t, func() {
+		logger.Info("test message")
+	})
+	assert.Equal(t, 2, len(errs))
+}
+
+func Test_Fanout_Concurrent(t *testing.T) {
+	handler := newHandler(&testMockIngester{}, nil)
+	logger := slog.New(handler)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			handler.fanout(&testMockHandler{handle: func(record slog.Record) error { return nil }})
+		}()
+		go func() {
+			defer wg.Done()
+			logger.Info("test message")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, len(handler.fanouts()))
+}
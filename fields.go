@@ -0,0 +1,167 @@
+package sqlog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Field types
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldBool   = "bool"
+	FieldObject = "object"
+)
+
+type FieldsInput struct {
+	Expr       string   `json:"expr"`
+	Level      []string `json:"level"`       // ["debug","info","warn","error"]
+	EpochStart int64    `json:"epoch_start"` // (Default: EpochEnd - 1 hour)
+	EpochEnd   int64    `json:"epoch"`       // (Default: now)
+	MaxResult  int      `json:"limit"`       // Number of entries sampled on each database (Default: 1000)
+	Source     string   `json:"source"`      // Label of the attached source, empty for the live storage
+	Streams    []string `json:"streams"`     // Names of the streams (Default: all)
+}
+
+// Validate checks the input and sets the default values
+func (i *FieldsInput) Validate() error {
+	if i.EpochEnd <= 0 {
+		i.EpochEnd = time.Now().Unix()
+	}
+	if i.EpochStart <= 0 || i.EpochStart >= i.EpochEnd {
+		i.EpochStart = i.EpochEnd - 3600
+	}
+	if i.MaxResult <= 0 {
+		i.MaxResult = 1000
+	}
+	return nil
+}
+
+// Field is an attribute seen in the sampled entries
+type Field struct {
+	Name  string `json:"name"`  // Ex. "http.route"
+	Type  string `json:"type"`  // string, number, bool or object
+	Count int64  `json:"count"` // Number of sampled entries with the attribute
+}
+
+// MergeFields merges the fields (same name and type) of src into dst, sorted by name
+func MergeFields(dst []*Field, src []*Field) []*Field {
+	index := make(map[string]*Field, len(dst))
+	for _, f := range dst {
+		index[f.Name+"|"+f.Type] = f
+	}
+	for _, f := range src {
+		if o, exists := index[f.Name+"|"+f.Type]; exists {
+			o.Count += f.Count
+		} else {
+			index[f.Name+"|"+f.Type] = f
+			dst = append(dst, f)
+		}
+	}
+	slices.SortStableFunc(dst, func(a, b *Field) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type, b.Type)
+	})
+	return dst
+}
+
+type FacetsInput struct {
+	Expr       string   `json:"expr"`
+	Level      []string `json:"level"`       // ["debug","info","warn","error"]
+	EpochStart int64    `json:"epoch_start"` // (Default: EpochEnd - 1 hour)
+	EpochEnd   int64    `json:"epoch"`       // (Default: now)
+	Field      string   `json:"field"`       // Ex. "http.route"
+	MaxResult  int      `json:"limit"`       // Top N values (Default: 10)
+	Source     string   `json:"source"`      // Label of the attached source, empty for the live storage
+	Streams    []string `json:"streams"`     // Names of the streams (Default: all)
+}
+
+// facetsMaxValues is the number of values counted on each database, the values with more entries
+const facetsMaxValues = 1000
+
+// Facet is a value of the field and the number of entries with that value
+type Facet struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// Fields returns the attributes seen in the matching window, waiting for the scheduled results (up to 30 seconds)
+func (l *sqlog) Fields(input *FieldsInput) ([]*Field, error) {
+	s, ok := l.storage.(StorageWithApi)
+	if !ok {
+		return []*Field{}, nil
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	out, err := s.Fields(input)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := MergeFields([]*Field{}, out.Fields)
+	if out.Scheduled {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err = waitScheduled(ctx, s, out.TaskIds, func(result *Output) error {
+			fields = MergeFields(fields, result.Fields)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// Facets returns the top values of the field with their counts (see Aggregate).
+// The values are counted with GROUP BY, only the facetsMaxValues values with more entries of each database are merged.
+func (l *sqlog) Facets(input *FacetsInput) ([]*Facet, error) {
+	if input.Field == "" {
+		return nil, fmt.Errorf("[sqlog] field is required")
+	}
+	if input.MaxResult <= 0 {
+		input.MaxResult = 10
+	}
+
+	out, err := l.Aggregate(&AggregateInput{
+		Expr:       input.Expr,
+		Level:      input.Level,
+		EpochStart: input.EpochStart,
+		EpochEnd:   input.EpochEnd,
+		GroupBy:    []string{input.Field},
+		Top:        facetsMaxValues,
+		MaxResult:  math.MaxInt32, // bounded by Top on each database, the top values are selected below
+		Source:     input.Source,
+		Streams:    input.Streams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	facets := []*Facet{}
+	for _, row := range out.Aggregate {
+		if len(row.Groups) == 0 || row.Groups[0] == nil || len(row.Values) == 0 {
+			continue
+		}
+		count, _ := row.Values[0].(int64)
+		facets = append(facets, &Facet{Value: row.Groups[0], Count: count})
+	}
+
+	slices.SortStableFunc(facets, func(a, b *Facet) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	if len(facets) > input.MaxResult {
+		facets = facets[:input.MaxResult]
+	}
+	return facets, nil
+}
@@ -0,0 +1,75 @@
+package sqlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fields_Scheduled(t *testing.T) {
+	storage := &testMockApiStorage{
+		fields: func(i *FieldsInput) (*Output, error) {
+			return &Output{
+				Fields:    []*Field{{Name: "msg", Type: FieldString, Count: 10}, {Name: "route", Type: FieldString, Count: 4}},
+				Scheduled: true,
+				TaskIds:   []int32{1},
+			}, nil
+		},
+		results: map[int32]*Output{
+			1: {Fields: []*Field{{Name: "duration", Type: FieldNumber, Count: 2}, {Name: "msg", Type: FieldString, Count: 5}}},
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	fields, err := log.Fields(&FieldsInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Field{
+		{Name: "duration", Type: FieldNumber, Count: 2},
+		{Name: "msg", Type: FieldString, Count: 15},
+		{Name: "route", Type: FieldString, Count: 4},
+	}, fields)
+}
+
+func Test_Http_Facets(t *testing.T) {
+	var input *AggregateInput
+	storage := &testMockApiStorage{
+		aggregate: func(i *AggregateInput) (*Output, error) {
+			input = i
+			return &Output{Aggregate: FinalizeAggregateRows(i, []*AggregateRow{
+				{Groups: []any{nil}, Partials: []*AggregatePartial{{Count: 50}}},
+				{Groups: []any{"/a"}, Partials: []*AggregatePartial{{Count: 5}}},
+				{Groups: []any{"/b"}, Partials: []*AggregatePartial{{Count: 9}}},
+				{Groups: []any{"/c"}, Partials: []*AggregatePartial{{Count: 7}}},
+			})}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/facets?field=route&limit=2&expr=service:api", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "service:api", input.Expr)
+	assert.Equal(t, []string{"route"}, input.GroupBy)
+	assert.Equal(t, facetsMaxValues, input.Top)
+
+	var facets []*Facet
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&facets))
+	assert.Equal(t, []*Facet{{Value: "/b", Count: 9}, {Value: "/c", Count: 7}}, facets)
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/facets", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
@@ -5,7 +5,11 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const bbcap = 1 << 16 // 65536
@@ -13,8 +17,17 @@ const bbcap = 1 << 16 // 65536
 type Encoder func(w io.Writer, opts *slog.HandlerOptions) slog.Handler
 
 type HandlerConfig struct {
-	Encoder Encoder // The slog.Handler used for JSON encoding
-	Options *slog.HandlerOptions
+	Encoder   Encoder // The slog.Handler used for encoding (default JSON, see MsgpackEncoder)
+	Options   *slog.HandlerOptions
+	Levels    *LevelRegistry   // Runtime level control (default created from Options.Level)
+	Sampling  *SamplingConfig  // Sampling and rate limiting of log records (default disabled)
+	Redaction *RedactionConfig // Removal of sensitive data from log records (default disabled)
+	Fanout    *FanoutConfig    // Default config of fanout handlers not configured with NewFanout
+	Errors    *ErrorsConfig    // Enrichment of error attributes, chain and stack trace (default disabled)
+
+	// ContextExtractors pull attributes from the context.Context (trace_id, span_id, request_id, ...)
+	// and append them to every record. See SpanContextExtractor and ContextValueExtractor.
+	ContextExtractors []ContextExtractor
 }
 
 // Handles the logic for writing logs
@@ -24,11 +37,18 @@ type writer struct {
 }
 
 type handler struct {
-	mu       sync.Mutex
+	mu       sync.Mutex // (fanout) only
 	writers  sync.Pool
 	ingester Ingester
 	config   *HandlerConfig
-	handlers []slog.Handler // Fanout handlers
+	sampler  *sampler
+	redactor *redactor
+	levels   *LevelRegistry
+	chain    handlerChain                     // WithAttrs and WithGroup calls of the encoder (see contextAttrs)
+	groups   []string                         // Groups opened by WithGroup
+	group    string                           // Groups joined by "." (Ex. "http.client")
+	stream   string                           // Stream of the records, empty for the default (see WithStream)
+	handlers atomic.Pointer[[]*fanoutHandler] // Fanout handlers (copy on write)
 }
 
 // Creates a new handler with the given ingester and configuration
@@ -52,9 +72,18 @@ func newHandler(ingester Ingester, config *HandlerConfig) *handler {
 		}
 	}
 
+	if config.Levels == nil {
+		config.Levels = NewLevelRegistry(config.Options.Level)
+	}
+
+	initErrorsConfig(config.Errors)
+
 	h := &handler{
 		config:   config,
 		ingester: ingester,
+		sampler:  newSampler(config.Sampling),
+		redactor: newRedactor(config.Redaction),
+		levels:   config.Levels,
 	}
 
 	encoder := config.Encoder
@@ -72,33 +101,148 @@ func newHandler(ingester Ingester, config *HandlerConfig) *handler {
 func (h *handler) fanout(handlers ...slog.Handler) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.handlers = append(h.handlers, handlers...)
+
+	list := slices.Clone(h.fanouts())
+	for _, h2 := range handlers {
+		f, ok := h2.(*fanoutHandler)
+		if !ok {
+			f = &fanoutHandler{handler: h2}
+		}
+
+		config := f.config
+		if config == nil {
+			config = &FanoutConfig{}
+			if h.config.Fanout != nil {
+				*config = *h.config.Fanout
+			}
+			config.Redact = config.Redact || (h.config.Redaction != nil && h.config.Redaction.Fanout)
+		}
+
+		f = &fanoutHandler{handler: f.handler, config: config, root: f.handler}
+		if config.QueueSize > 0 {
+			f.queue = newFanoutQueue(config, f.report)
+		}
+		list = append(list, f)
+	}
+	h.handlers.Store(&list)
+}
+
+// fanouts returns the current fanout handlers
+func (h *handler) fanouts() []*fanoutHandler {
+	if list := h.handlers.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+// close waits for the asynchronous fanout handlers to deliver the queued records
+func (h *handler) close() {
+	for _, h2 := range h.fanouts() {
+		if h2.queue != nil {
+			h2.queue.close()
+		}
+	}
 }
 
 // Processes a log record, encoding it and sending it to the ingester
 func (h *handler) Handle(ctx context.Context, record slog.Record) error {
 
+	// The level is checked first, records that nobody accepts don't use the sampling counters or rate tokens
+	self := h.enabledSelf(record.Level) && h.levels.enabledFor(h.group, record)
+	if !self && !h.fanoutEnabled(ctx, record.Level) {
+		return nil
+	}
+
+	// Sampling is done before encoding, discarded records cost nothing else.
+	// With FanoutFullFidelity, only the records ingested by this handler are sampled.
+	keep := true
+	if h.sampler != nil && (self || !h.config.Sampling.FanoutFullFidelity) {
+		keep = h.sampler.sample(record)
+		if keep {
+			record = h.sampler.attach(record)
+		}
+	}
+
+	// Unwraps the errors and captures the stack trace at the call site
+	var stack []slog.Attr
+	if h.config.Errors != nil && (keep || h.config.Sampling.FanoutFullFidelity) {
+		record, stack = h.enrichErrors(record)
+	}
+
+	// Attributes extracted from the context and the stack trace, always at the top level. Inside groups, they are
+	// added to the root handlers before the groups (see handlerChain).
+	var ctxAttrs, ctxAttrsRedacted []slog.Attr
+	if len(h.config.ContextExtractors) > 0 && ctx != nil && (keep || h.config.Sampling.FanoutFullFidelity) {
+		ctxAttrs = h.contextAttrs(ctx)
+	}
+	ctxAttrs = append(ctxAttrs, stack...)
+	if len(ctxAttrs) > 0 && len(h.groups) == 0 {
+		record = record.Clone()
+		record.AddAttrs(ctxAttrs...)
+		ctxAttrs = nil
+	} else if len(ctxAttrs) > 0 && h.redactor != nil {
+		ctxAttrsRedacted = h.redactor.attrs(nil, ctxAttrs)
+	}
+
+	// Redaction is done only once, and only if someone needs it
+	var (
+		redacted     slog.Record
+		redactedDone bool
+	)
+	redact := func() slog.Record {
+		if !redactedDone {
+			redacted = h.redactor.record(h.groups, record)
+			redactedDone = true
+		}
+		return redacted
+	}
+
 	// Sends the log record to fanout handlers
-	for _, h2 := range h.handlers {
-		if h2.Enabled(ctx, record.Level) {
-			h2.Handle(ctx, record.Clone())
+	if keep || h.config.Sampling.FanoutFullFidelity {
+		for _, h2 := range h.fanouts() {
+			if h2.Enabled(ctx, record.Level) {
+				if h2.config.Redact && h.redactor != nil {
+					if len(ctxAttrs) > 0 {
+						h2 = h2.withTopAttrs(ctxAttrsRedacted)
+					}
+					h2.Handle(ctx, redact().Clone())
+				} else {
+					if len(ctxAttrs) > 0 {
+						h2 = h2.withTopAttrs(ctxAttrs)
+					}
+					h2.Handle(ctx, record.Clone())
+				}
+			}
 		}
 	}
 
 	// Processes the log if it's enabled for this handler
-	if h.enabledSelf(record.Level) {
+	if keep && self {
 		w := h.writers.Get().(*writer)
 		w.buffer.Reset()
 
+		if h.redactor != nil {
+			record = redact()
+		}
+
+		encoder := w.encoder
+		if len(ctxAttrs) > 0 {
+			attrs := ctxAttrs
+			if h.redactor != nil {
+				attrs = ctxAttrsRedacted
+			}
+			encoder = h.chain.build(h.config.Encoder(w.buffer, h.config.Options), attrs)
+		}
+
 		// Ensures the log time is in UTC
 		record.Time = record.Time.UTC()
-		if err := w.encoder.Handle(ctx, record); err != nil {
+		if err := encoder.Handle(ctx, record); err != nil {
 			return err
 		}
 
 		// Ingests the log if there is data to write
 		if w.buffer.Len() > 0 {
-			if err := h.ingester.Ingest(record.Time, int8(record.Level), bytes.Clone(w.buffer.Bytes())); err != nil {
+			if err := h.ingest(record.Time, int8(record.Level), bytes.Clone(w.buffer.Bytes())); err != nil {
 				return err
 			}
 		}
@@ -112,13 +256,20 @@ func (h *handler) Handle(ctx context.Context, record slog.Record) error {
 	return nil
 }
 
+// ingest sends the encoded record to the ingester, on the stream of this handler (see StreamIngester)
+func (h *handler) ingest(t time.Time, level int8, content []byte) error {
+	if h.stream != "" {
+		if ingester, ok := h.ingester.(StreamIngester); ok {
+			return ingester.IngestStream(h.stream, t, level, content)
+		}
+	}
+	return h.ingester.Ingest(t, level, content)
+}
+
 // enabledSelf checks if the log level is greater than or equal to the minimum level
+// of any logger group or source package (see LevelRegistry)
 func (h *handler) enabledSelf(l slog.Level) bool {
-	minLevel := slog.LevelInfo
-	if h.config.Options.Level != nil {
-		minLevel = h.config.Options.Level.Level()
-	}
-	return l >= minLevel
+	return h.levels.enabled(l)
 }
 
 // Enabled checks whether the log level meets the minimum requirement
@@ -128,12 +279,16 @@ func (h *handler) Enabled(ctx context.Context, l slog.Level) bool {
 	}
 
 	// Also check if any fanout handler is enabled
-	for _, h2 := range h.handlers {
+	return h.fanoutEnabled(ctx, l)
+}
+
+// fanoutEnabled checks if any fanout handler is enabled for the level
+func (h *handler) fanoutEnabled(ctx context.Context, l slog.Level) bool {
+	for _, h2 := range h.fanouts() {
 		if h2.Enabled(ctx, l) {
 			return true
 		}
 	}
-
 	return false
 }
 
@@ -142,18 +297,37 @@ func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	o := &handler{
 		config:   h.config,
 		ingester: h.ingester,
+		sampler:  h.sampler,
+		redactor: h.redactor,
+		levels:   h.levels,
+		groups:   h.groups,
+		group:    h.group,
+		stream:   h.stream,
+	}
+
+	redacted := attrs
+	if h.redactor != nil {
+		redacted = h.redactor.attrs(h.groups, attrs)
 	}
+	o.chain = h.chain.with(func(e slog.Handler) slog.Handler { return e.WithAttrs(redacted) })
+
 	parentPool := &h.writers
 	o.writers.New = func() any {
 		w := parentPool.Get().(*writer)
-		w.encoder = w.encoder.WithAttrs(attrs)
+		w.encoder = w.encoder.WithAttrs(redacted)
 		return w
 	}
 
 	// Propagates attributes to fanout handlers
-	for _, h2 := range h.handlers {
-		o.handlers = append(o.handlers, h2.WithAttrs(attrs))
+	var handlers []*fanoutHandler
+	for _, h2 := range h.fanouts() {
+		if h2.config.Redact {
+			handlers = append(handlers, h2.WithAttrs(redacted).(*fanoutHandler))
+		} else {
+			handlers = append(handlers, h2.WithAttrs(attrs).(*fanoutHandler))
+		}
 	}
+	o.handlers.Store(&handlers)
 	return o
 }
 
@@ -162,7 +336,14 @@ func (h *handler) WithGroup(name string) slog.Handler {
 	o := &handler{
 		config:   h.config,
 		ingester: h.ingester,
+		sampler:  h.sampler,
+		redactor: h.redactor,
+		levels:   h.levels,
+		groups:   append(slices.Clip(h.groups), name),
+		stream:   h.stream,
 	}
+	o.group = strings.Join(o.groups, ".")
+	o.chain = h.chain.with(func(e slog.Handler) slog.Handler { return e.WithGroup(name) })
 	parentPool := &h.writers
 	o.writers.New = func() any {
 		w := parentPool.Get().(*writer)
@@ -171,8 +352,32 @@ func (h *handler) WithGroup(name string) slog.Handler {
 	}
 
 	// Propagates the group to fanout handlers
-	for _, h2 := range h.handlers {
-		o.handlers = append(o.handlers, h2.WithGroup(name))
+	var handlers []*fanoutHandler
+	for _, h2 := range h.fanouts() {
+		handlers = append(handlers, h2.WithGroup(name).(*fanoutHandler))
+	}
+	o.handlers.Store(&handlers)
+	return o
+}
+
+// WithStream returns a new Handler whose records are routed to the stream, a partition of the storage with its
+// own retention and size limits. The attributes and groups of this handler are kept.
+func (h *handler) WithStream(name string) slog.Handler {
+	o := &handler{
+		config:   h.config,
+		ingester: h.ingester,
+		sampler:  h.sampler,
+		redactor: h.redactor,
+		levels:   h.levels,
+		chain:    h.chain,
+		groups:   h.groups,
+		group:    h.group,
+		stream:   name,
+	}
+	parentPool := &h.writers
+	o.writers.New = func() any {
+		return parentPool.Get()
 	}
+	o.handlers.Store(h.handlers.Load())
 	return o
 }
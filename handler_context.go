@@ -0,0 +1,105 @@
+package sqlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// ContextExtractor returns attributes from the context that are appended to every record.
+// Ex. trace_id, span_id, request_id, tenant
+type ContextExtractor func(ctx context.Context) []slog.Attr
+
+// SpanContext is the minimal view of an OpenTelemetry-style span context.
+// Allows correlating logs and traces without depending on the OpenTelemetry SDK.
+type SpanContext interface {
+	TraceID() string
+	SpanID() string
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx with the span context, used by SpanContextExtractor
+func ContextWithSpan(ctx context.Context, span SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanContextFromContext returns the span context stored by ContextWithSpan
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	span, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return span
+}
+
+// SpanContextExtractor appends trace_id and span_id from the span context stored by ContextWithSpan
+var SpanContextExtractor = NewSpanContextExtractor(SpanContextFromContext)
+
+// NewSpanContextExtractor creates an extractor that appends trace_id and span_id
+// from the span context returned by lookup. Useful to adapt tracing libraries, Ex.
+//
+//	sqlog.NewSpanContextExtractor(func(ctx context.Context) sqlog.SpanContext {
+//		return otelSpan(trace.SpanContextFromContext(ctx))
+//	})
+func NewSpanContextExtractor(lookup func(ctx context.Context) SpanContext) ContextExtractor {
+	return func(ctx context.Context) []slog.Attr {
+		span := lookup(ctx)
+		if span == nil {
+			return nil
+		}
+		var attrs []slog.Attr
+		if traceId := span.TraceID(); traceId != "" {
+			attrs = append(attrs, slog.String("trace_id", traceId))
+		}
+		if spanId := span.SpanID(); spanId != "" {
+			attrs = append(attrs, slog.String("span_id", spanId))
+		}
+		return attrs
+	}
+}
+
+// ContextValueExtractor creates an extractor that appends the value stored in the context
+// under key as the attribute name. Ex. ContextValueExtractor("request_id", requestIdKey{})
+func ContextValueExtractor(name string, key any) ContextExtractor {
+	return func(ctx context.Context) []slog.Attr {
+		switch v := ctx.Value(key).(type) {
+		case nil:
+			return nil
+		case string:
+			if v == "" {
+				return nil
+			}
+			return []slog.Attr{slog.String(name, v)}
+		case fmt.Stringer:
+			return []slog.Attr{slog.String(name, v.String())}
+		default:
+			return []slog.Attr{slog.Any(name, v)}
+		}
+	}
+}
+
+// contextAttrs returns the attributes extracted from the context
+func (h *handler) contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	for _, extract := range h.config.ContextExtractors {
+		attrs = append(attrs, extract(ctx)...)
+	}
+	return attrs
+}
+
+// handlerChain is the sequence of WithAttrs and WithGroup calls of a handler. Replayed over the root handler, it
+// allows adding the context attributes at the top level of the record after groups were opened (see WithGroup).
+type handlerChain []func(slog.Handler) slog.Handler
+
+// with returns a copy of the chain with the call
+func (c handlerChain) with(f func(slog.Handler) slog.Handler) handlerChain {
+	return append(slices.Clip(c), f)
+}
+
+// build applies the top level attributes to the root handler, followed by the calls of the chain
+func (c handlerChain) build(root slog.Handler, attrs []slog.Attr) slog.Handler {
+	h := root.WithAttrs(attrs)
+	for _, f := range c {
+		h = f(h)
+	}
+	return h
+}
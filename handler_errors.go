@@ -0,0 +1,165 @@
+package sqlog
+
+import (
+	"errors"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ErrorsConfig configures the enrichment of error attributes
+type ErrorsConfig struct {
+	// StackLevel is the minimum level of the records whose stack trace is captured
+	// in the "error.stack" attribute. (Default: slog.LevelError).
+	StackLevel slog.Leveler
+
+	// StackDepth is the maximum number of frames captured. (Default: 32).
+	StackDepth int
+}
+
+func initErrorsConfig(config *ErrorsConfig) {
+	if config == nil {
+		return
+	}
+	if config.StackLevel == nil {
+		config.StackLevel = slog.LevelError
+	}
+	if config.StackDepth <= 0 {
+		config.StackDepth = 32
+	}
+}
+
+// enrichErrors adds the "<key>.chain" attribute for wrapped/joined errors, and returns the "error.stack" attribute
+// with the stack trace of the call site, added by the handler at the top level of the record (see handlerChain).
+// Must be called on the goroutine that created the record.
+func (h *handler) enrichErrors(record slog.Record) (slog.Record, []slog.Attr) {
+	config := h.config.Errors
+
+	var (
+		attrs    []slog.Attr
+		modified bool
+		stack    []slog.Attr
+	)
+	record.Attrs(func(a slog.Attr) bool {
+		var changed bool
+		attrs, changed = appendErrorAttr(attrs, a)
+		modified = modified || changed
+		return true
+	})
+
+	if record.Level >= config.StackLevel.Level() && record.PC != 0 {
+		stack = []slog.Attr{slog.String("error.stack", captureStack(record.PC, config.StackDepth))}
+	}
+
+	if !modified {
+		return record, stack
+	}
+
+	o := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	o.AddAttrs(attrs...)
+	return o, stack
+}
+
+// appendErrorAttr appends the attribute and its chain (if it's an error with more than one cause)
+func appendErrorAttr(attrs []slog.Attr, a slog.Attr) ([]slog.Attr, bool) {
+	a.Value = a.Value.Resolve()
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		var (
+			group    []slog.Attr
+			modified bool
+		)
+		for _, sub := range a.Value.Group() {
+			var changed bool
+			group, changed = appendErrorAttr(group, sub)
+			modified = modified || changed
+		}
+		if modified {
+			a.Value = slog.GroupValue(group...)
+		}
+		return append(attrs, a), modified
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && err != nil {
+			attrs = append(attrs, a)
+			if chain := errorChain(err, nil); len(chain) > 1 {
+				return append(attrs, slog.Any(a.Key+".chain", chain)), true
+			}
+			return attrs, false
+		}
+	}
+	return append(attrs, a), false
+}
+
+// errorChain unwraps errors.Join and %w chains (depth-first) into a list of messages
+func errorChain(err error, chain []string) []string {
+	if err == nil || len(chain) >= 100 {
+		return chain
+	}
+
+	if multi, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := multi.Unwrap()
+		if !isJoined(err, errs) {
+			chain = append(chain, err.Error())
+		}
+		for _, e := range errs {
+			chain = errorChain(e, chain)
+		}
+		return chain
+	}
+
+	chain = append(chain, err.Error())
+	return errorChain(errors.Unwrap(err), chain)
+}
+
+// isJoined checks if the error message is just the concatenation of its children (errors.Join)
+func isJoined(err error, errs []error) bool {
+	var msgs []string
+	for _, e := range errs {
+		if e != nil {
+			msgs = append(msgs, e.Error())
+		}
+	}
+	return err.Error() == strings.Join(msgs, "\n")
+}
+
+// captureStack formats the stack trace starting at the pc where the record was created
+func captureStack(pc uintptr, depth int) string {
+	pcs := make([]uintptr, depth+32)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+
+	start := -1
+	for i, p := range pcs {
+		if p == pc {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		// the record was created in another goroutine, only the call site is known
+		pcs = []uintptr{pc}
+	} else {
+		pcs = pcs[start:min(len(pcs), start+depth)]
+	}
+
+	var (
+		sb     strings.Builder
+		frames = runtime.CallersFrames(pcs)
+	)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			sb.WriteString(frame.Function)
+			sb.WriteString("\n\t")
+			sb.WriteString(frame.File)
+			sb.WriteByte(':')
+			sb.WriteString(strconv.Itoa(frame.Line))
+			sb.WriteByte('\n')
+		}
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
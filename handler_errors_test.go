@@ -0,0 +1,61 @@
+package sqlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Handler_Errors(t *testing.T) {
+	var ingested map[string]any
+
+	logger := slog.New(newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = map[string]any{}
+			return json.Unmarshal(data, &ingested)
+		},
+	}, &HandlerConfig{Errors: &ErrorsConfig{}}))
+
+	errNotFound := errors.New("not found")
+	errTimeout := errors.New("timeout")
+	err := fmt.Errorf("load user: %w", errors.Join(errNotFound, errTimeout))
+
+	logger.Warn("warn message", slog.Any("error", err))
+	assert.Equal(t, "load user: not found\ntimeout", ingested["error"])
+	assert.Equal(t, []any{"load user: not found\ntimeout", "not found", "timeout"}, ingested["error.chain"])
+	assert.Nil(t, ingested["error.stack"])
+
+	logger.Error("error message", slog.Any("error", errNotFound))
+	assert.Equal(t, "not found", ingested["error"])
+	assert.Nil(t, ingested["error.chain"])
+
+	stack, _ := ingested["error.stack"].(string)
+	assert.True(t, strings.HasPrefix(stack, "github.com/nidorx/sqlog.Test_Handler_Errors\n"), stack)
+	assert.Contains(t, stack, "handler_errors_test.go:")
+}
+
+func Test_Handler_Errors_Group(t *testing.T) {
+	var ingested map[string]any
+
+	logger := slog.New(newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = map[string]any{}
+			return json.Unmarshal(data, &ingested)
+		},
+	}, &HandlerConfig{Errors: &ErrorsConfig{}}))
+
+	// the stack trace is at the top level, the error inside the group
+	logger.WithGroup("req").Error("error message", slog.Any("error", errors.New("not found")))
+	stack, _ := ingested["error.stack"].(string)
+	assert.True(t, strings.HasPrefix(stack, "github.com/nidorx/sqlog.Test_Handler_Errors_Group\n"), stack)
+
+	req, _ := ingested["req"].(map[string]any)
+	assert.Equal(t, "not found", req["error"])
+	assert.Nil(t, req["error.stack"])
+}
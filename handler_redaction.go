@@ -0,0 +1,179 @@
+package sqlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RedactionConfig configures the removal of sensitive data from log records.
+// Redaction is applied before the record is encoded.
+type RedactionConfig struct {
+	// Keys are the attribute names whose values are always replaced (case insensitive).
+	// Ex. "password", "authorization"
+	Keys []string
+
+	// Patterns are the expressions replaced in string values and in the record message.
+	// Ex. emails, tokens, card numbers
+	Patterns []*regexp.Regexp
+
+	// Hooks are custom functions applied to every non-group attribute,
+	// after the Keys and Patterns rules.
+	Hooks []func(groups []string, a slog.Attr) slog.Attr
+
+	// Replacement is the value used in place of the redacted data (default "[REDACTED]").
+	Replacement string
+
+	// Fanout applies the redaction to fanout handlers that were not configured with NewFanout.
+	Fanout bool
+}
+
+// redactor applies the RedactionConfig rules
+type redactor struct {
+	keys        map[string]bool
+	patterns    []*regexp.Regexp
+	hooks       []func(groups []string, a slog.Attr) slog.Attr
+	replacement string
+}
+
+func newRedactor(config *RedactionConfig) *redactor {
+	if config == nil {
+		return nil
+	}
+
+	r := &redactor{
+		keys:        make(map[string]bool, len(config.Keys)),
+		patterns:    config.Patterns,
+		hooks:       config.Hooks,
+		replacement: config.Replacement,
+	}
+	if r.replacement == "" {
+		r.replacement = "[REDACTED]"
+	}
+	for _, k := range config.Keys {
+		r.keys[strings.ToLower(k)] = true
+	}
+	return r
+}
+
+// record returns a copy of the record with all attributes redacted
+func (r *redactor) record(groups []string, record slog.Record) slog.Record {
+	o := slog.NewRecord(record.Time, record.Level, r.text(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		o.AddAttrs(r.attr(groups, a))
+		return true
+	})
+	return o
+}
+
+// attrs returns a redacted copy of the attributes
+func (r *redactor) attrs(groups []string, attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = r.attr(groups, a)
+	}
+	return out
+}
+
+// attr redacts a single attribute, recursively for groups
+func (r *redactor) attr(groups []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if r.keys[strings.ToLower(a.Key)] {
+		a.Value = slog.StringValue(r.replacement)
+	} else if a.Value.Kind() == slog.KindGroup {
+		sub := a.Value.Group()
+		if a.Key != "" {
+			groups = append(slices.Clip(groups), a.Key)
+		}
+		a.Value = slog.GroupValue(r.attrs(groups, sub)...)
+		return a
+	} else if a.Value.Kind() == slog.KindString {
+		if len(r.patterns) > 0 {
+			a.Value = slog.StringValue(r.text(a.Value.String()))
+		}
+	} else if a.Value.Kind() == slog.KindAny && (len(r.keys) > 0 || len(r.patterns) > 0) {
+		a.Value = r.any(a.Value.Any())
+	}
+
+	for _, hook := range r.hooks {
+		a = hook(groups, a)
+	}
+	return a
+}
+
+// any redacts a value of kind Any. Errors are redacted by their message, other values (maps, structs, slices,
+// json.Marshaler) by their JSON representation, as written by the encoder, applying the Keys to the object fields.
+// Values that can't be represented are replaced entirely.
+func (r *redactor) any(v any) slog.Value {
+	if err, ok := v.(error); ok {
+		text := err.Error()
+		if redacted := r.text(text); redacted != text {
+			return slog.StringValue(redacted)
+		}
+		return slog.AnyValue(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return slog.StringValue(r.replacement)
+	}
+	var decoded any
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&decoded); err != nil {
+		return slog.StringValue(r.replacement)
+	}
+	if redacted, changed := r.value(decoded); changed {
+		return slog.AnyValue(redacted)
+	}
+
+	// text encoders write the String() of the value
+	if s, ok := v.(fmt.Stringer); ok {
+		text := s.String()
+		if redacted := r.text(text); redacted != text {
+			return slog.StringValue(redacted)
+		}
+	}
+	return slog.AnyValue(v)
+}
+
+// value redacts the decoded JSON value in place, returns true if anything changed
+func (r *redactor) value(v any) (any, bool) {
+	changed := false
+	switch v := v.(type) {
+	case string:
+		text := r.text(v)
+		return text, text != v
+	case map[string]any:
+		for key, item := range v {
+			if r.keys[strings.ToLower(key)] {
+				v[key] = r.replacement
+				changed = true
+			} else if redacted, c := r.value(item); c {
+				v[key] = redacted
+				changed = true
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if redacted, c := r.value(item); c {
+				v[i] = redacted
+				changed = true
+			}
+		}
+	}
+	return v, changed
+}
+
+// text replaces all patterns in the text
+func (r *redactor) text(text string) string {
+	for _, p := range r.patterns {
+		text = p.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
@@ -0,0 +1,114 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Handler_Redaction(t *testing.T) {
+	var ingested []byte
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = data
+			return nil
+		},
+	}, &HandlerConfig{
+		Redaction: &RedactionConfig{
+			Keys:     []string{"password", "Authorization"},
+			Patterns: []*regexp.Regexp{regexp.MustCompile(`[\w.]+@[\w.]+`)},
+			Hooks: []func(groups []string, a slog.Attr) slog.Attr{
+				func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == "card" && strings.Join(groups, ".") == "payment" {
+						return slog.String("card", "****")
+					}
+					return a
+				},
+			},
+		},
+	})
+
+	logger := slog.New(handler).With(slog.String("password", "secret"))
+
+	logger.Info("contact john@example.com",
+		slog.String("authorization", "Bearer xyz"),
+		slog.Any("error", errors.New("user mary@example.com not found")),
+		slog.Group("payment", slog.String("card", "4111111111111111")),
+	)
+
+	assert.False(t, bytes.Contains(ingested, []byte("secret")))
+	assert.False(t, bytes.Contains(ingested, []byte("xyz")))
+	assert.False(t, bytes.Contains(ingested, []byte("@example.com")))
+	assert.False(t, bytes.Contains(ingested, []byte("4111111111111111")))
+	assert.True(t, bytes.Contains(ingested, []byte(`"card":"****"`)))
+	assert.True(t, bytes.Contains(ingested, []byte(`"password":"[REDACTED]"`)))
+}
+
+func Test_Handler_Redaction_Fanout(t *testing.T) {
+	var (
+		redacted bytes.Buffer
+		raw      bytes.Buffer
+	)
+
+	handler := newHandler(&testMockIngester{}, &HandlerConfig{
+		Redaction: &RedactionConfig{Keys: []string{"password"}, Fanout: true},
+	})
+	handler.fanout(
+		slog.NewJSONHandler(&redacted, nil),
+		NewFanout(slog.NewJSONHandler(&raw, nil), &FanoutConfig{Redact: false}),
+	)
+
+	logger := slog.New(handler)
+	logger.Info("login", slog.String("password", "secret"))
+
+	assert.False(t, bytes.Contains(redacted.Bytes(), []byte("secret")))
+	assert.True(t, bytes.Contains(raw.Bytes(), []byte("secret")))
+
+	assert.True(t, handler.Enabled(context.Background(), slog.LevelInfo))
+}
+
+func Test_Handler_Redaction_Any(t *testing.T) {
+	var ingested []byte
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = data
+			return nil
+		},
+	}, &HandlerConfig{
+		Redaction: &RedactionConfig{
+			Keys:     []string{"password", "token"},
+			Patterns: []*regexp.Regexp{regexp.MustCompile(`[\w.]+@[\w.]+`)},
+		},
+	})
+
+	type credentials struct {
+		User  string `json:"user"`
+		Token string `json:"token"`
+	}
+
+	slog.New(handler).Info("login",
+		slog.Any("request", map[string]any{
+			"user":     "john",
+			"password": "secret-1",
+			"contacts": []string{"john@example.com"},
+		}),
+		slog.Any("credentials", credentials{User: "mary", Token: "secret-2"}),
+		slog.Any("list", []credentials{{User: "bob", Token: "secret-3"}}),
+		slog.Any("plain", map[string]int{"count": 7}),
+	)
+
+	assert.False(t, bytes.Contains(ingested, []byte("secret")))
+	assert.False(t, bytes.Contains(ingested, []byte("@example.com")))
+	assert.True(t, bytes.Contains(ingested, []byte(`"user":"john"`)))
+	assert.True(t, bytes.Contains(ingested, []byte(`"credentials":{"token":"[REDACTED]","user":"mary"}`)))
+	assert.True(t, bytes.Contains(ingested, []byte(`"plain":{"count":7}`)))
+}
@@ -0,0 +1,150 @@
+package sqlog
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const samplerCounters = 4096
+
+// SamplingConfig configures the sampling and rate limiting of log records.
+// Sampling is applied by the handler before the record is encoded.
+type SamplingConfig struct {
+	// Rates defines the fraction (0.0 - 1.0) of records kept for each level.
+	// Levels not listed are always kept. Ex. {slog.LevelDebug: 0.1}
+	Rates map[slog.Level]float64
+
+	// First defines how many records with the same message are kept every
+	// second. After that, only every Thereafter-th record is kept.
+	// (Default: 0, disabled).
+	First int
+
+	// Thereafter defines the sampling interval after First is exceeded.
+	// (Default: 0, drops all records after First).
+	Thereafter int
+
+	// RateLimit is the maximum number of records per second (token bucket).
+	// (Default: 0, disabled).
+	RateLimit float64
+
+	// Burst is the maximum number of records allowed at once by the token bucket.
+	// (Default: RateLimit).
+	Burst int
+
+	// FanoutFullFidelity sends every record to the fanout handlers,
+	// sampling only the records that are ingested.
+	FanoutFullFidelity bool
+}
+
+// sampleCounter counts the records with the same message in the current second
+type sampleCounter struct {
+	second atomic.Int64
+	count  atomic.Uint64
+}
+
+// sampler decides which records are kept, counting the suppressed ones
+type sampler struct {
+	config     *SamplingConfig
+	counters   [samplerCounters]sampleCounter
+	suppressed atomic.Int64 // Number of records suppressed since the last emitted record
+	mu         sync.Mutex   // token bucket only
+	tokens     float64
+	lastRefill time.Time
+	now        func() time.Time // Clock of the counters and the token bucket, the record time is set by the caller
+}
+
+func newSampler(config *SamplingConfig) *sampler {
+	if config == nil {
+		return nil
+	}
+	// the defaults are not written to the config of the caller
+	c := *config
+	if c.Burst <= 0 {
+		c.Burst = max(1, int(c.RateLimit))
+	}
+	return &sampler{
+		config: &c,
+		tokens: float64(c.Burst),
+		now:    time.Now,
+	}
+}
+
+// sample checks if the record should be kept
+func (s *sampler) sample(record slog.Record) bool {
+	if s.keepLevel(record.Level) && s.keepMessage(record) && s.keepRate(s.now()) {
+		return true
+	}
+	s.suppressed.Add(1)
+	return false
+}
+
+// keepLevel applies the per-level rates
+func (s *sampler) keepLevel(l slog.Level) bool {
+	if rate, exists := s.config.Rates[l]; exists {
+		return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+	}
+	return true
+}
+
+// keepMessage applies the "first N then every Mth per message per second" rule
+func (s *sampler) keepMessage(record slog.Record) bool {
+	if s.config.First <= 0 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(record.Message))
+	counter := &s.counters[hash.Sum32()%samplerCounters]
+
+	second := s.now().Unix()
+	if last := counter.second.Load(); last != second && counter.second.CompareAndSwap(last, second) {
+		counter.count.Store(0)
+	}
+
+	n := counter.count.Add(1)
+	if n <= uint64(s.config.First) {
+		return true
+	}
+	if s.config.Thereafter <= 0 {
+		return false
+	}
+	return (n-uint64(s.config.First))%uint64(s.config.Thereafter) == 0
+}
+
+// keepRate applies the token bucket rate limit
+func (s *sampler) keepRate(t time.Time) bool {
+	if s.config.RateLimit <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastRefill.IsZero() {
+		if elapsed := t.Sub(s.lastRefill).Seconds(); elapsed > 0 {
+			s.tokens = min(float64(s.config.Burst), s.tokens+elapsed*s.config.RateLimit)
+		}
+	}
+	if t.After(s.lastRefill) {
+		s.lastRefill = t
+	}
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// attach adds the number of suppressed records to the emitted record
+func (s *sampler) attach(record slog.Record) slog.Record {
+	if n := s.suppressed.Swap(0); n > 0 {
+		record = record.Clone()
+		record.AddAttrs(slog.Int64("sampling.suppressed", n))
+	}
+	return record
+}
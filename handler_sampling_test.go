@@ -0,0 +1,134 @@
+package sqlog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Handler_Sampling_Message(t *testing.T) {
+	var ingested [][]byte
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = append(ingested, data)
+			return nil
+		},
+	}, &HandlerConfig{
+		Sampling: &SamplingConfig{First: 2, Thereafter: 3},
+	})
+	now := time.Now()
+	handler.sampler.now = func() time.Time { return now }
+
+	for i := 0; i < 8; i++ {
+		handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "loop", 0))
+	}
+
+	// 1, 2, 5, 8
+	assert.Equal(t, 4, len(ingested))
+	assert.True(t, bytes.Contains(ingested[2], []byte(`"sampling.suppressed":2`)))
+	assert.True(t, bytes.Contains(ingested[3], []byte(`"sampling.suppressed":2`)))
+
+	// next second resets the counter
+	now = now.Add(time.Second)
+	handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "loop", 0))
+	assert.Equal(t, 5, len(ingested))
+}
+
+func Test_Handler_Sampling_Rates(t *testing.T) {
+	var ingested int
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{
+		Options:  &slog.HandlerOptions{Level: slog.LevelDebug},
+		Sampling: &SamplingConfig{Rates: map[slog.Level]float64{slog.LevelDebug: 0}},
+	})
+	logger := slog.New(handler)
+
+	logger.Debug("dropped")
+	logger.Info("kept")
+	assert.Equal(t, 1, ingested)
+}
+
+func Test_Handler_Sampling_RateLimit(t *testing.T) {
+	var ingested int
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{
+		Sampling: &SamplingConfig{RateLimit: 10, Burst: 5},
+	})
+
+	now := time.Now()
+	handler.sampler.now = func() time.Time { return now }
+
+	for i := 0; i < 20; i++ {
+		handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "burst", 0))
+	}
+	assert.Equal(t, 5, ingested)
+
+	// the time of the record doesn't refill the bucket
+	for i := 0; i < 20; i++ {
+		handler.Handle(context.Background(), slog.NewRecord(now.Add(time.Hour), slog.LevelInfo, "burst", 0))
+	}
+	assert.Equal(t, 5, ingested)
+
+	// 10 tokens per second
+	now = now.Add(500 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		handler.Handle(context.Background(), slog.NewRecord(now.Add(-time.Hour), slog.LevelInfo, "burst", 0))
+	}
+	assert.Equal(t, 10, ingested)
+
+	// disabled records don't use tokens
+	now = now.Add(100 * time.Millisecond)
+	handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelDebug, "burst", 0))
+	handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "burst", 0))
+	assert.Equal(t, 11, ingested)
+
+	// the default is not written to the config of the caller
+	config := &SamplingConfig{RateLimit: 10}
+	assert.Equal(t, 10, newSampler(config).config.Burst)
+	assert.Equal(t, 0, config.Burst)
+}
+
+func Test_Handler_Sampling_FanoutFullFidelity(t *testing.T) {
+	var (
+		ingested int
+		fanout   int
+	)
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{
+		Sampling: &SamplingConfig{First: 1, FanoutFullFidelity: true},
+	})
+	handler.fanout(newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			fanout++
+			return nil
+		},
+	}, nil))
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		handler.Handle(context.Background(), slog.NewRecord(now, slog.LevelInfo, "same message", 0))
+	}
+
+	assert.Equal(t, 1, ingested)
+	assert.Equal(t, 5, fanout)
+}
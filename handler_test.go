@@ -1,6 +1,7 @@
 package sqlog
 
 import (
+	"bytes"
 	"context"
 	"log/slog"
 	"testing"
@@ -11,8 +12,9 @@ import (
 
 // Mock do Ingester
 type testMockIngester struct {
-	close  func() error
-	ingest func(time time.Time, level int8, data []byte) error
+	close        func() error
+	ingest       func(time time.Time, level int8, data []byte) error
+	ingestStream func(stream string, time time.Time, level int8, data []byte) error
 }
 
 func (m *testMockIngester) Close() error {
@@ -29,6 +31,13 @@ func (m *testMockIngester) Ingest(time time.Time, level int8, data []byte) error
 	return m.ingest(time, level, data)
 }
 
+func (m *testMockIngester) IngestStream(stream string, time time.Time, level int8, data []byte) error {
+	if m.ingestStream == nil {
+		return m.Ingest(time, level, data)
+	}
+	return m.ingestStream(stream, time, level, data)
+}
+
 func Test_Handler_Handle(t *testing.T) {
 
 	var (
@@ -90,7 +99,7 @@ func Test_Handler_Fanout(t *testing.T) {
 	handler2 := newHandler(&testMockIngester{ingest: ingestCount}, nil)
 
 	handler.fanout(handler1, handler2)
-	assert.Equal(t, 2, len(handler.handlers))
+	assert.Equal(t, 2, len(handler.fanouts()))
 	assert.True(t, handler.Enabled(ctx, slog.LevelWarn))
 	assert.True(t, handler.Enabled(ctx, slog.LevelInfo))
 
@@ -100,3 +109,95 @@ func Test_Handler_Fanout(t *testing.T) {
 	logger.Warn("test message")
 	assert.Equal(t, 5, ingested)
 }
+
+type testSpanContext struct{}
+
+func (testSpanContext) TraceID() string { return "4bf92f3577b34da6a3ce929d0e0e4736" }
+func (testSpanContext) SpanID() string  { return "00f067aa0ba902b7" }
+
+type testRequestIdKey struct{}
+
+func Test_Handler_ContextExtractors(t *testing.T) {
+	var ingested []byte
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = data
+			return nil
+		},
+	}, &HandlerConfig{
+		ContextExtractors: []ContextExtractor{
+			SpanContextExtractor,
+			ContextValueExtractor("request_id", testRequestIdKey{}),
+		},
+	})
+	logger := slog.New(handler)
+
+	ctx := ContextWithSpan(context.Background(), testSpanContext{})
+	ctx = context.WithValue(ctx, testRequestIdKey{}, "req-1")
+
+	logger.InfoContext(ctx, "test message")
+	assert.Contains(t, string(ingested), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, string(ingested), `"span_id":"00f067aa0ba902b7"`)
+	assert.Contains(t, string(ingested), `"request_id":"req-1"`)
+
+	logger.InfoContext(context.Background(), "test message")
+	assert.NotContains(t, string(ingested), `trace_id`)
+	assert.NotContains(t, string(ingested), `request_id`)
+}
+
+func Test_Handler_ContextExtractors_WithGroup(t *testing.T) {
+	var (
+		ingested []byte
+		fanout   bytes.Buffer
+	)
+
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested = data
+			return nil
+		},
+	}, &HandlerConfig{
+		ContextExtractors: []ContextExtractor{ContextValueExtractor("request_id", testRequestIdKey{})},
+	})
+	handler.fanout(slog.NewJSONHandler(&fanout, nil))
+
+	logger := slog.New(handler).With("app", "api").WithGroup("http").With("method", "GET").WithGroup("client")
+	ctx := context.WithValue(context.Background(), testRequestIdKey{}, "req-1")
+
+	logger.InfoContext(ctx, "test message", "status", 200)
+	for _, out := range []string{string(ingested), fanout.String()} {
+		assert.Contains(t, out, `"request_id":"req-1","app":"api","http":{"method":"GET","client":{"status":200}}`)
+	}
+}
+
+func Test_Handler_WithStream(t *testing.T) {
+	var (
+		streams  []string
+		contents []string
+	)
+	ingester := &testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			streams = append(streams, "")
+			contents = append(contents, string(data))
+			return nil
+		},
+		ingestStream: func(stream string, time time.Time, level int8, data []byte) error {
+			streams = append(streams, stream)
+			contents = append(contents, string(data))
+			return nil
+		},
+	}
+
+	handler := newHandler(ingester, nil)
+	logger := slog.New(handler)
+	billing := slog.New(handler.WithStream("billing")).With("tenant", "acme")
+
+	logger.Info("default")
+	billing.Info("invoice")
+	billing.WithGroup("http").Info("request", "status", 200)
+
+	assert.Equal(t, []string{"", "billing", "billing"}, streams)
+	assert.Contains(t, contents[1], `"tenant":"acme"`)
+	assert.Contains(t, contents[2], `"http":{"status":200}`)
+}
@@ -3,13 +3,16 @@ package sqlog
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"io/fs"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -45,14 +48,37 @@ func (l *sqlog) HttpHandler() http.Handler {
 				l.ServeHTTPTicks(w, r)
 			case "entries":
 				l.ServeHTTPEntries(w, r)
+			case "entry":
+				l.ServeHTTPEntry(w, r)
+			case "entries/context":
+				l.ServeHTTPEntriesContext(w, r)
+			case "aggregate":
+				l.ServeHTTPAggregate(w, r)
+			case "pipeline":
+				l.ServeHTTPPipeline(w, r)
+			case "fields":
+				l.ServeHTTPFields(w, r)
+			case "facets":
+				l.ServeHTTPFacets(w, r)
+			case "streams":
+				l.ServeHTTPStreams(w, r)
+			case "sources":
+				l.ServeHTTPSources(w, r)
 			case "result":
 				l.ServeHTTPResult(w, r)
+			case "cancel":
+				l.ServeHTTPCancel(w, r)
+			case "level":
+				l.ServeHTTPLevel(w, r)
+			case "alerts":
+				l.ServeHTTPAlerts(w, r)
 			}
 		} else {
 			switch path.Ext(p) {
 			case ".html", ".css", ".js":
 				p = path.Base(p)
 			default:
+				// includes the entry permalink "/entry/{id}"
 				p = ""
 			}
 
@@ -79,6 +105,8 @@ func (l *sqlog) ServeHTTPTicks(w http.ResponseWriter, r *http.Request) {
 		EpochEnd:    getInt64(q, "epoch"),
 		IntervalSec: getInt(q, "interval"),
 		MaxResult:   getInt(q, "limit"),
+		Source:      q.Get("source"),
+		Streams:     getList(q, "stream"),
 	})
 	sendJson(w, list, err)
 }
@@ -101,10 +129,151 @@ func (l *sqlog) ServeHTTPEntries(w http.ResponseWriter, r *http.Request) {
 		EpochStart: getInt64(q, "epoch"),
 		NanosStart: getInt(q, "nanos"),
 		MaxResult:  getInt(q, "limit"),
+		Source:     q.Get("source"),
+		Streams:    getList(q, "stream"),
 	})
 	sendJson(w, entries, err)
 }
 
+// ServeHTTPEntry entry api. Ex. "?id=1729000000.123456789.9f3a1c2b"
+func (l *sqlog) ServeHTTPEntry(w http.ResponseWriter, r *http.Request) {
+	entry, err := l.GetEntry(r.URL.Query().Get("id"))
+	if errors.Is(err, errEntryNotFound) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return
+	}
+	sendJson(w, entry, err)
+}
+
+// ServeHTTPEntriesContext entries context api. Ex. "?id=1729000000.123456789.9f3a1c2b&before=50&after=50&expr=host:web-1"
+func (l *sqlog) ServeHTTPEntriesContext(w http.ResponseWriter, r *http.Request) {
+	var q = r.URL.Query()
+	entries, err := l.EntriesContext(&EntriesContextInput{
+		ID:      q.Get("id"),
+		Expr:    q.Get("expr"),
+		Before:  getInt(q, "before"),
+		After:   getInt(q, "after"),
+		Source:  q.Get("source"),
+		Streams: getList(q, "stream"),
+	})
+	sendJson(w, entries, err)
+}
+
+// ServeHTTPAggregate aggregate api. Ex. "?fn=count()&fn=p95(duration)&by=route&interval=60"
+func (l *sqlog) ServeHTTPAggregate(w http.ResponseWriter, r *http.Request) {
+	var (
+		q     = r.URL.Query()
+		input = &AggregateInput{
+			Expr:        q.Get("expr"),
+			EpochStart:  getInt64(q, "start"),
+			EpochEnd:    getInt64(q, "epoch"),
+			IntervalSec: getInt(q, "interval"),
+			MaxResult:   getInt(q, "limit"),
+			Source:      q.Get("source"),
+			Streams:     getList(q, "stream"),
+		}
+	)
+
+	if level := q.Get("level"); level != "" {
+		input.Level = strings.Split(level, ",")
+	}
+
+	if by := q.Get("by"); by != "" {
+		input.GroupBy = strings.Split(by, ",")
+	}
+
+	for _, fn := range q["fn"] {
+		a, err := ParseAggregation(fn)
+		if err != nil {
+			sendJson(w, nil, err)
+			return
+		}
+		input.Aggregations = append(input.Aggregations, a)
+	}
+
+	result, err := l.Aggregate(input)
+	sendJson(w, result, err)
+}
+
+// ServeHTTPPipeline pipeline api. Ex. "?expr=status:>=500 | stats count() by route | sort -count"
+func (l *sqlog) ServeHTTPPipeline(w http.ResponseWriter, r *http.Request) {
+	var (
+		q     = r.URL.Query()
+		input = &PipelineInput{
+			Expr:       q.Get("expr"),
+			EpochStart: getInt64(q, "start"),
+			EpochEnd:   getInt64(q, "epoch"),
+			MaxResult:  getInt(q, "limit"),
+			Source:     q.Get("source"),
+			Streams:    getList(q, "stream"),
+		}
+	)
+
+	if level := q.Get("level"); level != "" {
+		input.Level = strings.Split(level, ",")
+	}
+
+	table, err := l.Pipeline(input)
+	sendJson(w, table, err)
+}
+
+// ServeHTTPFields fields api. Ex. "?expr=service:api&epoch=1729000000"
+func (l *sqlog) ServeHTTPFields(w http.ResponseWriter, r *http.Request) {
+	var (
+		q     = r.URL.Query()
+		input = &FieldsInput{
+			Expr:       q.Get("expr"),
+			EpochStart: getInt64(q, "start"),
+			EpochEnd:   getInt64(q, "epoch"),
+			MaxResult:  getInt(q, "limit"),
+			Source:     q.Get("source"),
+			Streams:    getList(q, "stream"),
+		}
+	)
+
+	if level := q.Get("level"); level != "" {
+		input.Level = strings.Split(level, ",")
+	}
+
+	fields, err := l.Fields(input)
+	sendJson(w, fields, err)
+}
+
+// ServeHTTPFacets facets api. Ex. "?field=http.route&limit=10"
+func (l *sqlog) ServeHTTPFacets(w http.ResponseWriter, r *http.Request) {
+	var (
+		q     = r.URL.Query()
+		input = &FacetsInput{
+			Expr:       q.Get("expr"),
+			EpochStart: getInt64(q, "start"),
+			EpochEnd:   getInt64(q, "epoch"),
+			Field:      q.Get("field"),
+			MaxResult:  getInt(q, "limit"),
+			Source:     q.Get("source"),
+			Streams:    getList(q, "stream"),
+		}
+	)
+
+	if level := q.Get("level"); level != "" {
+		input.Level = strings.Split(level, ",")
+	}
+
+	facets, err := l.Facets(input)
+	sendJson(w, facets, err)
+}
+
+// ServeHTTPSources sources api, the attached sets of logs
+func (l *sqlog) ServeHTTPSources(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, l.Sources(), nil)
+}
+
+// ServeHTTPStreams streams api, the names of the streams of the storage
+func (l *sqlog) ServeHTTPStreams(w http.ResponseWriter, r *http.Request) {
+	sendJson(w, l.Streams(), nil)
+}
+
 // ServeHTTPResult scheduled result api.
 func (l *sqlog) ServeHTTPResult(w http.ResponseWriter, r *http.Request) {
 	var q = r.URL.Query()
@@ -112,13 +281,89 @@ func (l *sqlog) ServeHTTPResult(w http.ResponseWriter, r *http.Request) {
 	sendJson(w, result, err)
 }
 
-// ServeHTTPResult scheduled result api.
+// ServeHTTPCancel cancels a scheduled result.
 func (l *sqlog) ServeHTTPCancel(w http.ResponseWriter, r *http.Request) {
 	var q = r.URL.Query()
 	err := l.Cancel(getInt32(q, "id"))
 	sendJson(w, nil, err)
 }
 
+type levelInput struct {
+	Name  string `json:"name"`  // Logger group or source package, empty for global
+	Level string `json:"level"` // New level, empty to remove the override
+	TTL   int    `json:"ttl"`   // Seconds until the change is reverted (0 = never)
+}
+
+type levelOutput struct {
+	Level     string          `json:"level"`
+	Overrides []LevelOverride `json:"overrides"`
+}
+
+// ServeHTTPLevel runtime log level api. (GET, PUT)
+func (l *sqlog) ServeHTTPLevel(w http.ResponseWriter, r *http.Request) {
+	levels := l.Levels()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var (
+			q     = r.URL.Query()
+			input = &levelInput{Name: q.Get("name"), Level: q.Get("level"), TTL: getInt(q, "ttl")}
+		)
+		if r.Body != nil && r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+				sendJson(w, nil, err)
+				return
+			}
+		}
+
+		if input.Level == "" {
+			if input.Name == "" {
+				sendJson(w, nil, errors.New("level is required"))
+				return
+			}
+			levels.Reset(input.Name)
+		} else {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(input.Level)); err != nil {
+				sendJson(w, nil, err)
+				return
+			}
+			levels.Set(input.Name, level, time.Duration(input.TTL)*time.Second)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sendJson(w, &levelOutput{
+		Level:     levels.Level().String(),
+		Overrides: levels.Overrides(),
+	}, nil)
+}
+
+// ServeHTTPAlerts alert rules api. (GET, POST, PUT, DELETE)
+func (l *sqlog) ServeHTTPAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := l.Alerts()
+
+	switch r.Method {
+	case http.MethodGet:
+		sendJson(w, alerts.Rules(), nil)
+	case http.MethodPost, http.MethodPut:
+		rule := AlertRule{}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			sendJson(w, nil, err)
+			return
+		}
+		rule, err := alerts.Save(rule)
+		sendJson(w, rule, err)
+	case http.MethodDelete:
+		sendJson(w, nil, alerts.Delete(r.URL.Query().Get("id")))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func sendJson(w http.ResponseWriter, data any, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
@@ -149,3 +394,14 @@ func getInt32(q url.Values, key string) int32 {
 	v, _ := strconv.ParseInt(q.Get(key), 10, 32)
 	return int32(v)
 }
+
+// getList returns the comma separated values of the parameter, nil when empty
+func getList(q url.Values, key string) []string {
+	var list []string
+	for _, v := range strings.Split(q.Get(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -48,6 +48,12 @@ type Ingester interface {
 	Ingest(t time.Time, level int8, content []byte) error
 }
 
+// StreamIngester is implemented by ingesters that route the entries to streams (see Log.WithStream)
+type StreamIngester interface {
+	// IngestStream adds a new log entry to the stream
+	IngestStream(stream string, t time.Time, level int8, content []byte) error
+}
+
 // ingester is the implementation of the Ingester interface, responsible for managing
 // log chunks and ensuring they are flushed to storage.
 type ingester struct {
@@ -115,8 +121,13 @@ func NewIngester(config *IngesterConfig, storage Storage) (*ingester, error) {
 // Ingest adds a new log entry to the active write chunk. If the chunk becomes full,
 // the ingester switches to a new chunk.
 func (i *ingester) Ingest(t time.Time, level int8, content []byte) error {
+	return i.IngestStream("", t, level, content)
+}
+
+// IngestStream adds a new log entry of the stream, the storage routes it to the partition of the stream.
+func (i *ingester) IngestStream(stream string, t time.Time, level int8, content []byte) error {
 	lastWriteId := i.writeChunkId
-	chunk, isFull := i.writeChunk.Put(&Entry{t, level, content})
+	chunk, isFull := i.writeChunk.Put(&Entry{Time: t, Level: level, Content: content, Stream: stream})
 	if isFull && atomic.CompareAndSwapInt32(&i.writeChunkId, lastWriteId, chunk.id) {
 		// The chunk is full, switch to the next one
 		i.writeChunk = chunk
@@ -0,0 +1,220 @@
+package sqlog
+
+import (
+	"log/slog"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LevelOverride is the level defined for a logger group or source package
+type LevelOverride struct {
+	Name    string `json:"name"`              // Group (Ex. "http.client") or package (Ex. "github.com/acme/app/db")
+	Level   string `json:"level"`             // DEBUG, INFO, WARN, ERROR (or offsets Ex. "INFO+2")
+	Expires int64  `json:"expires,omitempty"` // Epoch when the override is reverted (0 = never)
+}
+
+type levelOverride struct {
+	level   slog.Level
+	expires time.Time
+	timer   *time.Timer
+}
+
+// LevelRegistry allows changing the log level at runtime, globally and
+// per logger group or source package, with optional auto-revert.
+type LevelRegistry struct {
+	global       slog.LevelVar
+	globalSet    atomic.Bool  // The global level was changed by SetLevel, the fallback is not used
+	globalRevert *time.Timer  //
+	fallback     slog.Leveler // Initial global level (Ex. a *slog.LevelVar), read on every check
+	mu           sync.RWMutex
+	overrides    map[string]*levelOverride
+	hasOverrides atomic.Bool
+	minOverride  atomic.Int64 // Lowest level of the overrides (fast path)
+	packages     sync.Map     // Cache of package names by PC
+}
+
+// NewLevelRegistry creates a registry with the initial global level (default INFO).
+// The level is read on every check until SetLevel is used, so a *slog.LevelVar keeps working.
+func NewLevelRegistry(level slog.Leveler) *LevelRegistry {
+	r := &LevelRegistry{overrides: map[string]*levelOverride{}, fallback: level}
+	r.updateMin()
+	return r
+}
+
+// Level returns the global level. Implements slog.Leveler
+func (r *LevelRegistry) Level() slog.Level {
+	if r.fallback != nil && !r.globalSet.Load() {
+		return r.fallback.Level()
+	}
+	return r.global.Level()
+}
+
+// SetLevel changes the global level. If ttl > 0, the previous level is restored after ttl.
+func (r *LevelRegistry) SetLevel(level slog.Level, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.globalRevert != nil {
+		r.globalRevert.Stop()
+		r.globalRevert = nil
+	}
+
+	if ttl > 0 {
+		previous, previousSet := r.global.Level(), r.globalSet.Load()
+		r.globalRevert = time.AfterFunc(ttl, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.global.Set(previous)
+			r.globalSet.Store(previousSet)
+			r.globalRevert = nil
+		})
+	}
+
+	r.global.Set(level)
+	r.globalSet.Store(true)
+}
+
+// Set defines the level for a logger group or source package. If ttl > 0, the override is removed after ttl.
+func (r *LevelRegistry) Set(name string, level slog.Level, ttl time.Duration) {
+	if name == "" {
+		r.SetLevel(level, ttl)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if o, exists := r.overrides[name]; exists && o.timer != nil {
+		o.timer.Stop()
+	}
+
+	o := &levelOverride{level: level}
+	if ttl > 0 {
+		o.expires = time.Now().Add(ttl)
+		o.timer = time.AfterFunc(ttl, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.overrides[name] == o {
+				delete(r.overrides, name)
+				r.updateMinLocked()
+			}
+		})
+	}
+	r.overrides[name] = o
+	r.updateMinLocked()
+}
+
+// Reset removes the override of a logger group or source package
+func (r *LevelRegistry) Reset(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if o, exists := r.overrides[name]; exists {
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		delete(r.overrides, name)
+		r.updateMinLocked()
+	}
+}
+
+// Overrides returns the current overrides, sorted by name
+func (r *LevelRegistry) Overrides() []LevelOverride {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]LevelOverride, 0, len(r.overrides))
+	for name, o := range r.overrides {
+		item := LevelOverride{Name: name, Level: o.level.String()}
+		if !o.expires.IsZero() {
+			item.Expires = o.expires.Unix()
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// enabled checks if the level is enabled for any group or package (fast path)
+func (r *LevelRegistry) enabled(l slog.Level) bool {
+	return l >= r.Level() || (r.hasOverrides.Load() && int64(l) >= r.minOverride.Load())
+}
+
+// enabledFor checks if the record is enabled for the logger group and the source package of the record.
+func (r *LevelRegistry) enabledFor(group string, record slog.Record) bool {
+	if !r.hasOverrides.Load() {
+		return record.Level >= r.Level()
+	}
+
+	pkg := r.packageOf(record.PC)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		level   = r.Level()
+		longest = -1
+	)
+	for name, o := range r.overrides {
+		if len(name) > longest && (levelNameMatch(name, group) || levelNameMatch(name, pkg)) {
+			level = o.level
+			longest = len(name)
+		}
+	}
+	return record.Level >= level
+}
+
+// packageOf returns the package path of the function that created the record
+func (r *LevelRegistry) packageOf(pc uintptr) string {
+	if pc == 0 {
+		return ""
+	}
+	if v, ok := r.packages.Load(pc); ok {
+		return v.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+
+	// Ex. "github.com/acme/app/db.(*Repo).Find" => "github.com/acme/app/db"
+	pkg := frame.Function
+	slash := strings.LastIndexByte(pkg, '/')
+	if dot := strings.IndexByte(pkg[slash+1:], '.'); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+	r.packages.Store(pc, pkg)
+	return pkg
+}
+
+func (r *LevelRegistry) updateMin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateMinLocked()
+}
+
+func (r *LevelRegistry) updateMinLocked() {
+	level := int64(math.MaxInt64)
+	for _, o := range r.overrides {
+		level = min(level, int64(o.level))
+	}
+	r.minOverride.Store(level)
+	r.hasOverrides.Store(len(r.overrides) > 0)
+}
+
+// levelNameMatch checks if name is key or one of its parents ("a.b" => "a.b.c", "a/b" => "a/b/c")
+func levelNameMatch(name, key string) bool {
+	if key == "" || !strings.HasPrefix(key, name) {
+		return false
+	}
+	if len(key) == len(name) {
+		return true
+	}
+	c := key[len(name)]
+	return c == '.' || c == '/'
+}
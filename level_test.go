@@ -0,0 +1,143 @@
+package sqlog
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LevelRegistry_Group(t *testing.T) {
+	var ingested int
+
+	levels := NewLevelRegistry(slog.LevelInfo)
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{Levels: levels})
+
+	ctx := context.Background()
+	logger := slog.New(handler)
+	client := logger.WithGroup("http").WithGroup("client")
+	server := logger.WithGroup("http").WithGroup("server")
+
+	assert.False(t, handler.Enabled(ctx, slog.LevelDebug))
+
+	levels.Set("http.client", slog.LevelDebug, 0)
+	assert.True(t, handler.Enabled(ctx, slog.LevelDebug))
+
+	client.Debug("ingested")
+	server.Debug("ignored")
+	logger.Debug("ignored")
+	assert.Equal(t, 1, ingested)
+
+	levels.Reset("http.client")
+	client.Debug("ignored")
+	assert.Equal(t, 1, ingested)
+	assert.False(t, handler.Enabled(ctx, slog.LevelDebug))
+}
+
+func Test_LevelRegistry_Package(t *testing.T) {
+	var ingested int
+
+	levels := NewLevelRegistry(slog.LevelInfo)
+	logger := slog.New(newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{Levels: levels}))
+
+	levels.Set("github.com/nidorx/sqlog", slog.LevelDebug, 0)
+	logger.Debug("ingested")
+	assert.Equal(t, 1, ingested)
+
+	levels.Set("github.com/nidorx/sqlog/other", slog.LevelDebug, 0)
+	levels.Set("github.com/nidorx/sqlog", slog.LevelWarn, 0)
+	logger.Debug("ignored")
+	logger.Info("ignored")
+	assert.Equal(t, 1, ingested)
+}
+
+func Test_LevelRegistry_LevelVar(t *testing.T) {
+	var ingested int
+
+	level := &slog.LevelVar{}
+	handler := newHandler(&testMockIngester{
+		ingest: func(time time.Time, level int8, data []byte) error {
+			ingested++
+			return nil
+		},
+	}, &HandlerConfig{Options: &slog.HandlerOptions{Level: level}})
+	logger := slog.New(handler)
+
+	logger.Debug("ignored")
+	assert.Equal(t, 0, ingested)
+
+	// changed after New
+	level.Set(slog.LevelDebug)
+	logger.Debug("ingested")
+	assert.Equal(t, 1, ingested)
+	assert.Equal(t, slog.LevelDebug, handler.levels.Level())
+
+	// the runtime level takes precedence until reverted
+	handler.levels.SetLevel(slog.LevelWarn, 50*time.Millisecond)
+	logger.Info("ignored")
+	assert.Equal(t, 1, ingested)
+
+	waitMax(time.Second, func() bool {
+		return handler.levels.Level() == slog.LevelDebug
+	})
+	level.Set(slog.LevelError)
+	logger.Warn("ignored")
+	logger.Error("ingested")
+	assert.Equal(t, 2, ingested)
+}
+
+func Test_LevelRegistry_AutoRevert(t *testing.T) {
+	levels := NewLevelRegistry(slog.LevelInfo)
+
+	levels.Set("db", slog.LevelDebug, 50*time.Millisecond)
+	levels.SetLevel(slog.LevelError, 50*time.Millisecond)
+	assert.Equal(t, 1, len(levels.Overrides()))
+	assert.Equal(t, slog.LevelError, levels.Level())
+
+	waitMax(time.Second, func() bool {
+		return len(levels.Overrides()) == 0 && levels.Level() == slog.LevelInfo
+	})
+	assert.Equal(t, 0, len(levels.Overrides()))
+	assert.Equal(t, slog.LevelInfo, levels.Level())
+}
+
+func Test_Http_Level(t *testing.T) {
+	log, err := New(nil)
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/logs/api/level", strings.NewReader(`{"name":"http","level":"DEBUG","ttl":60}`))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/level", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	out := &levelOutput{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(out))
+	assert.Equal(t, "INFO", out.Level)
+	assert.Equal(t, 1, len(out.Overrides))
+	assert.Equal(t, "http", out.Overrides[0].Name)
+	assert.Equal(t, "DEBUG", out.Overrides[0].Level)
+	assert.Greater(t, out.Overrides[0].Expires, time.Now().Unix())
+}
@@ -33,7 +33,12 @@ func (m *MemoryExprBuilder) Build() MemoryExpr {
 	}
 	return func(e *sqlog.Entry) bool {
 		var j map[string]any
-		if err := json.Unmarshal(e.Content, &j); err != nil {
+		if sqlog.IsMsgpack(e.Content) {
+			v, err := sqlog.DecodeMsgpack(e.Content)
+			if j, _ = v.(map[string]any); err != nil || j == nil {
+				return false
+			}
+		} else if err := json.Unmarshal(e.Content, &j); err != nil {
 			return false
 		}
 		for _, expr := range stack {
@@ -344,6 +349,10 @@ func memExprGetNumber(j map[string]any, field string) (fieldValue float64, valid
 		switch tv := v.(type) {
 		case float64:
 			fieldValue = tv
+		case int64:
+			fieldValue = float64(tv)
+		case uint64:
+			fieldValue = float64(tv)
 		case string:
 			if n, err := strconv.ParseFloat(tv, 64); err != nil {
 				return 0, false
@@ -0,0 +1,455 @@
+package sqlog
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pipeline stages
+const (
+	StageStats  = "stats"  // stats count(), avg(duration) as avg by route, method
+	StageSort   = "sort"   // sort -count, route
+	StageHead   = "head"   // head 10
+	StageFields = "fields" // fields time, msg, route
+)
+
+// Pipeline is a filter expression followed by stages that transform the result into a table.
+// Ex. `service:api status:>=500 | stats count() by route | sort -count | head 10`
+type Pipeline struct {
+	Filter string           `json:"filter"`
+	Stages []*PipelineStage `json:"stages"`
+}
+
+// PipelineStage is a stage of the pipeline
+type PipelineStage struct {
+	Command      string         `json:"command"`                // stats, sort, head, fields
+	Aggregations []Aggregation  `json:"aggregations,omitempty"` // stats
+	Names        []string       `json:"names,omitempty"`        // stats, column name of each aggregation
+	By           []string       `json:"by,omitempty"`           // stats, group by fields
+	Sort         []PipelineSort `json:"sort,omitempty"`         // sort
+	Limit        int            `json:"limit,omitempty"`        // head
+	Fields       []string       `json:"fields,omitempty"`       // fields
+}
+
+type PipelineSort struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+type PipelineInput struct {
+	Expr       string   `json:"expr"`        // Filter expression followed by the stages
+	Level      []string `json:"level"`       // ["debug","info","warn","error"]
+	EpochStart int64    `json:"epoch_start"` // (Default: EpochEnd - 1 hour)
+	EpochEnd   int64    `json:"epoch"`       // (Default: now)
+	MaxResult  int      `json:"limit"`       // Maximum number of entries processed and of rows returned (Default: 1000)
+	Source     string   `json:"source"`      // Label of the attached source, empty for the live storage
+	Streams    []string `json:"streams"`     // Names of the streams (Default: all)
+}
+
+// Table is the tabular result of a pipeline
+type Table struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// HasPipeline checks if the expression has pipeline stages (unquoted "|")
+func HasPipeline(expr string) bool {
+	return len(splitPipeline(expr)) > 1
+}
+
+// splitPipeline splits the expression on unquoted "|"
+func splitPipeline(expr string) []string {
+	var (
+		parts   []string
+		start   int
+		quoted  bool
+		escaped bool
+	)
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == '|' && !quoted:
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+// ParsePipeline parses the filter expression and the stages
+func ParsePipeline(expr string) (*Pipeline, error) {
+	parts := splitPipeline(expr)
+	p := &Pipeline{Filter: strings.TrimSpace(parts[0])}
+
+	for i, part := range parts[1:] {
+		tokens := pipelineTokens(part)
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("[sqlog] empty pipeline stage at position %d", i+1)
+		}
+
+		var (
+			err   error
+			stage = &PipelineStage{Command: strings.ToLower(tokens[0])}
+			args  = tokens[1:]
+		)
+		switch stage.Command {
+		case StageStats:
+			if i > 0 {
+				return nil, fmt.Errorf("[sqlog] stats must be the first stage")
+			}
+			err = parseStatsStage(stage, args)
+		case StageSort:
+			for _, column := range pipelineList(args) {
+				s := PipelineSort{Column: strings.TrimLeft(column, "+-"), Desc: strings.HasPrefix(column, "-")}
+				if s.Column == "" {
+					return nil, fmt.Errorf("[sqlog] invalid sort column %q", column)
+				}
+				stage.Sort = append(stage.Sort, s)
+			}
+			if len(stage.Sort) == 0 {
+				err = fmt.Errorf("[sqlog] sort requires a column")
+			}
+		case StageHead:
+			stage.Limit = 10
+			if len(args) > 1 {
+				err = fmt.Errorf("[sqlog] invalid head %q", strings.Join(args, " "))
+			} else if len(args) == 1 {
+				if stage.Limit, err = strconv.Atoi(args[0]); err != nil || stage.Limit <= 0 {
+					err = fmt.Errorf("[sqlog] invalid head %q", args[0])
+				}
+			}
+		case StageFields:
+			if stage.Fields = pipelineList(args); len(stage.Fields) == 0 {
+				err = fmt.Errorf("[sqlog] fields requires a field")
+			}
+		default:
+			err = fmt.Errorf("[sqlog] unknown pipeline stage %q", tokens[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.Stages = append(p.Stages, stage)
+	}
+	return p, nil
+}
+
+// parseStatsStage parses "count(), avg(duration) as avg by route, method"
+func parseStatsStage(stage *PipelineStage, args []string) error {
+	by := slices.IndexFunc(args, func(t string) bool { return strings.EqualFold(t, "by") })
+	if by >= 0 {
+		stage.By = pipelineList(args[by+1:])
+		if len(stage.By) == 0 || len(stage.By) > aggregateMaxGroupBy {
+			return fmt.Errorf("[sqlog] stats by requires 1 to %d fields", aggregateMaxGroupBy)
+		}
+		args = args[:by]
+	}
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "," {
+			continue
+		}
+		a, err := ParseAggregation(args[i])
+		if err != nil {
+			return err
+		}
+		name := a.Func
+		if a.Field != "" {
+			name = a.String()
+		}
+		if i+2 < len(args) && strings.EqualFold(args[i+1], "as") {
+			name = args[i+2]
+			i += 2
+		}
+		stage.Aggregations = append(stage.Aggregations, a)
+		stage.Names = append(stage.Names, name)
+	}
+	if len(stage.Aggregations) == 0 {
+		return fmt.Errorf("[sqlog] stats requires an aggregation")
+	}
+	return nil
+}
+
+// pipelineTokens splits the stage in words and commas, keeping "fn(field)" as a single token
+func pipelineTokens(stage string) (tokens []string) {
+	var (
+		sb    strings.Builder
+		depth int
+	)
+	flush := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, sb.String())
+			sb.Reset()
+		}
+	}
+	for _, c := range stage {
+		switch {
+		case c == '(':
+			depth++
+			sb.WriteRune(c)
+		case c == ')':
+			depth--
+			sb.WriteRune(c)
+		case depth > 0:
+			sb.WriteRune(c)
+		case c == ',':
+			flush()
+			tokens = append(tokens, ",")
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	flush()
+	return
+}
+
+// pipelineList returns the tokens without commas
+func pipelineList(tokens []string) (list []string) {
+	for _, t := range tokens {
+		if t != "," {
+			list = append(list, t)
+		}
+	}
+	return
+}
+
+// Pipeline executes the pipeline, waiting for the scheduled results (up to 30 seconds)
+func (l *sqlog) Pipeline(input *PipelineInput) (*Table, error) {
+	p, err := ParsePipeline(input.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.EpochEnd <= 0 {
+		input.EpochEnd = time.Now().Unix()
+	}
+	if input.EpochStart <= 0 || input.EpochStart >= input.EpochEnd {
+		input.EpochStart = input.EpochEnd - 3600
+	}
+	if input.MaxResult <= 0 {
+		input.MaxResult = 1000
+	}
+
+	var (
+		table  *Table
+		stages = p.Stages
+	)
+	if len(stages) > 0 && stages[0].Command == StageStats {
+		table, err = l.pipelineStats(p.Filter, stages[0], input)
+		stages = stages[1:]
+	} else {
+		table, err = l.pipelineEntries(p.Filter, stages, input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stage := range stages {
+		if table, err = table.apply(stage); err != nil {
+			return nil, err
+		}
+	}
+
+	// the groups are limited after the stages, so sort and head see all of them
+	if len(table.Rows) > input.MaxResult {
+		table.Rows = table.Rows[:input.MaxResult]
+	}
+	return table, nil
+}
+
+// pipelineStats runs the stats stage with the Aggregate api
+func (l *sqlog) pipelineStats(filter string, stage *PipelineStage, input *PipelineInput) (*Table, error) {
+	out, err := l.Aggregate(&AggregateInput{
+		Expr:         filter,
+		Level:        input.Level,
+		EpochStart:   input.EpochStart,
+		EpochEnd:     input.EpochEnd,
+		Aggregations: stage.Aggregations,
+		GroupBy:      stage.By,
+		MaxResult:    math.MaxInt32, // limited after the stages (see Pipeline)
+		Source:       input.Source,
+		Streams:      input.Streams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	table := &Table{Columns: append(slices.Clone(stage.By), stage.Names...), Rows: [][]any{}}
+	for _, row := range out.Aggregate {
+		table.Rows = append(table.Rows, append(slices.Clone(row.Groups), row.Values...))
+	}
+	return table, nil
+}
+
+// pipelineEntries reads the entries (newest first), the columns are defined by the first fields stage
+func (l *sqlog) pipelineEntries(filter string, stages []*PipelineStage, input *PipelineInput) (*Table, error) {
+	s, ok := l.storage.(StorageWithApi)
+	if !ok {
+		return &Table{}, nil
+	}
+
+	var (
+		columns = []string{"time", "level", "msg"}
+		limit   = input.MaxResult
+		sorted  bool
+	)
+	for _, stage := range stages {
+		if stage.Command == StageFields {
+			columns = stage.Fields
+			break
+		}
+	}
+	for _, stage := range stages {
+		if stage.Command == StageSort {
+			sorted = true
+		}
+		if stage.Command == StageHead && !sorted {
+			// without sort, only the first entries are needed
+			limit = min(limit, stage.Limit)
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	table := &Table{Columns: columns, Rows: [][]any{}}
+	err := readEntries(ctx, s, EntriesInput{
+		Expr:       filter,
+		Level:      input.Level,
+		Direction:  "before",
+		EpochStart: input.EpochEnd,
+		NanosStart: 999999999,
+		MaxResult:  min(100, limit),
+		Source:     input.Source,
+		Streams:    input.Streams,
+	}, func(entry *EntryView) bool {
+		if entry.Epoch < input.EpochStart {
+			return false
+		}
+
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			row[i] = pipelineValue(entry.Attrs, c)
+		}
+		table.Rows = append(table.Rows, row)
+		return len(table.Rows) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// pipelineValue returns the value of the field ("user.id" as key or nested)
+func pipelineValue(data map[string]any, field string) any {
+	if v, exists := data[field]; exists {
+		return v
+	}
+	if i := strings.IndexByte(field, '.'); i > 0 {
+		if m, ok := data[field[:i]].(map[string]any); ok {
+			return pipelineValue(m, field[i+1:])
+		}
+	}
+	return nil
+}
+
+// apply executes the stage on the table
+func (t *Table) apply(stage *PipelineStage) (*Table, error) {
+	switch stage.Command {
+	case StageSort:
+		var indexes []int
+		for _, s := range stage.Sort {
+			i := slices.Index(t.Columns, s.Column)
+			if i < 0 {
+				return nil, fmt.Errorf("[sqlog] unknown column %q", s.Column)
+			}
+			indexes = append(indexes, i)
+		}
+		slices.SortStableFunc(t.Rows, func(a, b []any) int {
+			for n, i := range indexes {
+				c := compareValues(a[i], b[i])
+				if stage.Sort[n].Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+	case StageHead:
+		if len(t.Rows) > stage.Limit {
+			t.Rows = t.Rows[:stage.Limit]
+		}
+	case StageFields:
+		var indexes []int
+		for _, f := range stage.Fields {
+			i := slices.Index(t.Columns, f)
+			if i < 0 {
+				return nil, fmt.Errorf("[sqlog] unknown column %q", f)
+			}
+			indexes = append(indexes, i)
+		}
+		for r, row := range t.Rows {
+			o := make([]any, len(indexes))
+			for n, i := range indexes {
+				o[n] = row[i]
+			}
+			t.Rows[r] = o
+		}
+		t.Columns = stage.Fields
+	case StageStats:
+		return nil, fmt.Errorf("[sqlog] stats must be the first stage")
+	}
+	return t, nil
+}
+
+// compareValues compares numbers numerically and other values as text. nil is the smallest value.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
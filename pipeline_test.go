@@ -0,0 +1,133 @@
+package sqlog
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Pipeline_Parse(t *testing.T) {
+	p, err := ParsePipeline(`service:api msg:"a | b" | stats count(), p95(duration) as p95 by route, method | sort -count, route | head 5 | fields route, count`)
+	assert.Nil(t, err)
+	assert.Equal(t, `service:api msg:"a | b"`, p.Filter)
+	assert.Equal(t, 4, len(p.Stages))
+
+	stats := p.Stages[0]
+	assert.Equal(t, StageStats, stats.Command)
+	assert.Equal(t, []Aggregation{{Func: AggCount}, {Func: AggP95, Field: "duration"}}, stats.Aggregations)
+	assert.Equal(t, []string{"count", "p95"}, stats.Names)
+	assert.Equal(t, []string{"route", "method"}, stats.By)
+
+	assert.Equal(t, []PipelineSort{{Column: "count", Desc: true}, {Column: "route"}}, p.Stages[1].Sort)
+	assert.Equal(t, 5, p.Stages[2].Limit)
+	assert.Equal(t, []string{"route", "count"}, p.Stages[3].Fields)
+
+	p, err = ParsePipeline("hello world")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", p.Filter)
+	assert.Empty(t, p.Stages)
+
+	p, err = ParsePipeline("| stats avg(duration) | head")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"avg(duration)"}, p.Stages[0].Names)
+	assert.Equal(t, 10, p.Stages[1].Limit)
+
+	for _, expr := range []string{
+		"a | ",
+		"a | unknown",
+		"a | head x",
+		"a | sort",
+		"a | fields",
+		"a | stats",
+		"a | stats avg()",
+		"a | stats count() by",
+		"a | stats count() by a, b, c, d",
+		"a | head 1 | stats count()",
+	} {
+		_, err = ParsePipeline(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func Test_Pipeline_Stats(t *testing.T) {
+	var input *AggregateInput
+	storage := &testMockApiStorage{
+		aggregate: func(i *AggregateInput) (*Output, error) {
+			input = i
+			return &Output{Aggregate: FinalizeAggregateRows(i, []*AggregateRow{
+				{Groups: []any{"/a"}, Partials: []*AggregatePartial{{Count: 5}}},
+				{Groups: []any{"/b"}, Partials: []*AggregatePartial{{Count: 9}}},
+				{Groups: []any{"/c"}, Partials: []*AggregatePartial{{Count: 7}}},
+			})}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	table, err := log.Pipeline(&PipelineInput{Expr: "status:>=500 | stats count() by route | sort -count | head 2", EpochEnd: 7200})
+	assert.Nil(t, err)
+	assert.Equal(t, "status:>=500", input.Expr)
+	assert.Equal(t, []string{"route"}, input.GroupBy)
+	assert.Equal(t, int64(3600), input.EpochStart)
+	assert.Equal(t, []string{"route", "count"}, table.Columns)
+	assert.Equal(t, [][]any{{"/b", int64(9)}, {"/c", int64(7)}}, table.Rows)
+
+	// the limit is applied after sort, the top groups are kept
+	table, err = log.Pipeline(&PipelineInput{Expr: "status:>=500 | stats count() by route | sort -count", EpochEnd: 7200, MaxResult: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, math.MaxInt32, input.MaxResult)
+	assert.Equal(t, [][]any{{"/b", int64(9)}, {"/c", int64(7)}}, table.Rows)
+
+	_, err = log.Pipeline(&PipelineInput{Expr: "| stats count() by route | sort unknown"})
+	assert.NotNil(t, err)
+}
+
+func Test_Pipeline_Entries(t *testing.T) {
+	storage := &testMockApiStorage{
+		entries: func(i *EntriesInput) (*Output, error) {
+			if i.EpochStart != 7200 {
+				return &Output{}, nil
+			}
+			return &Output{Entries: []*EntryView{
+				testEntryView(7100, `{"msg":"first","http":{"route":"/a"},"duration":30}`),
+				testEntryView(7000, `{"msg":"second","http":{"route":"/b"},"duration":10}`),
+				testEntryView(6900, `{"msg":"third","duration":20}`),
+			}}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	q := url.Values{"expr": {"hello | fields msg, http.route, duration | sort duration"}, "epoch": {"7200"}}
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/pipeline?"+q.Encode(), nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	table := &Table{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(table))
+	assert.Equal(t, []string{"msg", "http.route", "duration"}, table.Columns)
+	assert.Equal(t, [][]any{{"second", "/b", 10.0}, {"third", nil, 20.0}, {"first", "/a", 30.0}}, table.Rows)
+
+	q.Set("expr", "hello | head 1")
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/pipeline?"+q.Encode(), nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	table = &Table{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(table))
+	assert.Equal(t, []string{"time", "level", "msg"}, table.Columns)
+	assert.Equal(t, 1, len(table.Rows))
+	assert.Equal(t, "first", table.Rows[0][2])
+}
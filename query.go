@@ -0,0 +1,78 @@
+package sqlog
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+type QueryInput struct {
+	Expr       string   `json:"expr"`
+	Level      []string `json:"level"`       // ["debug","info","warn","error"]
+	EpochStart int64    `json:"epoch_start"` // Oldest entry, inclusive (Default: 0, no limit)
+	EpochEnd   int64    `json:"epoch"`       // Newest entry, inclusive (Default: now)
+	Direction  string   `json:"dir"`         // "before" newest first (default), "after" oldest first
+	MaxResult  int      `json:"limit"`       // (Default: 0, no limit)
+	Source     string   `json:"source"`      // Label of the attached source, empty for the live storage
+	Streams    []string `json:"streams"`     // Names of the streams (Default: all)
+}
+
+// Query iterates over the entries matching the input, page by page. Archived databases are opened as
+// needed (scheduled results are awaited) and the iteration stops when the context is canceled.
+//
+//	for entry, err := range log.Query(ctx, sqlog.QueryInput{Expr: "status:>=500"}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(entry.Time, entry.Message)
+//	}
+func (l *sqlog) Query(ctx context.Context, input QueryInput) iter.Seq2[EntryView, error] {
+	return func(yield func(EntryView, error) bool) {
+		s, ok := l.storage.(StorageWithApi)
+		if !ok {
+			return
+		}
+
+		if input.EpochEnd <= 0 {
+			input.EpochEnd = time.Now().Unix()
+		}
+
+		page := EntriesInput{
+			Expr:       input.Expr,
+			Level:      input.Level,
+			Direction:  "before",
+			EpochStart: input.EpochEnd,
+			NanosStart: 999999999,
+			MaxResult:  100,
+			Source:     input.Source,
+			Streams:    input.Streams,
+		}
+		if input.Direction == "after" {
+			page.Direction = "after"
+			page.EpochStart = max(input.EpochStart, 1) // 0 is "now" for the storage
+			page.NanosStart = -1
+		}
+		if input.MaxResult > 0 {
+			page.MaxResult = min(page.MaxResult, input.MaxResult)
+		}
+
+		var (
+			count   int
+			stopped bool
+		)
+		err := readEntries(ctx, s, page, func(e *EntryView) bool {
+			if e.Epoch < input.EpochStart || e.Epoch > input.EpochEnd {
+				return false
+			}
+			if !yield(*e, nil) {
+				stopped = true
+				return false
+			}
+			count++
+			return input.MaxResult <= 0 || count < input.MaxResult
+		})
+		if err != nil && !stopped {
+			yield(EntryView{}, err)
+		}
+	}
+}
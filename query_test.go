@@ -0,0 +1,215 @@
+package sqlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Query(t *testing.T) {
+	// 250 entries, epoch 1000 to 1249, the oldest 10 in an archived database (scheduled)
+	var all []*EntryView
+	for i := range 250 {
+		all = append(all, testEntryView(int64(1000+i), fmt.Sprintf(`{"msg":"%d"}`, i)))
+	}
+
+	var (
+		taskId  int32
+		starts  []int64
+		storage *testMockApiStorage
+	)
+	storage = &testMockApiStorage{
+		results: map[int32]*Output{},
+		entries: func(i *EntriesInput) (*Output, error) {
+			starts = append(starts, i.EpochStart)
+			out := &Output{}
+			for j := range all {
+				if i.Direction == "before" {
+					j = len(all) - 1 - j
+				}
+				e := all[j]
+				if len(out.Entries) == i.MaxResult {
+					break
+				}
+				if i.Direction == "before" && (e.Epoch > i.EpochStart || (e.Epoch == i.EpochStart && e.Nanos >= i.NanosStart)) {
+					continue
+				}
+				if i.Direction == "after" && (e.Epoch < i.EpochStart || (e.Epoch == i.EpochStart && e.Nanos <= i.NanosStart)) {
+					continue
+				}
+				if e.Epoch < 1010 {
+					taskId++
+					storage.results[taskId] = &Output{Entries: []*EntryView{e}}
+					out.Scheduled = true
+					out.TaskIds = []int32{taskId}
+					break
+				}
+				out.Entries = append(out.Entries, e)
+			}
+			return out, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	ctx := context.Background()
+
+	var epochs []int64
+	for e, err := range log.Query(ctx, QueryInput{EpochEnd: 1248}) {
+		assert.Nil(t, err)
+		epochs = append(epochs, e.Epoch)
+	}
+	assert.Equal(t, 249, len(epochs))
+	assert.Equal(t, int64(1248), epochs[0])
+	assert.Equal(t, int64(1000), epochs[248])
+
+	epochs = nil
+	for e, err := range log.Query(ctx, QueryInput{Direction: "after", EpochStart: 1100, EpochEnd: 1119}) {
+		assert.Nil(t, err)
+		epochs = append(epochs, e.Epoch)
+	}
+	assert.Equal(t, 20, len(epochs))
+	assert.Equal(t, int64(1100), epochs[0])
+	assert.Equal(t, int64(1119), epochs[19])
+
+	// from the oldest entry, 0 is "now" for the storage
+	epochs, starts = nil, nil
+	for e, err := range log.Query(ctx, QueryInput{Direction: "after", EpochEnd: 1019}) {
+		assert.Nil(t, err)
+		epochs = append(epochs, e.Epoch)
+	}
+	assert.Equal(t, 20, len(epochs))
+	assert.Equal(t, int64(1000), epochs[0])
+	assert.Equal(t, int64(1), starts[0])
+
+	epochs = nil
+	for e := range log.Query(ctx, QueryInput{EpochEnd: 1248, MaxResult: 5}) {
+		epochs = append(epochs, e.Epoch)
+	}
+	assert.Equal(t, []int64{1248, 1247, 1246, 1245, 1244}, epochs)
+
+	epochs = nil
+	for e := range log.Query(ctx, QueryInput{EpochEnd: 1248}) {
+		epochs = append(epochs, e.Epoch)
+		if len(epochs) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, len(epochs))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var errs []error
+	for _, err := range log.Query(canceled, QueryInput{}) {
+		errs = append(errs, err)
+	}
+	assert.Equal(t, []error{context.Canceled}, errs)
+}
+
+func Test_Http_Result(t *testing.T) {
+	storage := &testMockApiStorage{
+		results: map[int32]*Output{
+			1: {Scheduled: true, TaskIds: []int32{1}, Progress: &Progress{Databases: 2, DatabasesScanned: 1, RowsReturned: 30, Percent: 62.5}},
+			2: {Scheduled: true, TaskIds: []int32{2}},
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/result?id=1", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"scheduled":true,"tasks":[1],"progress":{"databases":2,"databases_scanned":1,"rows_returned":30,"percent":62.5}}`, res.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/cancel?id=2", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.NotContains(t, storage.results, int32(2))
+}
+
+type testMockSourcesStorage struct {
+	testMockApiStorage
+	sources []*Source
+}
+
+func (s *testMockSourcesStorage) Sources() []*Source {
+	return s.sources
+}
+
+func Test_Http_Sources(t *testing.T) {
+	var source string
+	storage := &testMockSourcesStorage{
+		testMockApiStorage: testMockApiStorage{
+			entries: func(input *EntriesInput) (*Output, error) {
+				source = input.Source
+				return &Output{}, nil
+			},
+		},
+		sources: []*Source{{Name: "host-b", Dir: "/backup/host-b", Databases: 2, EpochStart: 1000, EpochEnd: 2999}},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/sources", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `[{"name":"host-b","dir":"/backup/host-b","databases":2,"epoch_start":1000,"epoch_end":2999}]`, res.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/entries?source=host-b", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "host-b", source)
+
+	// storage without sources
+	log2, err := New(&Config{Storage: &testMockApiStorage{}})
+	assert.Nil(t, err)
+	defer log2.Stop()
+	assert.Empty(t, log2.Sources())
+}
+
+func Test_Http_Streams(t *testing.T) {
+	var streams []string
+	storage := &testMockApiStorage{
+		ticks: func(input *TicksInput) (*Output, error) {
+			streams = input.Streams
+			return &Output{}, nil
+		},
+	}
+
+	log, err := New(&Config{Storage: storage})
+	assert.Nil(t, err)
+	defer log.Stop()
+
+	handler := log.HttpHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/api/ticks?stream=billing,+api", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, []string{"billing", "api"}, streams)
+
+	// storage without streams
+	req = httptest.NewRequest(http.MethodGet, "/logs/api/streams", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `["default"]`, res.Body.String())
+}
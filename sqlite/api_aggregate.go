@@ -0,0 +1,265 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/nidorx/sqlog"
+)
+
+// Aggregate computes the partial aggregates on each database, merging the results. Values that are not numbers
+// are ignored. The percentiles use a random sample of up to sqlog.AggregateMaxSamples values of each group.
+//
+//	SELECT bucket, g0, COUNT(*), COUNT(v0), SUM(v0), MIN(v0), MAX(v0), json_group_array(v0) FILTER (WHERE v0 IS NOT NULL AND n0 <= 10000)
+//	FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY bucket, g0 ORDER BY v0 IS NULL, random()) AS n0 FROM (
+//		SELECT (e.epoch_secs / ?) * ? AS bucket, json_extract(e.content, ?) AS g0,
+//			CASE WHEN typeof(json_extract(e.content, ?)) IN ('integer', 'real') THEN json_extract(e.content, ?) END AS v0
+//		FROM entries e WHERE e.epoch_secs >= ? AND e.epoch_secs < ? AND (...)
+//	))
+//	GROUP BY bucket, g0
+//
+// When there are archived databases, the rows are partial (see sqlog.MergeAggregateRows), finalized by sqlog.Aggregate.
+func (s *storage) Aggregate(input *sqlog.AggregateInput) (*sqlog.Output, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the SQL depends on the content type of each database
+	query, err := s.newDbQuery(func(contentType string) (string, []any, error) {
+		var (
+			extract = extractFunction(contentType)
+			content = s.contentColumn()
+			outer   = bytes.NewBuffer(make([]byte, 0, 256))
+			inner   = bytes.NewBuffer(make([]byte, 0, 256))
+			groupBy = bytes.NewBuffer(make([]byte, 0, 32))
+			samples []string // row numbers of the percentile samples
+			args    []any
+		)
+
+		outer.WriteString("SELECT bucket")
+		groupBy.WriteString(" GROUP BY bucket")
+
+		if input.IntervalSec > 0 {
+			inner.WriteString("SELECT (e.epoch_secs / ?) * ? AS bucket")
+			args = append(args, input.IntervalSec, input.IntervalSec)
+		} else {
+			inner.WriteString("SELECT ? AS bucket")
+			args = append(args, input.EpochStart)
+		}
+
+		for i, field := range input.GroupBy {
+			g := "g" + strconv.Itoa(i)
+			outer.WriteString(", " + g)
+			groupBy.WriteString(", " + g)
+			inner.WriteString(", " + extract + "(" + content + ", ?) AS " + g)
+			args = append(args, "$."+field)
+		}
+
+		outer.WriteString(", COUNT(*)")
+		for i, a := range input.Aggregations {
+			if a.Field == "" {
+				continue
+			}
+			v := "v" + strconv.Itoa(i)
+			outer.WriteString(", COUNT(" + v + "), SUM(" + v + "), MIN(" + v + "), MAX(" + v + ")")
+			if a.IsPercentile() {
+				n := "n" + strconv.Itoa(i)
+				outer.WriteString(", json_group_array(" + v + ") FILTER (WHERE " + v + " IS NOT NULL AND " + n + " <= " + strconv.Itoa(sqlog.AggregateMaxSamples) + ")")
+				samples = append(samples, "ROW_NUMBER() OVER (PARTITION BY "+strings.TrimPrefix(groupBy.String(), " GROUP BY ")+" ORDER BY "+v+" IS NULL, random()) AS "+n)
+			}
+			value := extract + "(" + content + ", ?)"
+			inner.WriteString(", CASE WHEN typeof(" + value + ") IN ('integer', 'real') THEN " + value + " END AS " + v)
+			args = append(args, "$."+a.Field, "$."+a.Field)
+		}
+
+		inner.WriteString(" FROM entries e WHERE e.epoch_secs >= ? AND e.epoch_secs < ?")
+		args = append(args, input.EpochStart, input.EpochEnd)
+
+		if levels := sqlLevelsFilter(input.Level); levels != "" {
+			inner.WriteString(" AND ")
+			inner.WriteString(levels)
+		}
+
+		if expr := strings.TrimSpace(input.Expr); expr != "" {
+			if compiled, err := s.exprBuilder(contentType)(expr); err != nil {
+				return "", nil, err
+			} else if compiled.Sql != "" {
+				inner.WriteString(" AND (")
+				inner.WriteString(compiled.Sql)
+				inner.WriteByte(')')
+				args = append(args, compiled.Args...)
+			}
+		}
+
+		outer.WriteString(" FROM (")
+		if len(samples) > 0 {
+			outer.WriteString("SELECT *, " + strings.Join(samples, ", ") + " FROM (")
+			outer.Write(inner.Bytes())
+			outer.WriteString(")")
+		} else {
+			outer.Write(inner.Bytes())
+		}
+		outer.WriteString(")")
+		outer.Write(groupBy.Bytes())
+
+		if input.Top > 0 {
+			outer.WriteString(" ORDER BY COUNT(*) DESC LIMIT ?")
+			args = append(args, input.Top)
+		}
+
+		return outer.String(), args, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		rows      []*sqlog.AggregateRow
+		closedDbs []*storageDb
+	)
+
+	ctx, cancel := s.queryContext(context.Background())
+	defer cancel()
+
+	sourceDbs, err := s.sourceDbs(input.Source, input.Streams)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range sourceDbs {
+		if d.skip(input.EpochStart, input.EpochEnd, input.Level) {
+			continue
+		}
+		if d.isOpen() {
+			if list, err := listAggregate(ctx, d, query, input); err != nil {
+				return nil, err
+			} else {
+				rows = sqlog.MergeAggregateRows(rows, list)
+			}
+		} else {
+			closedDbs = append(closedDbs, d)
+		}
+	}
+
+	if len(closedDbs) == 0 {
+		return &sqlog.Output{Aggregate: sqlog.FinalizeAggregateRows(input, rows)}, nil
+	}
+
+	// partial rows, finalized after the scheduled results are merged (see sqlog.MergeAggregateRows)
+	out := &sqlog.Output{Aggregate: rows, Scheduled: true}
+	out.TaskIds = s.schedule(input.EpochStart, input.EpochEnd, closedDbs, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+		if list, err := listAggregate(ctx, db, query, input); err != nil {
+			return err
+		} else {
+			o.Aggregate = list
+			return nil
+		}
+	})
+
+	return out, nil
+}
+
+func listAggregate(ctx context.Context, db *storageDb, query *dbQuery, input *sqlog.AggregateInput) ([]*sqlog.AggregateRow, error) {
+	var list []*sqlog.AggregateRow
+
+	q, args, err := query.of(db.contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	stm, rows, err := db.query(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	defer stm.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			row = &sqlog.AggregateRow{
+				Groups:   make([]any, len(input.GroupBy)),
+				Partials: make([]*sqlog.AggregatePartial, len(input.Aggregations)),
+			}
+			total   int64
+			samples = make([]sql.NullString, len(input.Aggregations))
+			dest    = []any{&row.Start}
+		)
+		for i := range row.Groups {
+			dest = append(dest, &row.Groups[i])
+		}
+		dest = append(dest, &total)
+		for i, a := range input.Aggregations {
+			p := &sqlog.AggregatePartial{}
+			row.Partials[i] = p
+			if a.Field == "" {
+				continue
+			}
+			dest = append(dest, &p.Count, &sql.NullFloat64{}, &sql.NullFloat64{}, &sql.NullFloat64{})
+			if a.IsPercentile() {
+				dest = append(dest, &samples[i])
+			}
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		// sum, min, max
+		offset := 2 + len(row.Groups)
+		for i, a := range input.Aggregations {
+			p := row.Partials[i]
+			if a.Field == "" {
+				p.Count = total
+				continue
+			}
+			p.Sum = dest[offset+1].(*sql.NullFloat64).Float64
+			p.Min = dest[offset+2].(*sql.NullFloat64).Float64
+			p.Max = dest[offset+3].(*sql.NullFloat64).Float64
+			offset += 4
+			if a.IsPercentile() {
+				if samples[i].Valid {
+					if err = json.Unmarshal([]byte(samples[i].String), &p.Samples); err != nil {
+						return nil, err
+					}
+				}
+				offset++
+			}
+		}
+
+		for i, g := range row.Groups {
+			if b, ok := g.([]byte); ok {
+				row.Groups[i] = string(b)
+			}
+		}
+
+		if input.IntervalSec > 0 {
+			row.End = row.Start + int64(input.IntervalSec)
+		} else {
+			row.End = input.EpochEnd
+		}
+
+		list = append(list, row)
+	}
+
+	return list, rows.Err()
+}
+
+// contentColumn returns the SQL of the content of the entries, decrypted when encrypted (see DecryptFunctionName)
+func (s *storage) contentColumn() string {
+	if s.config.KeyProvider != nil {
+		return sqlDecryptContent
+	}
+	return "e.content"
+}
+
+// extractFunction returns the SQL function used to extract the values of the fields of the content type
+func extractFunction(contentType string) string {
+	if contentType == sqlog.ContentTypeMsgpack {
+		return ExtractFunctionName
+	}
+	return "json_extract"
+}
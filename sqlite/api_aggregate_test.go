@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Aggregate(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	var (
+		query string
+		args  []driver.Value
+	)
+	mockQueryHook = func(q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !strings.HasPrefix(q, "SELECT bucket") {
+			return nil, nil, false
+		}
+		query, args = q, a
+		if !strings.Contains(q, "g0") {
+			return nil, nil, false
+		}
+		return []string{"bucket", "g0", "count", "count_v1", "sum_v1", "min_v1", "max_v1", "samples_v1"}, [][]any{
+			{int64(60), []byte("/users"), int64(3), int64(3), 60.0, 10.0, 30.0, []byte("[10,20,30]")},
+			{int64(60), []byte("/orders"), int64(1), int64(0), nil, nil, nil, []byte("[]")},
+		}, true
+	}
+	defer func() { mockQueryHook = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	out, err := storage.Aggregate(&sqlog.AggregateInput{
+		Expr:         "service:api",
+		Level:        []string{"error"},
+		EpochStart:   60,
+		EpochEnd:     time.Now().Unix(),
+		IntervalSec:  60,
+		Aggregations: []sqlog.Aggregation{{Func: "count"}, {Func: "p50", Field: "duration"}},
+		GroupBy:      []string{"route"},
+	})
+	assert.Nil(t, err)
+
+	assert.Contains(t, query, "SELECT bucket, g0, COUNT(*), COUNT(v1), SUM(v1), MIN(v1), MAX(v1), json_group_array(v1) FILTER (WHERE v1 IS NOT NULL AND n1 <= 10000) FROM (")
+	assert.Contains(t, query, "FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY bucket, g0 ORDER BY v1 IS NULL, random()) AS n1 FROM (")
+	assert.Contains(t, query, "SELECT (e.epoch_secs / ?) * ? AS bucket, json_extract(e.content, ?) AS g0, CASE WHEN typeof(json_extract(e.content, ?)) IN ('integer', 'real') THEN json_extract(e.content, ?) END AS v1 FROM entries e")
+	assert.Contains(t, query, "AND (e.level >= 8) AND (json_extract(e.content, ?) GLOB ?))) GROUP BY bucket, g0")
+	assert.Equal(t, []driver.Value{int64(60), int64(60), "$.route", "$.duration", "$.duration", int64(60)}, args[:6])
+
+	assert.Equal(t, 2, len(out.Aggregate))
+	assert.Equal(t, []any{"/orders"}, out.Aggregate[0].Groups)
+	assert.Equal(t, []any{int64(1), nil}, out.Aggregate[0].Values)
+	assert.Equal(t, []any{"/users"}, out.Aggregate[1].Groups)
+	assert.Equal(t, []any{int64(3), 20.0}, out.Aggregate[1].Values)
+	assert.Equal(t, int64(120), out.Aggregate[1].End)
+
+	// without percentiles, no sampling
+	_, err = storage.Aggregate(&sqlog.AggregateInput{
+		EpochStart:   60,
+		EpochEnd:     time.Now().Unix(),
+		Aggregations: []sqlog.Aggregation{{Func: "avg", Field: "duration"}},
+	})
+	assert.Nil(t, err)
+	assert.NotContains(t, query, "ROW_NUMBER()")
+	assert.Contains(t, query, "THEN json_extract(e.content, ?) END AS v0 FROM entries e")
+
+	// only the groups with more entries of each database
+	_, err = storage.Aggregate(&sqlog.AggregateInput{EpochStart: 60, EpochEnd: time.Now().Unix(), Top: 100})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, " GROUP BY bucket ORDER BY COUNT(*) DESC LIMIT ?"))
+	assert.Equal(t, int64(100), args[len(args)-1])
+}
+
+func Test_Sqlite_LevelsFilter(t *testing.T) {
+	assert.Equal(t, "", sqlLevelsFilter(nil))
+	assert.Equal(t, "", sqlLevelsFilter([]string{"debug", "info", "warn", "error"}))
+	assert.Equal(t, "((e.level BETWEEN 4 AND 7) OR e.level >= 8)", sqlLevelsFilter([]string{"warn", "error"}))
+}
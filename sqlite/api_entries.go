@@ -2,6 +2,8 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -14,12 +16,17 @@ var (
 	sqlSeekPageBefore      = []byte("SELECT e.epoch_secs, e.nanos, e.level, e.content FROM entries e WHERE (e.epoch_secs < ? OR (e.epoch_secs = ? AND e.nanos < ?)) ")
 	sqlSeekPageAfterOrder  = []byte(" ORDER BY e.epoch_secs ASC, e.nanos ASC LIMIT ?")
 	sqlSeekPageBeforeOrder = []byte(" ORDER BY e.epoch_secs DESC, e.nanos DESC LIMIT ?")
+	sqlSelectEntry         = "SELECT e.epoch_secs, e.nanos, e.level, e.content FROM entries e WHERE e.epoch_secs = ? AND e.nanos = ?"
 )
 
 func (s *storage) Entries(input *sqlog.EntriesInput) (*sqlog.Output, error) {
+	return s.EntriesContext(context.Background(), input)
+}
+
+// EntriesContext same as Entries, the queries are interrupted when the context is done (see sqlog.StorageWithContext)
+func (s *storage) EntriesContext(ctx context.Context, input *sqlog.EntriesInput) (*sqlog.Output, error) {
 
 	var (
-		levels     map[string]bool
 		expr       = input.Expr
 		direction  = input.Direction
 		epochStart = input.EpochStart
@@ -31,86 +38,61 @@ func (s *storage) Entries(input *sqlog.EntriesInput) (*sqlog.Output, error) {
 		epochStart = time.Now().Unix()
 	}
 
-	if len(input.Level) > 0 {
-		levels = make(map[string]bool)
-		for _, v := range input.Level {
-			levels[v] = true
-		}
-	}
-
-	buf := bytes.NewBuffer(make([]byte, 0, 128))
-
-	if direction == "before" {
-		buf.Write(sqlSeekPageBefore)
-	} else {
-		buf.Write(sqlSeekPageAfter)
+	if maxResult <= 0 {
+		maxResult = 10
 	}
-	args := []any{epochStart, epochStart, nanosStart}
+	maxResult = min(maxResult, 100)
 
-	if len(levels) > 0 && len(levels) != 4 {
-		buf.WriteString(" AND (")
+	// the SQL depends on the content type of each database
+	query, err := s.newDbQuery(func(contentType string) (string, []any, error) {
+		buf := bytes.NewBuffer(make([]byte, 0, 128))
 
-		if levels["error"] && levels["warn"] && levels["info"] {
-			buf.WriteString(" e.level >= 0 ")
+		if direction == "before" {
+			buf.Write(sqlSeekPageBefore)
 		} else {
-			clause := ""
-
-			if levels["error"] && levels["warn"] {
-				buf.WriteString(" e.level >= 4 ")
-				clause = " OR "
-			} else {
-				if levels["error"] {
-					buf.WriteString(" e.level >= 8 ")
-					clause = " OR "
-				} else if levels["warn"] {
-					buf.WriteString(" (e.level BETWEEN 4 AND 7) ")
-					clause = " OR "
-				}
-			}
+			buf.Write(sqlSeekPageAfter)
+		}
+		args := []any{epochStart, epochStart, nanosStart}
 
-			if levels["info"] {
-				buf.WriteString(clause)
-				buf.WriteString(" (e.level BETWEEN 0 AND 3) ")
-				clause = " OR "
-			}
+		if levels := sqlLevelsFilter(input.Level); levels != "" {
+			buf.WriteString(" AND ")
+			buf.WriteString(levels)
+		}
 
-			if levels["debug"] {
-				buf.WriteString(clause)
-				buf.WriteString(" e.level < 0 ")
+		if expr = strings.TrimSpace(expr); expr != "" {
+			if compiled, err := s.exprBuilder(contentType)(expr); err != nil {
+				return "", nil, err
+			} else if compiled.Sql != "" {
+				buf.WriteString(" AND (")
+				buf.WriteString(compiled.Sql)
+				buf.WriteByte(')')
+				args = append(args, compiled.Args...)
 			}
 		}
-		buf.WriteString(") ")
-	}
 
-	if expr = strings.TrimSpace(expr); expr != "" {
-		if compiled, err := s.config.ExprBuilder(expr); err != nil {
-			return nil, err
-		} else if compiled.Sql != "" {
-			buf.WriteString(" AND (")
-			buf.WriteString(compiled.Sql)
-			buf.WriteByte(')')
-			args = append(args, compiled.Args...)
+		if direction == "before" {
+			buf.Write(sqlSeekPageBeforeOrder)
+		} else {
+			buf.Write(sqlSeekPageAfterOrder)
 		}
-	}
+		args = append(args, maxResult)
 
-	if direction == "before" {
-		buf.Write(sqlSeekPageBeforeOrder)
-	} else {
-		buf.Write(sqlSeekPageAfterOrder)
+		return buf.String(), args, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, min(max(maxResult, 10), 100))
 
-	var (
-		sql  = buf.String()
-		list = []any{}
-		dbs  []*storageDb
-	)
+	var dbs []*storageDb
 
-	//fmt.Printf("[sqlog] Entries\nSQL: %s\n\nARG: %v\n", sql, args) // debug
+	sourceDbs, err := s.sourceDbs(input.Source, input.Streams)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, d := range s.dbs {
+	for _, d := range sourceDbs {
 		if direction == "before" {
-			if d.epochStart <= epochStart {
+			if !d.skip(0, epochStart, input.Level) {
 				//  er       |
 				//  ds |--------|
 				//  ds |---|
@@ -118,7 +100,7 @@ func (s *storage) Entries(input *sqlog.EntriesInput) (*sqlog.Output, error) {
 			}
 		} else {
 			// from older to new
-			if d.epochEnd == 0 || d.epochEnd >= epochStart {
+			if !d.skip(epochStart, math.MaxInt64, input.Level) {
 				//  er   |
 				//  ds |--------|
 				//  ds     |---|
@@ -137,42 +119,72 @@ func (s *storage) Entries(input *sqlog.EntriesInput) (*sqlog.Output, error) {
 		})
 	}
 
-	out := &sqlog.Output{}
+	ctx, cancel := s.queryContext(ctx)
+	defer cancel()
 
-	for _, db := range dbs {
-		if db.isOpen() {
-			if ll, err := listEntries(db, sql, args); err != nil {
+	list, err := s.planEntries(ctx, dbs, direction == "before", maxResult, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlog.Output{Entries: list}, nil
+}
+
+// GetEntry fetches the entry on the databases of the epoch, including the attached sources (see sqlog.EntryID)
+func (s *storage) GetEntry(id string) (*sqlog.Output, error) {
+	epoch, nanos, err := sqlog.ParseEntryID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		args      = []any{epoch, nanos}
+		out       = &sqlog.Output{}
+		closedDbs []*storageDb
+	)
+
+	ctx, cancel := s.queryContext(context.Background())
+	defer cancel()
+
+	for _, d := range s.allDbs() {
+		if d.skip(epoch, epoch, nil) {
+			continue
+		}
+		if d.isOpen() {
+			list, err := listEntries(ctx, d, sqlSelectEntry, args)
+			if err != nil {
 				return nil, err
-			} else {
-				list = append(list, ll...)
 			}
-
-			if len(list) >= maxResult {
-				break
+			for _, e := range list {
+				if e.ID == id {
+					out.Entries = append(out.Entries, e)
+					return out, nil
+				}
 			}
 		} else {
-			// schedule more result
-			out.Scheduled = true
-			out.TaskIds = s.schedule([]*storageDb{db}, func(db *storageDb, o *sqlog.Output) error {
-				if list, err := listEntries(db, sql, args); err != nil {
-					return err
-				} else {
-					o.Entries = list
-					return nil
-				}
-			})
-			break
+			closedDbs = append(closedDbs, d)
 		}
 	}
 
-	out.Entries = list
+	if len(closedDbs) > 0 {
+		out.Scheduled = true
+		out.TaskIds = s.schedule(0, 0, closedDbs, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+			if list, err := listEntries(ctx, db, sqlSelectEntry, args); err != nil {
+				return err
+			} else {
+				o.Entries = list
+				return nil
+			}
+		})
+	}
+
 	return out, nil
 }
 
-func listEntries(db *storageDb, sql string, args []any) ([]any, error) {
-	var list []any
+func listEntries(ctx context.Context, db *storageDb, sql string, args []any) ([]*sqlog.EntryView, error) {
+	var list []*sqlog.EntryView
 
-	stm, rows, err := db.query(sql, args)
+	stm, rows, err := db.query(ctx, sql, args)
 	if err != nil {
 		return nil, err
 	}
@@ -184,7 +196,7 @@ func listEntries(db *storageDb, sql string, args []any) ([]any, error) {
 			epoch   int64
 			nanos   int
 			level   int
-			content string
+			content []byte
 		)
 		if err = rows.Scan(&epoch, &nanos, &level, &content); err != nil {
 			rows.Close()
@@ -192,8 +204,17 @@ func listEntries(db *storageDb, sql string, args []any) ([]any, error) {
 			return nil, err
 		}
 
-		list = append(list, []any{epoch, nanos, level, content})
+		if content, err = db.crypt.decrypt(content); err != nil {
+			return nil, err
+		}
+
+		entry, err := sqlog.NewEntryView(epoch, nanos, level, content)
+		if err != nil {
+			return nil, err
+		}
+		entry.Stream = db.stream
+		list = append(list, entry)
 	}
 
-	return list, nil
+	return list, rows.Err()
 }
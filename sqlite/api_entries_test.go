@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_GetEntry(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	var (
+		epoch   = time.Now().Unix()
+		content = []byte(`{"msg":"hello","status":500}`)
+		args    []driver.Value
+	)
+	mockQueryHook = func(q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !strings.HasPrefix(q, sqlSelectEntry) {
+			return nil, nil, false
+		}
+		args = a
+		return []string{"epoch_secs", "nanos", "level", "content"}, [][]any{
+			{epoch, int64(7), int64(8), []byte(`{"msg":"other"}`)},
+			{epoch, int64(7), int64(8), content},
+		}, true
+	}
+	defer func() { mockQueryHook = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	id := sqlog.EntryID(epoch, 7, content)
+	out, err := storage.GetEntry(id)
+	assert.Nil(t, err)
+	assert.Equal(t, []driver.Value{epoch, int64(7)}, args)
+	assert.Equal(t, 1, len(out.Entries))
+
+	entry := out.Entries[0]
+	assert.Equal(t, id, entry.ID)
+	assert.Equal(t, "hello", entry.Message)
+	assert.Equal(t, 500.0, entry.Attrs["status"])
+	assert.Equal(t, content, entry.Content)
+
+	out, err = storage.GetEntry(sqlog.EntryID(epoch, 7, []byte(`{}`)))
+	assert.Nil(t, err)
+	assert.Empty(t, out.Entries)
+
+	_, err = storage.GetEntry("invalid")
+	assert.NotNil(t, err)
+}
+
+func Test_Sqlite_EntriesPlanner(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"test_1000_1999.db", "test_2000_2999.db", "test_3000.db"} {
+		testWriteDb(t, path.Join(dir, name), nil)
+	}
+
+	var (
+		mu      sync.Mutex
+		queried []string
+		rows    = map[string][]int64{
+			"test_3000.db":      {3005, 3003},
+			"test_2000_2999.db": {3004, 2999, 2500}, // out of order entry
+			"test_1000_1999.db": {1999},
+		}
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		name := path.Base(strings.Split(strings.TrimPrefix(dsn, "file:"), "?")[0])
+		mu.Lock()
+		queried = append(queried, name)
+		mu.Unlock()
+
+		var values [][]any
+		for _, epoch := range rows[name] {
+			values = append(values, []any{epoch, int64(0), int64(0), []byte(fmt.Sprintf(`{"msg":"%d"}`, epoch))})
+		}
+		return []string{"epoch_secs", "nanos", "level", "content"}, values, true
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	storage, err := New(&Config{Dir: dir, Prefix: storagePrefix, MaxOpenedDB: 1})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, MaxResult: 4})
+	assert.Nil(t, err)
+	assert.False(t, out.Scheduled)
+
+	var epochs []int64
+	for _, e := range out.Entries {
+		epochs = append(epochs, e.Epoch)
+	}
+	assert.Equal(t, []int64{3005, 3004, 3003, 2999}, epochs)
+
+	// the oldest database can't have entries of the page
+	assert.ElementsMatch(t, []string{"test_3000.db", "test_2000_2999.db"}, queried)
+	assert.Equal(t, 0, len(storage.archives))
+}
+
+func Test_Sqlite_MergeEntries(t *testing.T) {
+	entry := func(epoch int64, nanos int) *sqlog.EntryView {
+		return &sqlog.EntryView{Epoch: epoch, Nanos: nanos}
+	}
+
+	merged := mergeEntries([][]*sqlog.EntryView{
+		{entry(1, 0), entry(3, 5), entry(7, 0)},
+		{entry(2, 0), entry(3, 1)},
+		{},
+	}, false, 10)
+	assert.Equal(t, []*sqlog.EntryView{entry(1, 0), entry(2, 0), entry(3, 1), entry(3, 5), entry(7, 0)}, merged)
+
+	merged = mergeEntries([][]*sqlog.EntryView{
+		{entry(7, 0), entry(3, 5), entry(1, 0)},
+		{entry(3, 1), entry(2, 0)},
+	}, true, 3)
+	assert.Equal(t, []*sqlog.EntryView{entry(7, 0), entry(3, 5), entry(3, 1)}, merged)
+}
+
+func Test_Sqlite_EntriesContentType(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"test_1000_1999.db", "test_3000.db"} {
+		testWriteDb(t, path.Join(dir, name), nil)
+	}
+
+	var (
+		mu      sync.Mutex
+		queries = map[string]string{}
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		name := path.Base(strings.Split(strings.TrimPrefix(dsn, "file:"), "?")[0])
+		if name != "test_1000_1999.db" && !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		switch {
+		case q == sqlHasMeta:
+			return []string{"count"}, [][]any{{int64(1)}}, true
+		case q == sqlSelectMetaValues:
+			// archive encoded with MessagePack
+			return []string{"key", "value"}, [][]any{{"content_type", sqlog.ContentTypeMsgpack}}, true
+		case bytes.HasPrefix([]byte(q), sqlSeekPageBefore):
+			mu.Lock()
+			queries[name] = q
+			mu.Unlock()
+			return []string{"epoch_secs", "nanos", "level", "content"}, nil, true
+		}
+		return nil, nil, false
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	storage, err := New(&Config{Dir: dir, Prefix: storagePrefix})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	_, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, MaxResult: 10, Expr: "msg:hello"})
+	assert.Nil(t, err)
+
+	// the expression is built by the content type of each database
+	assert.Contains(t, queries["test_3000.db"], "json_extract(e.content, ?)")
+	assert.Contains(t, queries["test_1000_1999.db"], "sqlog_extract(e.content, ?)")
+	assert.NotContains(t, queries["test_1000_1999.db"], "json_extract")
+}
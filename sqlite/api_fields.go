@@ -0,0 +1,270 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/nidorx/sqlog"
+)
+
+var (
+	sqlFieldsTree   = []byte("SELECT t.fullkey, t.type, COUNT(*) FROM (")
+	sqlFieldsSample = []byte("SELECT e.content FROM entries e WHERE e.epoch_secs >= ? AND e.epoch_secs < ?")
+	sqlFieldsOrder  = []byte(" ORDER BY e.epoch_secs DESC, e.nanos DESC LIMIT ?")
+	sqlFieldsGroup  = []byte(") s, json_tree(s.content) t WHERE t.parent IS NOT NULL AND t.type != 'null' AND t.fullkey NOT LIKE '%]%' GROUP BY t.fullkey, t.type")
+
+	// fieldKey is the pattern of the keys listed, keys with dots or other characters can't be used as fields on the
+	// filters and aggregations (see sqlog.AggregateInput.GroupBy)
+	fieldKey = regexp.MustCompile(`^[\w\-]+$`)
+)
+
+// Fields lists the attributes of a sample of the entries of each database, using json_tree.
+//
+//	SELECT t.fullkey, t.type, COUNT(*) FROM (
+//		SELECT e.content FROM entries e WHERE e.epoch_secs >= ? AND e.epoch_secs < ? AND (...) ORDER BY e.epoch_secs DESC, e.nanos DESC LIMIT ?
+//	) s, json_tree(s.content) t WHERE t.parent IS NOT NULL AND ... GROUP BY t.fullkey, t.type
+//
+// Array items are ignored, as are the keys with characters other than letters, digits, "_" and "-" (ex. "a.b"),
+// and their children. When the content is msgpack or encrypted, the sample is decoded in Go.
+func (s *storage) Fields(input *sqlog.FieldsInput) (*sqlog.Output, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the SQL depends on the content type of each database, msgpack and encrypted content is decoded in Go
+	query, err := s.newDbQuery(func(contentType string) (string, []any, error) {
+		var (
+			decode = s.decodeFields(contentType)
+			buf    = bytes.NewBuffer(make([]byte, 0, 256))
+			args   = []any{input.EpochStart, input.EpochEnd}
+		)
+
+		if !decode {
+			buf.Write(sqlFieldsTree)
+		}
+		buf.Write(sqlFieldsSample)
+
+		if levels := sqlLevelsFilter(input.Level); levels != "" {
+			buf.WriteString(" AND ")
+			buf.WriteString(levels)
+		}
+
+		if expr := strings.TrimSpace(input.Expr); expr != "" {
+			if compiled, err := s.exprBuilder(contentType)(expr); err != nil {
+				return "", nil, err
+			} else if compiled.Sql != "" {
+				buf.WriteString(" AND (")
+				buf.WriteString(compiled.Sql)
+				buf.WriteByte(')')
+				args = append(args, compiled.Args...)
+			}
+		}
+
+		buf.Write(sqlFieldsOrder)
+		args = append(args, input.MaxResult)
+
+		if !decode {
+			buf.Write(sqlFieldsGroup)
+		}
+
+		return buf.String(), args, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		fields    = []*sqlog.Field{}
+		closedDbs []*storageDb
+	)
+
+	ctx, cancel := s.queryContext(context.Background())
+	defer cancel()
+
+	sourceDbs, err := s.sourceDbs(input.Source, input.Streams)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range sourceDbs {
+		if d.skip(input.EpochStart, input.EpochEnd, input.Level) {
+			continue
+		}
+		if d.isOpen() {
+			if list, err := listFields(ctx, d, query, s.decodeFields(d.contentType)); err != nil {
+				return nil, err
+			} else {
+				fields = sqlog.MergeFields(fields, list)
+			}
+		} else {
+			closedDbs = append(closedDbs, d)
+		}
+	}
+
+	out := &sqlog.Output{Fields: fields}
+
+	if len(closedDbs) > 0 {
+		// schedule more result (partial fields, see sqlog.MergeFields)
+		out.Scheduled = true
+		out.TaskIds = s.schedule(input.EpochStart, input.EpochEnd, closedDbs, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+			if list, err := listFields(ctx, db, query, s.decodeFields(db.contentType)); err != nil {
+				return err
+			} else {
+				o.Fields = list
+				return nil
+			}
+		})
+	}
+
+	return out, nil
+}
+
+func listFields(ctx context.Context, db *storageDb, query *dbQuery, decode bool) ([]*sqlog.Field, error) {
+	q, args, err := query.of(db.contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	stm, rows, err := db.query(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	defer stm.Close()
+	defer rows.Close()
+
+	var list []*sqlog.Field
+
+	if decode {
+		counts := map[sqlog.Field]int64{}
+		for rows.Next() {
+			var content []byte
+			if err = rows.Scan(&content); err != nil {
+				return nil, err
+			}
+			if content, err = db.crypt.decrypt(content); err != nil {
+				return nil, err
+			}
+			if value, err := decodeContent(content); err == nil {
+				if m, ok := value.(map[string]any); ok {
+					walkFields("", m, counts)
+				}
+			}
+		}
+		for f, count := range counts {
+			list = sqlog.MergeFields(list, []*sqlog.Field{{Name: f.Name, Type: f.Type, Count: count}})
+		}
+		return list, rows.Err()
+	}
+
+	for rows.Next() {
+		var (
+			fullkey string
+			kind    string
+			count   int64
+		)
+		if err = rows.Scan(&fullkey, &kind, &count); err != nil {
+			return nil, err
+		}
+		name, ok := fieldName(fullkey)
+		if !ok {
+			continue
+		}
+		list = sqlog.MergeFields(list, []*sqlog.Field{{
+			Name:  name,
+			Type:  jsonTreeFieldType(kind),
+			Count: count,
+		}})
+	}
+	return list, rows.Err()
+}
+
+// fieldName converts the fullkey of json_tree ($.a.b or $."x-y".z, keys with special characters are quoted)
+// to the name of the field. Returns false when a key of the path doesn't match fieldKey.
+func fieldName(fullkey string) (string, bool) {
+	var (
+		keys []string
+		path = strings.TrimPrefix(fullkey, "$")
+	)
+	for path != "" {
+		if path[0] != '.' {
+			return "", false
+		}
+		path = path[1:]
+
+		var key string
+		if strings.HasPrefix(path, `"`) {
+			end := strings.IndexByte(path[1:], '"')
+			if end < 0 {
+				return "", false
+			}
+			key, path = path[1:end+1], path[end+2:]
+		} else if end := strings.IndexByte(path, '.'); end >= 0 {
+			key, path = path[:end], path[end:]
+		} else {
+			key, path = path, ""
+		}
+
+		if !fieldKey.MatchString(key) {
+			return "", false
+		}
+		keys = append(keys, key)
+	}
+	return strings.Join(keys, "."), len(keys) > 0
+}
+
+// decodeFields checks if the fields of the content type are listed in Go, json_tree only reads JSON text
+func (s *storage) decodeFields(contentType string) bool {
+	return contentType == sqlog.ContentTypeMsgpack || s.config.KeyProvider != nil
+}
+
+// jsonTreeFieldType converts the json_tree type (null, true, false, integer, real, text, array, object)
+func jsonTreeFieldType(kind string) string {
+	switch kind {
+	case "text":
+		return sqlog.FieldString
+	case "integer", "real":
+		return sqlog.FieldNumber
+	case "true", "false":
+		return sqlog.FieldBool
+	default:
+		return sqlog.FieldObject
+	}
+}
+
+// decodeContent decodes the JSON or MessagePack content into Go values
+func decodeContent(content []byte) (any, error) {
+	if sqlog.IsMsgpack(content) {
+		return sqlog.DecodeMsgpack(content)
+	}
+	var value any
+	err := json.Unmarshal(content, &value)
+	return value, err
+}
+
+// walkFields counts the attributes of the decoded content, same rules as the json_tree query
+func walkFields(prefix string, m map[string]any, counts map[sqlog.Field]int64) {
+	for key, value := range m {
+		name := prefix + key
+		if !fieldKey.MatchString(key) || value == nil {
+			continue
+		}
+		f := sqlog.Field{Name: name}
+		switch v := value.(type) {
+		case string:
+			f.Type = sqlog.FieldString
+		case bool:
+			f.Type = sqlog.FieldBool
+		case int64, uint64, float64:
+			f.Type = sqlog.FieldNumber
+		case map[string]any:
+			f.Type = sqlog.FieldObject
+			walkFields(name+".", v, counts)
+		default:
+			f.Type = sqlog.FieldObject
+		}
+		counts[f]++
+	}
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Fields(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	var (
+		query string
+		args  []driver.Value
+	)
+	mockQueryHook = func(q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !strings.HasPrefix(q, "SELECT t.fullkey") {
+			return nil, nil, false
+		}
+		query, args = q, a
+		return []string{"fullkey", "type", "count"}, [][]any{
+			{"$.msg", "text", int64(10)},
+			{"$.ok", "true", int64(3)},
+			{"$.ok", "false", int64(2)},
+			{"$.http", "object", int64(4)},
+			{"$.http.status", "integer", int64(4)},
+			{`$."x-id"`, "text", int64(2)},
+			{`$."a.b"`, "integer", int64(1)},
+			{`$."a.b".c`, "integer", int64(1)},
+		}, true
+	}
+	defer func() { mockQueryHook = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	out, err := storage.Fields(&sqlog.FieldsInput{Expr: "service:api", EpochStart: 60, EpochEnd: time.Now().Unix(), MaxResult: 500})
+	assert.Nil(t, err)
+
+	assert.Contains(t, query, "SELECT t.fullkey, t.type, COUNT(*) FROM (SELECT e.content FROM entries e WHERE e.epoch_secs >= ? AND e.epoch_secs < ? AND (json_extract(e.content, ?) GLOB ?) ORDER BY")
+	assert.Contains(t, query, "LIMIT ?) s, json_tree(s.content) t WHERE")
+	assert.Equal(t, driver.Value(int64(500)), args[len(args)-1])
+
+	assert.Equal(t, []*sqlog.Field{
+		{Name: "http", Type: sqlog.FieldObject, Count: 4},
+		{Name: "http.status", Type: sqlog.FieldNumber, Count: 4},
+		{Name: "msg", Type: sqlog.FieldString, Count: 10},
+		{Name: "ok", Type: sqlog.FieldBool, Count: 5},
+		{Name: "x-id", Type: sqlog.FieldString, Count: 2},
+	}, out.Fields)
+}
+
+func Test_Sqlite_FieldName(t *testing.T) {
+	for fullkey, expected := range map[string]string{
+		"$.msg":              "msg",
+		"$.http.status":      "http.status",
+		`$."x-id"`:           "x-id",
+		`$.req."user-agent"`: "req.user-agent",
+		`$."a.b"`:            "",
+		`$."a.b".c`:          "",
+		`$."a b"`:            "",
+		`$.tags[0]`:          "",
+		"$":                  "",
+	} {
+		name, ok := fieldName(fullkey)
+		assert.Equal(t, expected, name, fullkey)
+		assert.Equal(t, expected != "", ok, fullkey)
+	}
+}
+
+func Test_Sqlite_WalkFields(t *testing.T) {
+	counts := map[sqlog.Field]int64{}
+	walkFields("", map[string]any{"msg": "a", "n": int64(1), "tags": []any{"x"}, "nil": nil, "http": map[string]any{"ok": true}, "a.b": map[string]any{"c": 1.0}, "x-id": "1"}, counts)
+	walkFields("", map[string]any{"msg": "b"}, counts)
+
+	assert.Equal(t, map[sqlog.Field]int64{
+		{Name: "msg", Type: sqlog.FieldString}:   2,
+		{Name: "n", Type: sqlog.FieldNumber}:     1,
+		{Name: "tags", Type: sqlog.FieldObject}:  1,
+		{Name: "http", Type: sqlog.FieldObject}:  1,
+		{Name: "http.ok", Type: sqlog.FieldBool}: 1,
+		{Name: "x-id", Type: sqlog.FieldString}:  1,
+	}, counts)
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"strings"
 	"time"
 
@@ -33,7 +34,6 @@ var (
 func (s *storage) Ticks(input *sqlog.TicksInput) (*sqlog.Output, error) {
 
 	var (
-		levels      map[string]bool
 		expr        = input.Expr
 		epochEnd    = input.EpochEnd
 		intervalSec = input.IntervalSec
@@ -44,91 +44,63 @@ func (s *storage) Ticks(input *sqlog.TicksInput) (*sqlog.Output, error) {
 		epochEnd = time.Now().Unix()
 	}
 
-	if len(input.Level) > 0 {
-		levels = make(map[string]bool)
-		for _, v := range input.Level {
-			levels[v] = true
+	// the SQL depends on the content type of each database
+	query, err := s.newDbQuery(func(contentType string) (string, []any, error) {
+		buf := bytes.NewBuffer(make([]byte, 0, 128))
+		buf.Write(sqlTicksInit)
+
+		args := []any{
+			maxResult,
+			epochEnd,
+			intervalSec,
+			epochEnd,
+			intervalSec,
+			intervalSec,
+			maxResult,
 		}
-	}
-
-	buf := bytes.NewBuffer(make([]byte, 0, 128))
-	buf.Write(sqlTicksInit)
-
-	args := []any{
-		maxResult,
-		epochEnd,
-		intervalSec,
-		epochEnd,
-		intervalSec,
-		intervalSec,
-		maxResult,
-	}
-
-	clause := " WHERE "
-
-	if len(levels) > 0 && len(levels) != 4 {
-		buf.WriteString(clause)
-		buf.WriteString(" (")
 
-		if levels["error"] && levels["warn"] && levels["info"] {
-			buf.WriteString(" e.level >= 0 ")
-		} else {
-			clause = ""
-
-			if levels["error"] && levels["warn"] {
-				buf.WriteString(" e.level >= 4 ")
-				clause = " OR "
-			} else {
-				if levels["error"] {
-					buf.WriteString(" e.level >= 8 ")
-					clause = " OR "
-				} else if levels["warn"] {
-					buf.WriteString(" (e.level BETWEEN 4 AND 7) ")
-					clause = " OR "
-				}
-			}
+		clause := " WHERE "
 
-			if levels["info"] {
-				buf.WriteString(clause)
-				buf.WriteString(" (e.level BETWEEN 0 AND 3) ")
-				clause = " OR "
-			}
+		if levels := sqlLevelsFilter(input.Level); levels != "" {
+			buf.WriteString(clause)
+			buf.WriteString(levels)
+			buf.WriteString(" ")
+			clause = " AND "
+		}
 
-			if levels["debug"] {
+		if expr = strings.TrimSpace(expr); expr != "" {
+			if compiled, err := s.exprBuilder(contentType)(expr); err != nil {
+				return "", nil, err
+			} else if compiled.Sql != "" {
 				buf.WriteString(clause)
-				buf.WriteString(" e.level < 0 ")
+				buf.WriteString(compiled.Sql)
+				buf.WriteString(" ")
+				args = append(args, compiled.Args...)
 			}
 		}
-		buf.WriteString(") ")
+		buf.Write(sqlTicksEnd)
 
-		clause = " AND "
-	}
-
-	if expr = strings.TrimSpace(expr); expr != "" {
-		if compiled, err := s.config.ExprBuilder(expr); err != nil {
-			return nil, err
-		} else if compiled.Sql != "" {
-			buf.WriteString(clause)
-			buf.WriteString(compiled.Sql)
-			buf.WriteString(" ")
-			args = append(args, compiled.Args...)
-		}
+		return buf.String(), args, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	buf.Write(sqlTicksEnd)
 
 	var (
-		sql         = buf.String()
-		epochStart  = epochEnd - int64((intervalSec * maxResult))
-		dbs         []*storageDb
-		closedDbs   []*storageDb
-		list        []*sqlog.Tick
-		tickByIndex = map[int]*sqlog.Tick{}
+		epochStart = epochEnd - int64((intervalSec * maxResult))
+		dbs        []*storageDb
+		closedDbs  []*storageDb
+		list       []*sqlog.Tick
+		byIndex    = map[int]*sqlog.Tick{}
 	)
 
-	// fmt.Printf("[sqlog] Ticks\nSQL: %s\n\nARG: %v\n", sql, args) // debug
+	sourceDbs, err := s.sourceDbs(input.Source, input.Streams)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, d := range s.dbs {
-		if epochEnd < d.epochStart || (d.epochEnd != 0 && d.epochEnd < epochStart) {
+	for _, d := range sourceDbs {
+		if d.skip(epochStart, epochEnd, input.Level) {
 			//  es   |---|
 			//  es                 |---|
 			//  ds         |----|
@@ -137,22 +109,15 @@ func (s *storage) Ticks(input *sqlog.TicksInput) (*sqlog.Output, error) {
 		dbs = append(dbs, d)
 	}
 
+	ctx, cancel := s.queryContext(context.Background())
+	defer cancel()
+
 	for _, db := range dbs {
 		if db.isOpen() {
-			if ll, err := listTicks(db, sql, args); err != nil {
+			if ll, err := listTicks(ctx, db, query); err != nil {
 				return nil, err
 			} else {
-				for _, t := range ll {
-					if o, exists := tickByIndex[t.Index]; exists {
-						t.Count += o.Count
-						t.Debug += o.Debug
-						t.Info += o.Info
-						t.Warn += o.Warn
-						t.Error += o.Error
-					} else {
-						list = append(list, t)
-					}
-				}
+				list = mergeTicks(list, byIndex, ll)
 			}
 		} else {
 			closedDbs = append(closedDbs, db)
@@ -166,11 +131,11 @@ func (s *storage) Ticks(input *sqlog.TicksInput) (*sqlog.Output, error) {
 	if len(closedDbs) > 0 {
 		// schedule more result
 		out.Scheduled = true
-		out.TaskIds = s.schedule(closedDbs, func(db *storageDb, o *sqlog.Output) error {
-			if list, err := listTicks(db, sql, args); err != nil {
+		out.TaskIds = s.schedule(epochStart, epochEnd, closedDbs, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+			if list, err := listTicks(ctx, db, query); err != nil {
 				return err
 			} else {
-				o.Ticks = list
+				o.Ticks = mergeTicks(nil, map[int]*sqlog.Tick{}, list)
 				return nil
 			}
 		})
@@ -179,10 +144,33 @@ func (s *storage) Ticks(input *sqlog.TicksInput) (*sqlog.Output, error) {
 	return out, nil
 }
 
-func listTicks(db *storageDb, sql string, args []any) ([]*sqlog.Tick, error) {
+// mergeTicks appends the ticks to the list, summing the counts of the ticks with the same index (the live databases
+// of the streams cover the same time range)
+func mergeTicks(list []*sqlog.Tick, byIndex map[int]*sqlog.Tick, ticks []*sqlog.Tick) []*sqlog.Tick {
+	for _, t := range ticks {
+		if o, exists := byIndex[t.Index]; exists {
+			o.Count += t.Count
+			o.Debug += t.Debug
+			o.Info += t.Info
+			o.Warn += t.Warn
+			o.Error += t.Error
+		} else {
+			byIndex[t.Index] = t
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func listTicks(ctx context.Context, db *storageDb, query *dbQuery) ([]*sqlog.Tick, error) {
 	var list []*sqlog.Tick
 
-	stm, rows, err := db.query(sql, args)
+	q, args, err := query.of(db.contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	stm, rows, err := db.query(ctx, q, args)
 	if err != nil {
 		return nil, err
 	}
@@ -197,5 +185,5 @@ func listTicks(db *storageDb, sql string, args []any) ([]*sqlog.Tick, error) {
 		list = append(list, t)
 	}
 
-	return list, nil
+	return list, rows.Err()
 }
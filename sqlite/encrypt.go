@@ -0,0 +1,248 @@
+package sqlite
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/nidorx/sqlog"
+)
+
+// DecryptFunctionName is the name of the SQL function used by the expression builder and the aggregations
+// when the content is encrypted (Config.KeyProvider).
+//
+// The function must be registered in the SQLite driver with the same keys of the storage. Ex. (github.com/mattn/go-sqlite3)
+//
+//	keys := sqlite.NewStaticKeyProvider("2024-10", map[string][]byte{"2024-10": key})
+//
+//	sql.Register("sqlite3_sqlog", &sqlite3.SQLiteDriver{
+//		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+//			return conn.RegisterFunc(sqlite.DecryptFunctionName, sqlite.NewDecryptFunction(keys), true)
+//		},
+//	})
+//
+//	storage, _ := sqlite.New(&sqlite.Config{Driver: "sqlite3_sqlog", KeyProvider: keys})
+const DecryptFunctionName = "sqlog_decrypt"
+
+// sqlDecryptContent is the SQL of the decrypted content of the entries
+const sqlDecryptContent = DecryptFunctionName + "(e.content)"
+
+// encryptedMagic identifies the encrypted content, JSON content starts with '{' and MessagePack with a map header
+var encryptedMagic = []byte{0x00, 's', 'q', 'e'}
+
+var errEncryptedContent = errors.New("[sqlog] invalid encrypted content")
+
+// KeyProvider provides the master keys (AES-128, AES-192 or AES-256) of the encryption at rest, by id.
+//
+// The entries are encrypted with a data key (AES-256-GCM) generated by the storage, saved with each entry encrypted
+// by the current master key (envelope encryption). Rotating the current key only changes the new entries, the old
+// ones are decrypted by the id of the key that encrypted them, so the previous keys must be kept while there are
+// databases (including backups and archives) encrypted with them.
+//
+// Each encrypted entry grows by 93 bytes plus the length of the key id: the header of the data key (magic, key id,
+// nonce, wrapped key and tag) and the nonce and tag of the content.
+type KeyProvider interface {
+	// CurrentKey returns the id and the key used to encrypt the new entries
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key by id
+	Key(id string) ([]byte, error)
+}
+
+// staticKeyProvider is a KeyProvider with fixed keys
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider creates a KeyProvider with the keys by id, the current is used to encrypt the new entries
+func NewStaticKeyProvider(current string, keys map[string][]byte) *staticKeyProvider {
+	return &staticKeyProvider{current: current, keys: keys}
+}
+
+func (p *staticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.current)
+	return p.current, key, err
+}
+
+func (p *staticKeyProvider) Key(id string) ([]byte, error) {
+	if key, exists := p.keys[id]; exists {
+		return key, nil
+	}
+	return nil, fmt.Errorf("[sqlog] unknown key %q", id)
+}
+
+// encryptor encrypts the content of the entries with AES-GCM.
+//
+// Encrypted content: magic | len(id) | id | nonce | wrapped data key | nonce | ciphertext
+type encryptor struct {
+	keys   KeyProvider
+	mu     sync.Mutex
+	keyId  string      // Id of the master key of the current data key
+	header []byte      // Header of the current data key (magic, key id and wrapped data key)
+	aead   cipher.AEAD // Current data key
+	cache  sync.Map    // Data keys by header, used to decrypt
+}
+
+// newEncryptor creates the encryptor of the keys, nil when there are no keys (content is not encrypted)
+func newEncryptor(keys KeyProvider) *encryptor {
+	if keys == nil {
+		return nil
+	}
+	return &encryptor{keys: keys}
+}
+
+// current returns the data key of the current master key, a new data key is generated when the key is rotated
+func (e *encryptor) current() ([]byte, cipher.AEAD, error) {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(id) > 255 {
+		return nil, nil, errors.New("[sqlog] key id is too long")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.aead != nil && e.keyId == id {
+		return e.header, e.aead, nil
+	}
+
+	master, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := append(append([]byte{}, encryptedMagic...), byte(len(id)))
+	header = append(header, id...)
+	if header, err = seal(master, header, dataKey, []byte(id)); err != nil {
+		return nil, nil, err
+	}
+
+	e.keyId = id
+	e.header = header
+	e.aead = aead
+	e.cache.Store(string(header), aead)
+	return header, aead, nil
+}
+
+// encrypt encrypts the content with the current data key
+func (e *encryptor) encrypt(content []byte) ([]byte, error) {
+	header, aead, err := e.current()
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, append(make([]byte, 0, len(header)+len(content)+64), header...), content, nil)
+}
+
+// decrypt decrypts the content, content that is not encrypted is returned as is
+func (e *encryptor) decrypt(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, encryptedMagic) {
+		return content, nil
+	}
+	if e == nil {
+		return nil, errors.New("[sqlog] encrypted content, KeyProvider is required")
+	}
+
+	aead, rest, err := e.dataKey(content)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(aead, rest, nil)
+}
+
+// dataKey returns the data key of the header of the content, and the rest of the content
+func (e *encryptor) dataKey(content []byte) (cipher.AEAD, []byte, error) {
+	offset := len(encryptedMagic) + 1
+	if len(content) < offset {
+		return nil, nil, errEncryptedContent
+	}
+	idEnd := offset + int(content[offset-1])
+	// nonce (12), data key (32) and tag (16)
+	headerEnd := idEnd + 12 + 32 + 16
+	if len(content) < headerEnd {
+		return nil, nil, errEncryptedContent
+	}
+
+	header := content[:headerEnd]
+	if aead, exists := e.cache.Load(string(header)); exists {
+		return aead.(cipher.AEAD), content[headerEnd:], nil
+	}
+
+	id := string(content[offset:idEnd])
+	key, err := e.keys.Key(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	master, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey, err := unseal(master, content[idEnd:headerEnd], []byte(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.cache.Store(string(header), aead)
+	return aead, content[headerEnd:], nil
+}
+
+// NewDecryptFunction creates the implementation of the SQL function "sqlog_decrypt(content)" (see DecryptFunctionName).
+// Returns the decrypted content, as text when JSON (so it works with json_extract) and as blob when MessagePack.
+func NewDecryptFunction(keys KeyProvider) func(content []byte) (any, error) {
+	e := newEncryptor(keys)
+	return func(content []byte) (any, error) {
+		plain, err := e.decrypt(content)
+		if err != nil {
+			return nil, err
+		}
+		if sqlog.IsMsgpack(plain) {
+			return plain, nil
+		}
+		return string(plain), nil
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal appends the random nonce and the ciphertext to dst
+func seal(aead cipher.AEAD, dst, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, additionalData), nil
+}
+
+// unseal decrypts the nonce and ciphertext written by seal
+func unseal(aead cipher.AEAD, data, additionalData []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errEncryptedContent
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
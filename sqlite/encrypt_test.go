@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Encrypt(t *testing.T) {
+	keys := NewStaticKeyProvider("k1", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	})
+	e := newEncryptor(keys)
+	content := []byte(`{"msg":"secret","user":{"id":7}}`)
+
+	encrypted, err := e.encrypt(content)
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, encryptedMagic))
+	assert.False(t, bytes.Contains(encrypted, []byte("secret")))
+
+	// the data key is reused until the rotation
+	again, err := e.encrypt(content)
+	assert.Nil(t, err)
+	assert.NotEqual(t, encrypted, again)
+	assert.Equal(t, encrypted[:len(e.header)], again[:len(e.header)])
+
+	// rotated, the previous entries are decrypted by the id of the key
+	keys.current = "k2"
+	rotated, err := e.encrypt(content)
+	assert.Nil(t, err)
+	assert.NotEqual(t, encrypted[:len(e.header)], rotated[:len(e.header)])
+
+	other := newEncryptor(keys)
+	for _, data := range [][]byte{encrypted, again, rotated} {
+		plain, err := other.decrypt(data)
+		assert.Nil(t, err)
+		assert.Equal(t, content, plain)
+	}
+
+	// content not encrypted
+	plain, err := other.decrypt(content)
+	assert.Nil(t, err)
+	assert.Equal(t, content, plain)
+
+	var disabled *encryptor
+	_, err = disabled.decrypt(encrypted)
+	assert.ErrorContains(t, err, "KeyProvider is required")
+
+	_, err = newEncryptor(NewStaticKeyProvider("k1", nil)).decrypt(encrypted)
+	assert.ErrorContains(t, err, `unknown key "k1"`)
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = other.decrypt(tampered)
+	assert.NotNil(t, err)
+
+	_, err = other.decrypt(encrypted[:10])
+	assert.Equal(t, errEncryptedContent, err)
+
+	// SQL function, text for JSON and blob for msgpack
+	decrypt := NewDecryptFunction(keys)
+	value, err := decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), value)
+
+	msgpack := []byte{0x81, 0xa1, 'a', 0x01}
+	encrypted, err = e.encrypt(msgpack)
+	assert.Nil(t, err)
+	value, err = decrypt(encrypted)
+	assert.Nil(t, err)
+	assert.Equal(t, msgpack, value)
+}
+
+func Test_Sqlite_Encryption(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	_, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, KeyProvider: NewStaticKeyProvider("k1", map[string][]byte{
+		"k1": []byte("short"),
+	})})
+	assert.ErrorContains(t, err, "invalid KeyProvider")
+
+	// custom filters would run over the encrypted content
+	_, err = New(&Config{Dir: storageDir, Prefix: storagePrefix, ExprBuilder: ExpBuilderFn, KeyProvider: NewStaticKeyProvider("k1", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+	})})
+	assert.ErrorContains(t, err, "ExprBuilder is not supported with KeyProvider")
+
+	keys := NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, KeyProvider: keys})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	chunk := sqlog.NewChunk(10)
+	chunk.Put(&sqlog.Entry{Time: time.Now(), Level: 0, Content: []byte(`{"msg":"secret"}`)})
+	assert.Nil(t, storage.Flush(chunk))
+
+	wal, err := os.ReadFile(storage.liveDbs[0].filePath + "-wal")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(wal), "secret")
+
+	// the filters use the decrypted content
+	expr, err := storage.exprBuilder(sqlog.ContentTypeJSON)("msg:secret")
+	assert.Nil(t, err)
+	assert.Contains(t, expr.Sql, "json_extract(sqlog_decrypt(e.content), ?)")
+
+	encrypted, err := storage.crypt.encrypt([]byte(`{"msg":"secret"}`))
+	assert.Nil(t, err)
+
+	var queries []string
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		queries = append(queries, q)
+		if !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		return []string{"epoch_secs", "nanos", "level", "content"}, [][]any{
+			{time.Now().Unix(), int64(0), int64(0), encrypted},
+		}, true
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", MaxResult: 10, Expr: "msg:secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Entries))
+	assert.Equal(t, "secret", out.Entries[0].Message)
+
+	queries = nil
+	_, err = storage.Aggregate(&sqlog.AggregateInput{
+		EpochStart: time.Now().Unix() - 60,
+		EpochEnd:   time.Now().Unix() + 60,
+		GroupBy:    []string{"msg"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(queries))
+	assert.Contains(t, queries[0], "json_extract(sqlog_decrypt(e.content), ?) AS g0")
+}
@@ -7,13 +7,30 @@ import (
 )
 
 var (
-	ExpBuilderFn = sqlog.NewExprBuilder(func(expression string) (sqlog.ExprBuilder[*Expr], string) {
+	ExpBuilderFn = NewExprBuilderFn("json_extract")
+
+	// MsgpackExpBuilderFn expression builder for MessagePack content, uses the "sqlog_extract" SQL function
+	MsgpackExpBuilderFn = NewExprBuilderFn(ExtractFunctionName)
+)
+
+// NewExprBuilderFn creates an expression builder that uses the SQL function extract(content, path)
+// to get the values of the fields.
+func NewExprBuilderFn(extract string) func(expression string) (*Expr, error) {
+	return newExprBuilderFn(extract, "e.content")
+}
+
+// newExprBuilderFn creates an expression builder that extracts the values of the fields from the content SQL
+// (Ex. "sqlog_decrypt(e.content)" when the content is encrypted)
+func newExprBuilderFn(extract, content string) func(expression string) (*Expr, error) {
+	return sqlog.NewExprBuilder(func(expression string) (sqlog.ExprBuilder[*Expr], string) {
 		return &SqliteExprBuilder{
-			args: []any{},
-			sql:  bytes.NewBuffer(make([]byte, 0, 512)),
+			args:    []any{},
+			sql:     bytes.NewBuffer(make([]byte, 0, 512)),
+			extract: extract,
+			content: content,
 		}, expression
 	})
-)
+}
 
 type Expr struct {
 	Sql  string
@@ -21,9 +38,19 @@ type Expr struct {
 }
 
 type SqliteExprBuilder struct {
-	args   []any
-	sql    *bytes.Buffer
-	groups []*bytes.Buffer
+	args    []any
+	sql     *bytes.Buffer
+	groups  []*bytes.Buffer
+	extract string // SQL function used to extract the field value (Ex. json_extract)
+	content string // SQL of the content (Ex. e.content)
+}
+
+// field writes the extraction of the field value, Ex. "json_extract(e.content, ?)"
+func (s *SqliteExprBuilder) field() {
+	s.sql.WriteString(s.extract)
+	s.sql.WriteByte('(')
+	s.sql.WriteString(s.content)
+	s.sql.WriteString(", ?)")
 }
 
 func (s *SqliteExprBuilder) Build() *Expr {
@@ -64,14 +91,17 @@ func (s *SqliteExprBuilder) Text(field, term string, isSequence, isWildcard bool
 	field = "$." + field
 	if isSequence {
 		if isWildcard {
-			s.sql.WriteString("json_extract(e.content, ?) GLOB ?")
+			s.field()
+			s.sql.WriteString(" GLOB ?")
 			s.args = append(s.args, field, term)
 		} else {
-			s.sql.WriteString("json_extract(e.content, ?) = ?")
+			s.field()
+			s.sql.WriteString(" = ?")
 			s.args = append(s.args, field, term)
 		}
 	} else {
-		s.sql.WriteString("json_extract(e.content, ?) GLOB ?")
+		s.field()
+		s.sql.WriteString(" GLOB ?")
 		if isWildcard {
 			s.args = append(s.args, field, term)
 		} else {
@@ -82,7 +112,8 @@ func (s *SqliteExprBuilder) Text(field, term string, isSequence, isWildcard bool
 
 func (s *SqliteExprBuilder) TextIn(field string, values []string) {
 	s.args = append(s.args, "$."+field)
-	s.sql.WriteString("json_extract(e.content, ?) IN (")
+	s.field()
+	s.sql.WriteString(" IN (")
 	for i, v := range values {
 		if i > 0 {
 			s.sql.WriteByte(',')
@@ -94,19 +125,25 @@ func (s *SqliteExprBuilder) TextIn(field string, values []string) {
 }
 
 func (s *SqliteExprBuilder) Number(field, condition string, value float64) {
-	s.sql.WriteString("CAST(json_extract(e.content, ?) AS NUMERIC) ")
+	s.sql.WriteString("CAST(")
+	s.field()
+	s.sql.WriteString(" AS NUMERIC) ")
 	s.sql.WriteString(condition)
 	s.sql.WriteString(" ? ")
 	s.args = append(s.args, "$."+field, value)
 }
 
 func (s *SqliteExprBuilder) Between(field string, x, y float64) {
-	s.sql.WriteString("CAST(json_extract(e.content, ?) AS NUMERIC) BETWEEN ? AND ?")
+	s.sql.WriteString("CAST(")
+	s.field()
+	s.sql.WriteString(" AS NUMERIC) BETWEEN ? AND ?")
 	s.args = append(s.args, "$."+field, x, y)
 }
 
 func (s *SqliteExprBuilder) NumberIn(field string, values []float64) {
-	s.sql.WriteString("CAST(json_extract(e.content, ?) AS NUMERIC) IN (")
+	s.sql.WriteString("CAST(")
+	s.field()
+	s.sql.WriteString(" AS NUMERIC) IN (")
 	s.args = append(s.args, "$."+field)
 	for i, v := range values {
 		if i > 0 {
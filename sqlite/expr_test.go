@@ -369,6 +369,13 @@ func Test_ExprIncomplete(t *testing.T) {
 	}
 }
 
+func Test_ExprMsgpack(t *testing.T) {
+	compiled, err := MsgpackExpBuilderFn(`field:hello AND count:>2`)
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlog_extract(e.content, ?) GLOB ? AND CAST(sqlog_extract(e.content, ?) AS NUMERIC) > ? ", compiled.Sql)
+	assert.Equal(t, []any{"$.field", "*hello*", "$.count", float64(2)}, compiled.Args)
+}
+
 func runExprTest(t *testing.T, tt testExprData) {
 	compiled, err := ExpBuilderFn(tt.expr)
 	assert.NoError(t, err)
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/nidorx/sqlog"
+)
+
+// ExtractFunctionName is the name of the SQL function used by the expression builder
+// when the content is encoded with MessagePack (Config.ContentType = sqlog.ContentTypeMsgpack).
+//
+// The function must be registered in the SQLite driver. Ex. (github.com/mattn/go-sqlite3)
+//
+//	sql.Register("sqlite3_sqlog", &sqlite3.SQLiteDriver{
+//		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+//			return conn.RegisterFunc(sqlite.ExtractFunctionName, sqlite.Extract, true)
+//		},
+//	})
+//
+//	storage, _ := sqlite.New(&sqlite.Config{Driver: "sqlite3_sqlog", ContentType: sqlog.ContentTypeMsgpack})
+const ExtractFunctionName = "sqlog_extract"
+
+var errExtractPath = errors.New("[sqlog] invalid path")
+
+// Extract is the implementation of the SQL function "sqlog_extract(content, path)".
+// Works like "json_extract(content, path)" for JSON and MessagePack content.
+func Extract(content []byte, path string) (any, error) {
+	var (
+		value any
+		err   error
+	)
+	if sqlog.IsMsgpack(content) {
+		value, err = sqlog.DecodeMsgpack(content)
+	} else {
+		d := json.NewDecoder(bytes.NewReader(content))
+		d.UseNumber()
+		err = d.Decode(&value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if value, err = extractPath(value, path); err != nil {
+		return nil, err
+	}
+	return extractSqlValue(value), nil
+}
+
+// extractPath walks the path ("$.a.b[0]", "$.\"a.b\"") in the decoded content
+func extractPath(value any, path string) (any, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errExtractPath
+	}
+	path = path[1:]
+
+	for path != "" && value != nil {
+		switch path[0] {
+		case '.':
+			var key string
+			if path = path[1:]; strings.HasPrefix(path, `"`) {
+				end := strings.IndexByte(path[1:], '"')
+				if end < 0 {
+					return nil, errExtractPath
+				}
+				key, path = path[1:end+1], path[end+2:]
+			} else {
+				end := strings.IndexAny(path, ".[")
+				if end < 0 {
+					end = len(path)
+				}
+				key, path = path[:end], path[end:]
+			}
+			if m, ok := value.(map[string]any); ok {
+				value = m[key]
+			} else {
+				value = nil
+			}
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, errExtractPath
+			}
+			index, err := strconv.Atoi(path[1:end])
+			if err != nil {
+				return nil, errExtractPath
+			}
+			path = path[end+1:]
+			if a, ok := value.([]any); ok && index >= 0 && index < len(a) {
+				value = a[index]
+			} else {
+				value = nil
+			}
+		default:
+			return nil, errExtractPath
+		}
+	}
+	return value, nil
+}
+
+// extractSqlValue converts the value to the same SQL types returned by json_extract
+func extractSqlValue(value any) any {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case uint64:
+		return float64(v)
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return v
+	}
+}
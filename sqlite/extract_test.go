@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Extract(t *testing.T) {
+	msgpack := &bytes.Buffer{}
+	slog.New(sqlog.NewMsgpackHandler(msgpack, nil)).Info("hello",
+		slog.Group("user", slog.Int("id", 7), slog.Bool("admin", true)),
+		slog.Any("tags", []string{"a", "b"}),
+		slog.String("a.b", "dotted"),
+	)
+	json := []byte(`{"msg":"hello","user":{"id":7,"admin":true},"tags":["a","b"],"a.b":"dotted"}`)
+
+	for _, content := range [][]byte{msgpack.Bytes(), json} {
+		for path, expected := range map[string]any{
+			"$.msg":        "hello",
+			"$.user.id":    int64(7),
+			"$.user.admin": int64(1),
+			"$.user":       `{"admin":true,"id":7}`,
+			"$.tags[1]":    "b",
+			"$.tags[5]":    nil,
+			`$."a.b"`:      "dotted",
+			"$.missing.x":  nil,
+		} {
+			value, err := Extract(content, path)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, value, path)
+		}
+
+		_, err := Extract(content, "msg")
+		assert.Equal(t, errExtractPath, err)
+	}
+}
@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// migration upgrades the schema of a database to the version
+type migration struct {
+	version    int
+	statements []string
+}
+
+// migrations of the schema of the databases, executed in order for the versions greater than the
+// "PRAGMA user_version" of the database. New migrations are appended, existing ones are never changed.
+var migrations = []*migration{
+	{version: 1, statements: []string{sqlCreateTable, sqlCreateIndex, sqlCreateMeta}},
+}
+
+// dbSchemaVersion is the current version of the schema, saved on the meta table and on the manifest
+var dbSchemaVersion = migrations[len(migrations)-1].version
+
+const sqlUserVersion = "PRAGMA user_version"
+
+// Migrate upgrades the schema of all the databases (*.db) of the directory, using the driver "sqlite3" (see
+// MigrateDriver). It must be executed offline, while no storage is using the directory.
+//
+// The live database is upgraded when the storage starts and the archived ones on their first open, on a temporary
+// copy (the archived files are never written). Migrate avoids the cost of copying and upgrading the archived
+// databases during the searches.
+func Migrate(dir string) error {
+	return MigrateDriver("sqlite3", dir)
+}
+
+// MigrateDriver same as Migrate, using the driver (see Config.Driver)
+func MigrateDriver(driver, dir string) error {
+	files, err := filepath.Glob(path.Join(dir, "*.db"))
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs     []error
+		versions = map[string]int{}
+	)
+	for _, file := range files {
+		if version, err := migrateFile(driver, file, StorageSQLiteOptions); err != nil {
+			errs = append(errs, fmt.Errorf("[sqlog] error migrating %s: %w", file, err))
+		} else {
+			versions[filepath.Base(file)] = version
+		}
+	}
+
+	// keeps the manifests consistent
+	manifests, _ := filepath.Glob(path.Join(dir, "*_manifest.json"))
+	for _, file := range manifests {
+		m, err := readManifestFile(file)
+		if err != nil || m == nil {
+			continue
+		}
+		for _, e := range m.Databases {
+			if version, exists := versions[e.File]; exists {
+				e.SchemaVersion = version
+			}
+		}
+		if err := writeManifest(file, m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	streams, _ := filepath.Glob(path.Join(dir, streamsDir, "*"))
+	for _, stream := range streams {
+		errs = append(errs, MigrateDriver(driver, stream))
+	}
+
+	return errors.Join(errs...)
+}
+
+// migrateFile opens the database (read-write) and upgrades its schema
+func migrateFile(driver, file string, options map[string]string) (int, error) {
+	db, err := sql.Open(driver, connString(file, options))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return migrate(db)
+}
+
+// migrateCopy copies the database (and its WAL) to a temporary file and upgrades the schema of the copy, the file
+// is not changed. Returns the path of the copy, removed by removeCopy.
+func migrateCopy(driver, file string, options map[string]string) (string, int, error) {
+	tmp, err := os.CreateTemp("", "sqlog_migrate_*_"+filepath.Base(file))
+	if err != nil {
+		return "", 0, err
+	}
+	tmp.Close()
+	dest := tmp.Name()
+
+	err = copyFile(context.Background(), file, dest)
+	if _, statErr := os.Stat(file + "-wal"); err == nil && statErr == nil {
+		err = copyFile(context.Background(), file+"-wal", dest+"-wal")
+	}
+	if err != nil {
+		removeCopy(dest)
+		return "", 0, err
+	}
+
+	version, err := migrateFile(driver, dest, options)
+	if err != nil {
+		removeCopy(dest)
+		return "", 0, err
+	}
+	return dest, version, nil
+}
+
+// removeCopy removes the temporary copy of the database created by migrateCopy
+func removeCopy(file string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(file + suffix)
+	}
+}
+
+// migrate upgrades the schema of the database to dbSchemaVersion, each migration in a transaction.
+// Returns the version of the database.
+func migrate(db *sql.DB) (int, error) {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version > dbSchemaVersion {
+		return version, fmt.Errorf("[sqlog] database schema version %d is newer than %d", version, dbSchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.execute(db); err != nil {
+			return version, fmt.Errorf("[sqlog] migration %d: %w", m.version, err)
+		}
+		version = m.version
+	}
+	return version, nil
+}
+
+func (m *migration) execute(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range m.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// PRAGMA does not accept parameters
+	if _, err := tx.Exec(fmt.Sprintf("%s = %d", sqlUserVersion, m.version)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion reads the version of the schema of the database (PRAGMA user_version)
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(sqlUserVersion).Scan(&version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return version, nil
+}
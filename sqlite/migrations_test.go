@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSchemaVersion(file string) int {
+	if v, ok := testDriver.versions.Load(file); ok {
+		return v.(int)
+	}
+	return 0
+}
+
+func Test_Sqlite_Migrations(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "versions must be sequential")
+		assert.NotEmpty(t, m.statements)
+	}
+	assert.Equal(t, len(migrations), dbSchemaVersion)
+}
+
+func Test_Sqlite_Migrate(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	var (
+		fileA = path.Join(storageDir, "test_1000.db")
+		fileB = path.Join(storageDir, "test_2000.db")
+	)
+	for _, file := range []string{fileA, fileB} {
+		assert.Nil(t, os.WriteFile(file, nil, 0644))
+		testDriver.versions.Delete(file)
+	}
+	assert.Nil(t, writeManifest(manifestPath(storageDir, storagePrefix), &manifest{Databases: []*manifestDb{
+		{File: "test_1000.db", EpochStart: 1000, EpochEnd: 1999},
+	}}))
+
+	assert.Nil(t, Migrate(storageDir))
+	assert.Equal(t, dbSchemaVersion, testSchemaVersion(fileA))
+	assert.Equal(t, dbSchemaVersion, testSchemaVersion(fileB))
+
+	m, err := readManifest(storageDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, dbSchemaVersion, m.Databases[0].SchemaVersion)
+
+	// created by a newer version
+	testDriver.versions.Store(fileB, dbSchemaVersion+1)
+	defer testDriver.versions.Delete(fileB)
+	err = Migrate(storageDir)
+	assert.ErrorContains(t, err, "test_2000.db")
+	assert.ErrorContains(t, err, "is newer than")
+}
+
+func Test_Sqlite_MigrateReadOnly(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	var (
+		archived = path.Join(storageDir, "test_1000_1999.db")
+		live     = path.Join(storageDir, "test_3000.db")
+	)
+	for _, file := range []string{archived, live} {
+		assert.Nil(t, os.WriteFile(file, nil, 0644))
+		testDriver.versions.Delete(file)
+	}
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	// live upgraded in place, archived on a temporary copy when opened
+	assert.Equal(t, dbSchemaVersion, testSchemaVersion(live))
+	assert.Equal(t, 0, testSchemaVersion(archived))
+
+	_, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000})
+	assert.Nil(t, err)
+
+	db := storage.dbs[0]
+	assert.True(t, db.readOnly)
+	assert.Equal(t, 0, testSchemaVersion(archived))
+	assert.Equal(t, 0, db.schemaVersion)
+	assert.NotEmpty(t, db.migratedPath)
+	assert.Equal(t, dbSchemaVersion, testSchemaVersion(db.migratedPath))
+
+	// the copy is removed on close
+	copyPath := db.migratedPath
+	db.lastUsedEpoch = 0
+	assert.True(t, db.closeSafe())
+	assert.NoFileExists(t, copyPath)
+	assert.Empty(t, db.migratedPath)
+
+	// created by a newer version
+	testDriver.versions.Store(archived, dbSchemaVersion+1)
+	defer testDriver.versions.Delete(archived)
+	_, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000})
+	assert.ErrorContains(t, err, "is newer than")
+}
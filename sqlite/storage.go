@@ -17,9 +17,19 @@ type Config struct {
 
 	Driver string // SQLite driver name (default sqlite3)
 
-	// Allows defining a custom expression processor.
+	// Allows defining a custom expression processor, used for all databases.
+	// (Default: by the content type of each database, ExpBuilderFn or MsgpackExpBuilderFn).
+	// Not supported with KeyProvider, the filters must use the decrypted content.
 	ExprBuilder func(expression string) (*Expr, error)
 
+	// Content type of the entries, must match the encoder of the handler.
+	// Saved in each database, allowing the change of encoding between databases.
+	// (Default: sqlog.ContentTypeJSON).
+	//
+	// For sqlog.ContentTypeMsgpack, the "sqlog_extract" SQL function must be
+	// registered in the driver (see ExtractFunctionName).
+	ContentType string
+
 	// Allows the database to accept older logs.
 	// Useful for log migration or receiving delayed logs from integrations.
 	// (Default: 3600 seconds = 1 hour)
@@ -33,10 +43,26 @@ type Config struct {
 
 	// The total size of all archived files. Once this cap is exceeded,
 	// the oldest archive files will be deleted asynchronously.
+	// With an ArchiveStore, this is the local disk budget: the oldest uploaded files are removed from the local disk
+	// instead of deleted.
 	// (Default: 1000MB).
 	MaxSizeTotalMB int32
 
+	// Stores the archived files out of the local disk (ex. object storage). The archived files are uploaded after
+	// the rotation, and the files evicted from the local disk (see MaxSizeTotalMB) are fetched back on demand when a
+	// search or scheduled task needs them. See NewFileArchiveStore.
+	ArchiveStore ArchiveStore
+
+	// Time (in seconds) before deleting the files from the ArchiveStore, by the end of the time range of the file.
+	// (Default: 0, files are kept forever).
+	MaxArchiveAgeSec int64
+
+	// Maximum time (in seconds) for each upload or download of the ArchiveStore.
+	// (Default: 300 seconds).
+	ArchiveTimeoutSec int32
+
 	// The maximum number of databases that can be opened simultaneously.
+	// Also limits the archived databases queried in parallel by a search.
 	MaxOpenedDB int32
 
 	// The maximum number of goroutines for scheduled task processing.
@@ -47,6 +73,16 @@ type Config struct {
 	// (Default: 30 seconds).
 	CloseIdleSec int64
 
+	// Maximum time (in seconds) for the execution of the queries of a request, and of each scheduled task.
+	// The running statement is interrupted after this time.
+	// (Default: 30 seconds).
+	QueryTimeoutSec int32
+
+	// Time (in seconds) that the result of a finished task is kept waiting for Result.
+	// Pending tasks that are not polled within this time are canceled.
+	// (Default: 60 seconds).
+	TaskResultTTLSec int32
+
 	// Interval (in seconds) for storage maintenance checks.
 	// (Default: 5 seconds).
 	IntervalSizeCheckSec int32
@@ -66,6 +102,30 @@ type Config struct {
 	//
 	// See https://www.sqlite.org/wal.html#ckpt
 	WalCheckpointMode string
+
+	// Keys of the encryption at rest of the content of the entries (AES-GCM), disabled when nil.
+	// Filters and aggregations on encrypted content use the "sqlog_decrypt" SQL function, which must be registered
+	// in the driver (see DecryptFunctionName). Backups and archives keep the content encrypted.
+	// Each entry grows by ~93 bytes plus the length of the key id (wrapped data key, nonce and tag).
+	KeyProvider KeyProvider
+
+	// Retention and size limits of the streams by name (see sqlog.Log.WithStream), the limits not set are inherited.
+	// Each stream is a partition of the storage, saved on its own directory ("{Dir}/streams/{name}").
+	// The names are normalized, lowercase with the characters other than [a-z0-9_-] replaced by "_", so
+	// different names can share the same partition (ex. "a.b", "A_B" and "a b").
+	Streams map[string]*StreamConfig
+
+	// Maximum number of streams, each one with its own databases and connections. The streams declared on
+	// Streams are always accepted, the entries of the other streams above the limit are saved on the default
+	// stream (Default: 100).
+	MaxStreams int
+}
+
+// StreamConfig limits of a stream, zero values are inherited from the Config
+type StreamConfig struct {
+	MaxChunkAgeSec int64 // See Config.MaxChunkAgeSec
+	MaxFilesizeMB  int32 // See Config.MaxFilesizeMB
+	MaxSizeTotalMB int32 // See Config.MaxSizeTotalMB
 }
 
 // Storage represents a connection to a SQLite database.
@@ -74,12 +134,19 @@ type storage struct {
 	sqlog.Storage
 	sqlog.StorageWithApi
 	mu             sync.Mutex
-	dbs            []*storageDb // All databases managed by this storage
-	liveDbs        []*storageDb // Currently active databases receiving logs
-	config         *Config      //
-	taskIdSeq      int32        // Last task ID
-	taskMap        sync.Map     // Stores task execution outputs
-	numActiveTasks int32        // Tracks the number of active goroutines for scheduled tasks
+	name           string              // Name of the stream of this partition, empty for the default
+	dbs            []*storageDb        // All databases managed by this storage
+	liveDbs        []*storageDb        // Currently active databases receiving logs
+	streams        map[string]*storage // Partitions of the streams by name, sharing the routines of this storage
+	streamsFull    bool                // MaxStreams was reached, new streams are saved on the default stream
+	config         *Config             //
+	taskIdSeq      int32               // Last task ID
+	taskMap        sync.Map            // Stores task execution outputs
+	numActiveTasks int32               // Tracks the number of active goroutines for scheduled tasks
+	archives       chan struct{}       // Connection pool of the archived databases queried by the planner (MaxOpenedDB)
+	sources        map[string]*source  // Read-only sets of databases by label (see Attach)
+	crypt          *encryptor          // Encryption of the content, nil when disabled (see Config.KeyProvider)
+	manifestMu     sync.Mutex          // Serializes the writes of the manifest
 	closed         atomic.Bool
 	quit           chan struct{}
 	shutdown       chan struct{}
@@ -118,6 +185,10 @@ func New(config *Config) (*storage, error) {
 		config.MaxSizeTotalMB = 1000 // ~1GB
 	}
 
+	if config.ArchiveTimeoutSec <= 0 {
+		config.ArchiveTimeoutSec = 300
+	}
+
 	if config.IntervalScheduledTasksMs <= 0 {
 		config.IntervalScheduledTasksMs = 100
 	}
@@ -130,40 +201,58 @@ func New(config *Config) (*storage, error) {
 		config.CloseIdleSec = 30
 	}
 
+	if config.QueryTimeoutSec <= 0 {
+		config.QueryTimeoutSec = 30
+	}
+
+	if config.TaskResultTTLSec <= 0 {
+		config.TaskResultTTLSec = 60
+	}
+
 	if config.IntervalSizeCheckSec <= 0 {
 		config.IntervalSizeCheckSec = 5
 	}
 
-	if config.ExprBuilder == nil {
-		config.ExprBuilder = ExpBuilderFn
+	if config.ContentType == "" {
+		config.ContentType = sqlog.ContentTypeJSON
+	}
+
+	if config.KeyProvider != nil {
+		if config.ExprBuilder != nil {
+			return nil, errors.New("[sqlog] ExprBuilder is not supported with KeyProvider")
+		}
+		// fail fast on invalid keys
+		if _, err := newEncryptor(config.KeyProvider).encrypt(nil); err != nil {
+			return nil, errors.Join(errors.New("[sqlog] invalid KeyProvider"), err)
+		}
 	}
 
 	if config.MaxChunkAgeSec <= 0 {
 		config.MaxChunkAgeSec = 3600
 	}
 
-	dbs, err := initDbs(config.Driver, config.Dir, config.Prefix)
-	if err != nil {
-		return nil, err
+	if config.MaxStreams <= 0 {
+		config.MaxStreams = 100
 	}
 
-	if len(dbs) == 0 {
-		dbs = append(dbs, newDb(config.Driver, config.Dir, config.Prefix, time.Now(), config.MaxChunkAgeSec))
+	s, err := newPartition(config, "")
+	if err != nil {
+		return nil, err
 	}
-
-	// Initialize the active database (live)
-	live := dbs[len(dbs)-1]
-	if err := live.connect(config.SQLiteOptions); err != nil {
-		return nil, errors.Join(errors.New("[sqlog] unable to start live db"), err)
+	s.streams = map[string]*storage{}
+	s.archives = make(chan struct{}, max(1, config.MaxOpenedDB))
+	s.quit = make(chan struct{})
+	s.shutdown = make(chan struct{})
+
+	if err := s.loadStreams(); err != nil {
+		for _, db := range s.allDbs() {
+			db.close()
+		}
+		return nil, err
 	}
-	live.live = true
 
-	s := &storage{
-		config:   config,
-		dbs:      dbs,
-		liveDbs:  []*storageDb{live},
-		quit:     make(chan struct{}),
-		shutdown: make(chan struct{}),
+	for _, p := range s.partitions() {
+		p.saveManifest()
 	}
 
 	go s.routineSizeCheck()
@@ -183,8 +272,83 @@ func New(config *Config) (*storage, error) {
 	return s, nil
 }
 
-// Flush saves the chunk records to the current live database.
+// newPartition initializes the databases of the directory of the config, connecting the live database.
+// The routines are executed by the storage that owns the partition.
+func newPartition(config *Config, name string) (*storage, error) {
+	dbs, err := initDbs(config.Driver, config.Dir, config.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if config.ArchiveStore != nil {
+		dbs = loadArchives(dbs, config, name)
+	}
+	loadEpochRange(dbs, config)
+
+	if len(dbs) == 0 {
+		dbs = append(dbs, newDb(config.Driver, config.Dir, config.Prefix, config.ContentType, time.Now(), config.MaxChunkAgeSec))
+	} else if last := dbs[len(dbs)-1]; atomic.LoadInt32(&last.status) == db_remote {
+		// the local files were lost, the archives are kept read-only
+		start := time.Now()
+		if start.Unix() <= last.epochStart {
+			start = time.Unix(last.epochStart+1, 0)
+		}
+		dbs = append(dbs, newDb(config.Driver, config.Dir, config.Prefix, config.ContentType, start, config.MaxChunkAgeSec))
+	}
+
+	// Initialize the active database (live)
+	live := dbs[len(dbs)-1]
+	live.contentType = config.ContentType
+	if err := live.connect(config.SQLiteOptions); err != nil {
+		return nil, errors.Join(errors.New("[sqlog] unable to start live db"), err)
+	}
+
+	if live.contentType != config.ContentType {
+		// the encoding has changed, starts a new database
+		live.close()
+		start := time.Now()
+		if start.Unix() <= live.epochStart {
+			start = time.Unix(live.epochStart+1, 0)
+		}
+		live = newDb(config.Driver, config.Dir, config.Prefix, config.ContentType, start, config.MaxChunkAgeSec)
+		if err := live.connect(config.SQLiteOptions); err != nil {
+			return nil, errors.Join(errors.New("[sqlog] unable to start live db"), err)
+		}
+		dbs = append(dbs, live)
+	}
+	live.live = true
+
+	crypt := newEncryptor(config.KeyProvider)
+	for _, db := range dbs {
+		db.stream = name
+		db.crypt = crypt
+	}
+
+	return &storage{
+		name:    name,
+		config:  config,
+		dbs:     dbs,
+		liveDbs: []*storageDb{live},
+		crypt:   crypt,
+	}, nil
+}
+
+// Flush saves the chunk records to the current live database of the partition of each stream.
 func (s *storage) Flush(chunk *sqlog.Chunk) error {
+	var errs []error
+	for name, c := range chunk.Streams() {
+		p, err := s.stream(name)
+		if err == nil {
+			err = p.flush(c)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flush saves the chunk records to the current live database of this partition
+func (s *storage) flush(chunk *sqlog.Chunk) error {
 	var (
 		db         *storageDb
 		epochStart = chunk.First()
@@ -216,9 +380,12 @@ func (s *storage) Close() error {
 	<-s.shutdown
 
 	// close dbs
-	for _, db := range s.dbs {
+	for _, db := range s.allDbs() {
 		db.close()
 	}
+	for _, p := range s.partitions() {
+		p.saveManifest()
+	}
 
 	s.closed.Store(true)
 	return nil
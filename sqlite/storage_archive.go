@@ -0,0 +1,354 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ArchiveStore stores the archived database files out of the local disk (ex. object storage), see Config.ArchiveStore.
+//
+// The names are relative to Config.Dir, ex. "sqlog_1729000000.db" or "streams/billing/sqlog_1729000000.db".
+type ArchiveStore interface {
+	// Put saves the content of the file, replacing it if it exists
+	Put(ctx context.Context, name string, r io.Reader) error
+
+	// Get returns the content of the file
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// List returns the names of the files starting with the prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes the file, no error if it does not exist
+	Delete(ctx context.Context, name string) error
+}
+
+// fileArchiveStore is an ArchiveStore on a local directory, used for tests and CI
+type fileArchiveStore struct {
+	dir string
+}
+
+// NewFileArchiveStore creates an ArchiveStore that saves the files on the directory (ex. a mounted volume)
+func NewFileArchiveStore(dir string) *fileArchiveStore {
+	return &fileArchiveStore{dir: dir}
+}
+
+func (f *fileArchiveStore) Put(ctx context.Context, name string, r io.Reader) error {
+	file := path.Join(f.dir, name)
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(file + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		os.Remove(file + ".tmp")
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func (f *fileArchiveStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return os.Open(path.Join(f.dir, name))
+}
+
+func (f *fileArchiveStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(f.dir, func(file string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && file == f.dir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(file, ".tmp") {
+			return nil
+		}
+		name, err := filepath.Rel(f.dir, file)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (f *fileArchiveStore) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Remove(path.Join(f.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// archiveName returns the name of the database file on the ArchiveStore
+func (s *storageDb) archiveName() string {
+	name := filepath.Base(s.filePath)
+	if s.stream != "" {
+		return path.Join(streamsDir, s.stream, name)
+	}
+	return name
+}
+
+// evict removes the local file of the database uploaded to the ArchiveStore, fetched again when needed (see fetch)
+func (s *storageDb) evict() bool {
+	if atomic.LoadInt32(&s.readers) > 0 || !s.close() {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&s.status, db_closed, db_removing) {
+		return false
+	}
+	if err := os.Remove(s.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn(
+			"[sqlog] error evicting database",
+			slog.String("file", s.filePath),
+			slog.Any("error", err),
+		)
+		atomic.StoreInt32(&s.status, db_closed)
+		return false
+	}
+	atomic.StoreInt32(&s.status, db_remote)
+	return true
+}
+
+// archiveContext returns the context of an upload or download (ArchiveTimeoutSec)
+func (s *storage) archiveContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(s.config.ArchiveTimeoutSec)*time.Second)
+}
+
+// upload copies the archived database to the ArchiveStore
+func (s *storage) upload(db *storageDb) error {
+	ctx, cancel := s.archiveContext()
+	defer cancel()
+
+	// the file is not evicted or removed during the upload
+	atomic.AddInt32(&db.readers, 1)
+	defer atomic.AddInt32(&db.readers, -1)
+
+	file, err := os.Open(db.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := s.config.ArchiveStore.Put(ctx, db.archiveName(), file); err != nil {
+		return err
+	}
+	db.uploaded.Store(true)
+	return nil
+}
+
+// fetch downloads the database evicted from the local disk. Only one goroutine downloads the file, the others
+// wait for the status of the database to change.
+func (s *storage) fetch(db *storageDb) error {
+	if !atomic.CompareAndSwapInt32(&db.status, db_remote, db_fetching) {
+		return nil
+	}
+
+	ctx, cancel := s.archiveContext()
+	defer cancel()
+
+	size, err := download(ctx, s.config.ArchiveStore, db.archiveName(), db.filePath)
+	if err != nil {
+		atomic.StoreInt32(&db.status, db_remote)
+		slog.Warn(
+			"[sqlog] error fetching database",
+			slog.String("file", db.filePath),
+			slog.Any("error", err),
+		)
+		return err
+	}
+
+	atomic.StoreInt64(&db.size, size)
+	atomic.StoreInt64(&db.lastUsedEpoch, time.Now().Unix())
+	atomic.StoreInt32(&db.status, db_closed)
+	return nil
+}
+
+// download writes the file of the ArchiveStore to dest (write to a temporary file and rename)
+func download(ctx context.Context, store ArchiveStore, name, dest string) (int64, error) {
+	in, err := store.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = os.Rename(dest+".tmp", dest)
+	}
+	if err != nil {
+		os.Remove(dest + ".tmp")
+		return 0, err
+	}
+	return size, nil
+}
+
+// archive uploads the archived databases to the ArchiveStore, removes the oldest uploaded file from the local disk
+// once MaxSizeTotalMB is exceeded and deletes the archives older than MaxArchiveAgeSec.
+func (s *storage) archive() (changed bool) {
+	s.mu.Lock()
+	dbs := append([]*storageDb{}, s.dbs...)
+	s.mu.Unlock()
+
+	// upload after the rotation, once the database is closed for writing
+	var localSizeBytes int64
+	for _, db := range dbs {
+		status := atomic.LoadInt32(&db.status)
+		if status == db_remote || status == db_fetching || status == db_removing {
+			continue
+		}
+		localSizeBytes += db.size
+		if db.live || db.uploaded.Load() {
+			continue
+		}
+		if status == db_closed || (status == db_open && db.readOnly) {
+			if err := s.upload(db); err != nil {
+				slog.Warn(
+					"[sqlog] error uploading database",
+					slog.String("file", db.filePath),
+					slog.Any("error", err),
+				)
+			} else {
+				changed = true
+			}
+		}
+	}
+
+	// local disk budget, from the oldest
+	if localSizeBytes > int64(s.config.MaxSizeTotalMB)*1000000 {
+		for _, db := range dbs {
+			if !db.live && db.uploaded.Load() && db.lastUsedSec() > s.config.CloseIdleSec && db.evict() {
+				changed = true
+				break
+			}
+		}
+	}
+
+	// retention of the archives
+	if s.config.MaxArchiveAgeSec > 0 {
+		maxEpochEnd := time.Now().Unix() - s.config.MaxArchiveAgeSec
+		for _, db := range dbs {
+			if db.live || !db.uploaded.Load() || db.epochEnd == 0 || db.epochEnd >= maxEpochEnd {
+				continue
+			}
+			if !atomic.CompareAndSwapInt32(&db.status, db_remote, db_removing) {
+				if atomic.LoadInt32(&db.readers) > 0 {
+					continue
+				}
+				if db.remove(); atomic.LoadInt32(&db.status) != db_removing {
+					continue
+				}
+			}
+
+			ctx, cancel := s.archiveContext()
+			err := s.config.ArchiveStore.Delete(ctx, db.archiveName())
+			cancel()
+			if err != nil {
+				slog.Warn(
+					"[sqlog] error deleting archive",
+					slog.String("file", db.archiveName()),
+					slog.Any("error", err),
+				)
+			}
+
+			s.mu.Lock()
+			s.dbs = slices.DeleteFunc(s.dbs, func(d *storageDb) bool { return d == db })
+			s.mu.Unlock()
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// loadArchives adds the databases evicted from the local disk (listed on the ArchiveStore), the local databases
+// found on the store are marked as uploaded.
+func loadArchives(dbs []*storageDb, config *Config, stream string) []*storageDb {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ArchiveTimeoutSec)*time.Second)
+	defer cancel()
+
+	prefix := config.Prefix + "_"
+	if stream != "" {
+		prefix = path.Join(streamsDir, stream, prefix)
+	}
+
+	names, err := config.ArchiveStore.List(ctx, prefix)
+	if err != nil {
+		slog.Warn("[sqlog] error listing archives", slog.String("dir", config.Dir), slog.Any("error", err))
+		return dbs
+	}
+
+	local := map[string]*storageDb{}
+	for _, db := range dbs {
+		local[filepath.Base(db.filePath)] = db
+	}
+
+	for _, name := range names {
+		name = path.Base(name)
+		if path.Ext(name) != ".db" {
+			continue
+		}
+		if db, exists := local[name]; exists {
+			db.uploaded.Store(true)
+			continue
+		}
+		epochStart, epochEnd, err := parseDbName(config.Prefix, name)
+		if err != nil {
+			continue
+		}
+		db := &storageDb{
+			fileDir:       config.Dir,
+			filePath:      path.Join(config.Dir, name),
+			filePrefix:    config.Prefix,
+			status:        db_remote,
+			epochStart:    epochStart,
+			newEpochStart: epochStart,
+			epochEnd:      epochEnd,
+			driver:        config.Driver,
+		}
+		db.uploaded.Store(true)
+		dbs = append(dbs, db)
+	}
+
+	sortDbs(dbs)
+	return dbs
+}
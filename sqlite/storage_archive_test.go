@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Archive(t *testing.T) {
+	archiveDir := "testdata/archive"
+	testClearDir(storageDir)
+	testClearDir(archiveDir)
+	defer testClearDir(storageDir)
+	defer testClearDir(archiveDir)
+
+	// two archived databases over the local disk budget
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	testWriteDb(t, path.Join(storageDir, "test_1000.db"), make([]byte, 2000000))
+	testWriteDb(t, path.Join(storageDir, "test_2000.db"), make([]byte, 2000000))
+	testWriteDb(t, path.Join(storageDir, "test_3000.db"), nil)
+	assert.Nil(t, writeManifest(manifestPath(storageDir, storagePrefix), &manifest{Databases: []*manifestDb{
+		{File: "test_1000.db", EpochStart: 1000, EpochEnd: 1999, SchemaVersion: dbSchemaVersion},
+		{File: "test_2000.db", EpochStart: 2000, EpochEnd: 2999, SchemaVersion: dbSchemaVersion},
+		{File: "test_3000.db", EpochStart: 3000, Live: true, SchemaVersion: dbSchemaVersion},
+	}}))
+
+	config := &Config{
+		Dir:            storageDir,
+		Prefix:         storagePrefix,
+		MaxSizeTotalMB: 3,
+		ArchiveStore:   NewFileArchiveStore(archiveDir),
+	}
+	storage, err := New(config)
+	assert.Nil(t, err)
+
+	byName := func(dbs []*storageDb, name string) *storageDb {
+		for _, db := range dbs {
+			if path.Base(db.filePath) == name {
+				return db
+			}
+		}
+		return nil
+	}
+
+	// uploaded after the rotation, the oldest evicted from the local disk
+	storage.doRoutineSizeCheck()
+	assert.FileExists(t, path.Join(archiveDir, "test_1000.db"))
+	assert.FileExists(t, path.Join(archiveDir, "test_2000.db"))
+	assert.NoFileExists(t, path.Join(storageDir, "test_1000.db"))
+	assert.FileExists(t, path.Join(storageDir, "test_2000.db"))
+	assert.Equal(t, db_remote, atomic.LoadInt32(&byName(storage.dbs, "test_1000.db").status))
+	assert.Equal(t, 3, len(storage.dbs))
+
+	m, err := readManifest(storageDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.True(t, m.Databases[0].Remote)
+	assert.True(t, m.Databases[0].Uploaded)
+	assert.False(t, m.Databases[1].Remote)
+	assert.True(t, m.Databases[1].Uploaded)
+
+	// fetched on demand by the search
+	var (
+		mu      sync.Mutex
+		queried []string
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		mu.Lock()
+		queried = append(queried, path.Base(strings.Split(strings.TrimPrefix(dsn, "file:"), "?")[0]))
+		mu.Unlock()
+		return []string{"epoch_secs", "nanos", "level", "content"}, nil, true
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	_, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, MaxResult: 10})
+	assert.Nil(t, err)
+	assert.Contains(t, queried, "test_1000.db")
+	assert.FileExists(t, path.Join(storageDir, "test_1000.db"))
+	assert.Equal(t, int64(2000000), byName(storage.dbs, "test_1000.db").size)
+
+	// evicted again, once idle
+	for _, db := range storage.dbs {
+		db.closeSafe()
+	}
+	atomic.StoreInt64(&byName(storage.dbs, "test_1000.db").lastUsedEpoch, 0)
+	storage.doRoutineSizeCheck()
+	assert.NoFileExists(t, path.Join(storageDir, "test_1000.db"))
+	storage.Close()
+
+	// the evicted databases of the previous execution
+	storage, err = New(config)
+	assert.Nil(t, err)
+	defer storage.Close()
+	db := byName(storage.dbs, "test_1000.db")
+	assert.NotNil(t, db)
+	assert.Equal(t, db_remote, atomic.LoadInt32(&db.status))
+	assert.Equal(t, int64(1999), db.epochEnd)
+	assert.True(t, byName(storage.dbs, "test_2000.db").uploaded.Load())
+	assert.True(t, storage.dbs[len(storage.dbs)-1].live)
+
+	// fetched in background by the scheduler
+	assert.NotNil(t, storage.openDb(db))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&db.status) == db_closed
+	}, time.Second, 10*time.Millisecond)
+	assert.FileExists(t, path.Join(storageDir, "test_1000.db"))
+
+	// retention of the archives
+	storage.config.MaxArchiveAgeSec = 60
+	storage.doRoutineSizeCheck()
+	assert.Equal(t, 1, len(storage.dbs))
+	assert.NoFileExists(t, path.Join(archiveDir, "test_1000.db"))
+	assert.NoFileExists(t, path.Join(archiveDir, "test_2000.db"))
+	assert.NoFileExists(t, path.Join(storageDir, "test_1000.db"))
+}
+
+func Test_Sqlite_FileArchiveStore(t *testing.T) {
+	archiveDir := "testdata/archive"
+	testClearDir(archiveDir)
+	defer testClearDir(archiveDir)
+
+	ctx := context.Background()
+	store := NewFileArchiveStore(archiveDir)
+
+	names, err := store.List(ctx, "")
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+
+	assert.Nil(t, store.Put(ctx, "test_1.db", strings.NewReader("one")))
+	assert.Nil(t, store.Put(ctx, "streams/billing/test_2.db", strings.NewReader("two")))
+
+	names, err = store.List(ctx, "streams/billing/test_")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"streams/billing/test_2.db"}, names)
+
+	r, err := store.Get(ctx, "test_1.db")
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	b.ReadFrom(r)
+	r.Close()
+	assert.Equal(t, "one", b.String())
+
+	assert.Nil(t, store.Delete(ctx, "test_1.db"))
+	assert.Nil(t, store.Delete(ctx, "test_1.db"))
+	_, err = store.Get(ctx, "test_1.db")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nidorx/sqlog"
+)
+
+// source is a set of databases attached for read-only querying (see storage.Attach)
+type source struct {
+	dir    string
+	prefix string
+	dbs    []*storageDb
+}
+
+// Attach registers the databases of the directory (ex. from another host or a backup) as a read-only source,
+// selected by its label on the search inputs (see sqlog.TicksInput.Source). The files are never written, rotated
+// or deleted by the storage (older schemas are migrated on a temporary copy). The prefix of the files is read from the manifest of the directory, the Config.Prefix
+// is used when there is no manifest.
+func (s *storage) Attach(dir, label string) error {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return errors.New("[sqlog] source label is required")
+	}
+
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("[sqlog] %s is not a directory", dir)
+	}
+
+	s.mu.Lock()
+	_, exists := s.sources[label]
+	s.mu.Unlock()
+	if exists {
+		return fmt.Errorf("[sqlog] source %q already attached", label)
+	}
+
+	prefix := manifestPrefix(dir, s.config.Prefix)
+	dbs, err := initDbs(s.config.Driver, dir, prefix)
+	if err != nil {
+		return err
+	}
+	if len(dbs) == 0 {
+		return fmt.Errorf("[sqlog] no databases found in %s", dir)
+	}
+	for _, db := range dbs {
+		db.attached = true
+		db.crypt = s.crypt
+	}
+
+	// all the databases are archived, including the newest
+	loadManifest(dbs, dir, prefix)
+	readEpochRange(dbs, s.config.SQLiteOptions)
+	sortDbs(dbs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.sources[label]; exists {
+		return fmt.Errorf("[sqlog] source %q already attached", label)
+	}
+	if s.sources == nil {
+		s.sources = map[string]*source{}
+	}
+	s.sources[label] = &source{dir: dir, prefix: prefix, dbs: dbs}
+	return nil
+}
+
+// Sources lists the attached sources, sorted by label
+func (s *storage) Sources() []*sqlog.Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []*sqlog.Source{}
+	for label, src := range s.sources {
+		item := &sqlog.Source{Name: label, Dir: src.dir, Databases: len(src.dbs)}
+		for _, db := range src.dbs {
+			if item.EpochStart == 0 || db.epochStart < item.EpochStart {
+				item.EpochStart = db.epochStart
+			}
+			item.EpochEnd = max(item.EpochEnd, db.epochEnd)
+		}
+		list = append(list, item)
+	}
+	slices.SortFunc(list, func(a, b *sqlog.Source) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// sourceDbs returns the databases of the source, the databases of the streams of this storage when the source is
+// empty (see streamDbs)
+func (s *storage) sourceDbs(source string, streams []string) ([]*storageDb, error) {
+	if source == "" {
+		return s.streamDbs(streams), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if src, exists := s.sources[source]; exists {
+		return src.dbs, nil
+	}
+	return nil, fmt.Errorf("[sqlog] unknown source %q", source)
+}
+
+// allDbs returns the databases of all the streams of this storage followed by the databases of the attached sources
+func (s *storage) allDbs() []*storageDb {
+	dbs := s.streamDbs(nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, src := range s.sources {
+		dbs = append(dbs, src.dbs...)
+	}
+	return dbs
+}
+
+// manifestPrefix returns the prefix of the manifest found in the directory, or the fallback
+func manifestPrefix(dir, fallback string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*_manifest.json"))
+	if len(files) != 1 {
+		return fallback
+	}
+	return strings.TrimSuffix(filepath.Base(files[0]), "_manifest.json")
+}
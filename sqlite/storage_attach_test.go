@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Attach(t *testing.T) {
+	attachDir := "testdata/attached"
+	testClearDir(storageDir)
+	testClearDir(attachDir)
+	defer testClearDir(storageDir)
+	defer testClearDir(attachDir)
+
+	// files from another host, with other prefix
+	assert.Nil(t, os.MkdirAll(attachDir, 0755))
+	testWriteDb(t, path.Join(attachDir, "other_1000_1999.db"), make([]byte, 2000000))
+	testWriteDb(t, path.Join(attachDir, "other_2000.db"), nil)
+	assert.Nil(t, writeManifest(manifestPath(attachDir, "other"), &manifest{Databases: []*manifestDb{
+		{File: "other_1000_1999.db", EpochStart: 1000, EpochEnd: 1999, SchemaVersion: dbSchemaVersion},
+		{File: "other_2000.db", EpochStart: 2000, EpochEnd: 2999, Live: true, SchemaVersion: dbSchemaVersion},
+	}}))
+
+	var (
+		mu      sync.Mutex
+		queried []string
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		name := path.Base(strings.Split(strings.TrimPrefix(dsn, "file:"), "?")[0])
+		mu.Lock()
+		queried = append(queried, name)
+		mu.Unlock()
+		if name != "other_2000.db" {
+			return []string{"epoch_secs", "nanos", "level", "content"}, nil, true
+		}
+		return []string{"epoch_secs", "nanos", "level", "content"}, [][]any{
+			{int64(2500), int64(0), int64(0), []byte(`{"msg":"2500"}`)},
+		}, true
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, MaxSizeTotalMB: 1})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	assert.Nil(t, storage.Attach(attachDir, "host-b"))
+	assert.ErrorContains(t, storage.Attach(attachDir, "host-b"), "already attached")
+	assert.ErrorContains(t, storage.Attach(attachDir, " "), "label is required")
+	assert.NotNil(t, storage.Attach("testdata/missing", "missing"))
+
+	assert.Equal(t, []*sqlog.Source{
+		{Name: "host-b", Dir: attachDir, Databases: 2, EpochStart: 1000, EpochEnd: 2999},
+	}, storage.Sources())
+
+	out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, MaxResult: 1, Source: "host-b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Entries))
+	assert.Equal(t, int64(2500), out.Entries[0].Epoch)
+	assert.Equal(t, []string{"other_2000.db"}, queried)
+
+	// the live storage doesn't see the attached databases
+	queried = nil
+	out, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, MaxResult: 1})
+	assert.Nil(t, err)
+	assert.Empty(t, out.Entries)
+	for _, name := range queried {
+		assert.True(t, strings.HasPrefix(name, storagePrefix), fmt.Sprintf("queried %s", name))
+	}
+
+	_, err = storage.Ticks(&sqlog.TicksInput{Source: "unknown"})
+	assert.ErrorContains(t, err, "unknown source")
+
+	// never written, rotated or deleted (older schemas are migrated on a copy, see Test_Sqlite_MigrateReadOnly)
+	info, err := os.Stat(path.Join(attachDir, "other_1000_1999.db"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000000), info.Size())
+	assert.Equal(t, dbSchemaVersion, testSchemaVersion(path.Join(attachDir, "other_2000.db")))
+
+	storage.doRoutineSizeCheck()
+	assert.FileExists(t, path.Join(attachDir, "other_1000_1999.db"))
+	assert.FileExists(t, path.Join(attachDir, "other_2000.db"))
+	assert.Equal(t, 1, len(storage.dbs))
+}
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+)
+
+// Backup writes a consistent snapshot of the databases to destDir while the storage is running.
+//
+// Databases open for writing (live) are copied with "VACUUM INTO", which reads a consistent snapshot (the pages on
+// the WAL included), and the archived databases, never changed after closed, are copied as they are. A manifest
+// is written with the copied databases, destDir can be used as the directory of a storage (see Restore).
+// The streams are copied to their directories inside destDir.
+func (s *storage) Backup(ctx context.Context, destDir string) error {
+	for _, p := range s.partitions() {
+		dir := destDir
+		if p.name != "" {
+			dir = path.Join(destDir, streamsDir, p.name)
+		}
+		if err := p.backup(ctx, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backup writes the snapshot of the databases of this partition
+func (s *storage) backup(ctx context.Context, destDir string) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	dbs := append([]*storageDb{}, s.dbs...)
+	s.mu.Unlock()
+
+	m := &manifest{Databases: []*manifestDb{}}
+	for _, db := range dbs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if status := atomic.LoadInt32(&db.status); status == db_remote || status == db_fetching {
+			continue // evicted from the local disk, already on the ArchiveStore
+		}
+
+		filePath := db.filePath
+		file := filepath.Base(filePath)
+		dest := path.Join(destDir, file)
+		if err := db.backup(ctx, dest); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("[sqlog] error on backup of %s: %w", file, err)
+			}
+			if db.filePath == filePath {
+				continue // removed during the backup
+			}
+			// renamed on close
+			file = filepath.Base(db.filePath)
+			dest = path.Join(destDir, file)
+			if err := db.backup(ctx, dest); err != nil {
+				return fmt.Errorf("[sqlog] error on backup of %s: %w", file, err)
+			}
+		}
+
+		info, err := os.Stat(dest)
+		if err != nil {
+			return err
+		}
+		m.Databases = append(m.Databases, &manifestDb{
+			File:          file,
+			EpochStart:    db.epochStart,
+			EpochEnd:      atomic.LoadInt64(&db.epochEnd),
+			Live:          db.live,
+			Size:          info.Size(),
+			SchemaVersion: db.schemaVersion,
+			ContentType:   db.contentType,
+			Meta:          db.meta.Load(),
+		})
+	}
+
+	return writeManifest(manifestPath(destDir, s.config.Prefix), m)
+}
+
+// backup copies the database to the file, using "VACUUM INTO" when the database is open for writing
+func (s *storageDb) backup(ctx context.Context, dest string) error {
+	if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err // VACUUM INTO requires a new file
+	}
+
+	// the database is not closed during the backup
+	atomic.AddInt32(&s.readers, 1)
+	defer atomic.AddInt32(&s.readers, -1)
+
+	if s.isOpen() && !s.readOnly {
+		_, err := s.db.ExecContext(ctx, "VACUUM INTO ?", dest)
+		return err
+	}
+	return copyFile(ctx, s.filePath, dest)
+}
+
+// Restore copies the databases of a backup (see Backup) to the directory of a storage, it must be executed offline,
+// while no storage is using the directory. Existing databases are never overwritten, the manifest of the directory
+// receives the restored databases. The streams of the backup are restored to their directories.
+func Restore(backupDir, dir string) error {
+	manifests, err := filepath.Glob(path.Join(backupDir, "*_manifest.json"))
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("[sqlog] manifest not found on %s", backupDir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, file := range manifests {
+		backup, err := readManifestFile(file)
+		if err != nil {
+			return err
+		}
+
+		target := path.Join(dir, filepath.Base(file))
+		current, err := readManifestFile(target)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			current = &manifest{Databases: []*manifestDb{}}
+		}
+
+		for _, e := range backup.Databases {
+			dest := path.Join(dir, e.File)
+			if _, err := os.Stat(dest); err == nil {
+				return fmt.Errorf("[sqlog] database %s already exists", dest)
+			}
+			if err := copyFile(context.Background(), path.Join(backupDir, e.File), dest); err != nil {
+				return err
+			}
+
+			restored := *e
+			restored.Live = false
+			current.Databases = slices.DeleteFunc(current.Databases, func(c *manifestDb) bool {
+				return c.File == e.File
+			})
+			current.Databases = append(current.Databases, &restored)
+		}
+
+		if err := writeManifest(target, current); err != nil {
+			return err
+		}
+	}
+
+	streams, _ := filepath.Glob(path.Join(backupDir, streamsDir, "*"))
+	for _, stream := range streams {
+		if err := Restore(stream, path.Join(dir, streamsDir, filepath.Base(stream))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies the file, checking the context between the blocks
+func copyFile(ctx context.Context, src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<20)
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = in.Read(buf)
+		if n > 0 {
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				err = werr
+				break
+			}
+		}
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			break
+		}
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
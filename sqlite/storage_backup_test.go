@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Backup(t *testing.T) {
+	var (
+		backupDir  = "testdata/backup"
+		restoreDir = "testdata/restore"
+	)
+	testClearDir(storageDir)
+	testClearDir(backupDir)
+	testClearDir(restoreDir)
+	defer testClearDir(storageDir)
+	defer testClearDir(backupDir)
+	defer testClearDir(restoreDir)
+
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	archived := []byte("archived content")
+	testWriteDb(t, path.Join(storageDir, "test_1000_1999.db"), archived)
+	testWriteDb(t, path.Join(storageDir, "test_3000.db"), nil)
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, IntervalWalCheckpointSec: 0})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	// entries on the WAL (not checkpointed)
+	chunk := sqlog.NewChunk(10)
+	for i := 0; i < 5; i++ {
+		chunk.Put(&sqlog.Entry{Time: time.Now(), Content: []byte(fmt.Sprintf(`{"msg":"%d"}`, i))})
+	}
+	assert.Nil(t, storage.Flush(chunk))
+
+	live := storage.liveDbs[0]
+	assert.Nil(t, storage.Backup(context.Background(), backupDir))
+
+	content, err := os.ReadFile(path.Join(backupDir, "test_1000_1999.db"))
+	assert.Nil(t, err)
+	assert.Equal(t, archived, content)
+
+	content, err = os.ReadFile(path.Join(backupDir, path.Base(live.filePath)))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `{"msg":"4"}`)
+
+	m, err := readManifest(backupDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(m.Databases))
+	assert.True(t, m.Databases[1].Live)
+	assert.Equal(t, int64(len(content)), m.Databases[1].Size)
+
+	// canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, storage.Backup(ctx, backupDir), context.Canceled)
+
+	// restore
+	assert.Nil(t, os.MkdirAll(restoreDir, 0755))
+	testWriteDb(t, path.Join(restoreDir, "test_5000.db"), nil)
+	assert.Nil(t, Restore(backupDir, restoreDir))
+	assert.FileExists(t, path.Join(restoreDir, "test_1000_1999.db"))
+	assert.FileExists(t, path.Join(restoreDir, path.Base(live.filePath)))
+
+	m, err = readManifest(restoreDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(m.Databases))
+	assert.False(t, m.Databases[1].Live)
+
+	// never overwrites
+	assert.ErrorContains(t, Restore(backupDir, restoreDir), "already exists")
+}
@@ -2,12 +2,16 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -39,6 +43,35 @@ var (
 
 	sqlCreateIndex = `CREATE INDEX IF NOT EXISTS entries_epoch_desc ON entries(epoch_secs DESC)`
 
+	sqlCreateMeta = `CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	)`
+
+	sqlInsertContentType = `INSERT OR IGNORE INTO meta(key, value) VALUES('content_type', ?)`
+	sqlSelectContentType = `SELECT value FROM meta WHERE key = 'content_type'`
+
+	sqlSelectMetaValues = `SELECT key, value FROM meta`
+
+	sqlSaveMeta = `INSERT OR REPLACE INTO meta(key, value) VALUES (?, ?), (?, ?), (?, ?), (?, ?), (?, ?), (?, ?)`
+
+	sqlHasMeta = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`
+
+	sqlSelectMeta = `SELECT COUNT(*), COALESCE(MIN(epoch_secs), 0), COALESCE(MAX(epoch_secs), 0),
+		COALESCE(SUM(level < 0), 0), COALESCE(SUM(level BETWEEN 0 AND 3), 0), COALESCE(SUM(level BETWEEN 4 AND 7), 0), COALESCE(SUM(level >= 8), 0)
+		FROM entries`
+
+	// Options that write on the database, ignored on read-only connections
+	readOnlyIgnoredOptions = map[string]bool{
+		"_journal_mode": true,
+		"_journal":      true,
+		"_synchronous":  true,
+		"_sync":         true,
+	}
+
+	// Levels of the dbMeta histogram
+	dbMetaLevels = []string{"debug", "info", "warn", "error"}
+
 	sqlInsert       = []byte(`INSERT INTO entries(epoch_secs, nanos, level, content) VALUES `)
 	sqlInsertValues = []byte(`(?,?,?,?)`)
 )
@@ -49,25 +82,46 @@ const (
 	db_open                  // Database is open
 	db_closing               // Closing the database
 	db_removing              // Removing the database
+	db_remote                // Evicted from the local disk, on the ArchiveStore only
+	db_fetching              // Downloading the database from the ArchiveStore
 )
 
 type storageDb struct {
-	mu             sync.Mutex // Mutex for checkpoint and flush operations
-	live           bool       // Indicates if the database is live and receiving logs
-	size           int64      // Size of the database in bytes
-	status         int32      // Connection status (closed, loading, open, closing, removing)
-	epochStart     int64      // Epoch of the oldest entry in this database
-	newEpochStart  int64      // When accepting an old log, adjust file name when closing the DB
-	epochEnd       int64      // Epoch of the newest entry in this database
-	lastUsedEpoch  int64      // Last usage timestamp of this storage (query, flush)
-	maxChunkAgeSec int64      // Maximum allowed chunk age
-	fileDir        string     // Directory of the database file
-	filePath       string     // Path to the database file
-	filePrefix     string     // Prefix for the database file name
-	db             *sql.DB    // SQLite connection object
-	taskCount      int32      // Number of scheduled tasks
-	taskMap        sync.Map   // Map of scheduled tasks
-	driver         string     // SQLite driver name
+	mu             sync.Mutex             // Mutex for checkpoint and flush operations
+	live           bool                   // Indicates if the database is live and receiving logs
+	size           int64                  // Size of the database in bytes
+	status         int32                  // Connection status (closed, loading, open, closing, removing)
+	epochStart     int64                  // Epoch of the oldest entry in this database
+	newEpochStart  int64                  // When accepting an old log, adjust file name when closing the DB
+	epochEnd       int64                  // Epoch of the newest entry in this database
+	lastUsedEpoch  int64                  // Last usage timestamp of this storage (query, flush)
+	maxChunkAgeSec int64                  // Maximum allowed chunk age
+	fileDir        string                 // Directory of the database file
+	filePath       string                 // Path to the database file
+	filePrefix     string                 // Prefix for the database file name
+	db             *sql.DB                // SQLite connection object
+	readers        int32                  // Number of queries or backups running on this database (see storage.acquire)
+	taskCount      int32                  // Number of scheduled tasks
+	taskMap        sync.Map               // Map of scheduled tasks
+	driver         string                 // SQLite driver name
+	contentType    string                 // Content type of the entries (json, msgpack)
+	schemaVersion  int                    // Version of the schema (PRAGMA user_version), zero if unknown
+	readOnly       bool                   // Indicates if the connection is read-only (archived database)
+	stream         string                 // Stream of the partition of the database, empty for the default
+	attached       bool                   // Database of an attached source, never written (see storage.Attach)
+	migratedPath   string                 // Temporary copy of an archive with an older schema (see connectReadOnly)
+	uploaded       atomic.Bool            // The file is saved on the ArchiveStore (see storage.archive)
+	crypt          *encryptor             // Encryption of the content, nil when disabled (see Config.KeyProvider)
+	meta           atomic.Pointer[dbMeta] // Metadata of the archived database, nil if unknown
+}
+
+// dbMeta is the metadata of an archived database, loaded when the database is opened read-only.
+// Queries outside the epoch range or levels of the database are answered without opening the file.
+type dbMeta struct {
+	Rows     int64    `json:"rows"`      // Number of entries
+	EpochMin int64    `json:"epoch_min"` // Epoch of the oldest entry
+	EpochMax int64    `json:"epoch_max"` // Epoch of the newest entry
+	Levels   [4]int64 `json:"levels"`    // Number of entries by level (debug, info, warn, error)
 }
 
 // schedule schedules a query execution on this instance
@@ -87,14 +141,16 @@ func (s *storageDb) cancel(id int32) bool {
 
 // tasks returns the number of scheduled queries for this database
 func (s *storageDb) tasks() int32 {
-	return s.taskCount
+	return atomic.LoadInt32(&s.taskCount)
 }
 
 // execute executa os proximos callbacks nesse banco de dados
 func (s *storageDb) execute(f func(id int32, task *dbTask) bool) {
 	s.taskMap.Range(func(key, value any) bool {
+		if _, loaded := s.taskMap.LoadAndDelete(key); !loaded {
+			return true // canceled
+		}
 		atomic.AddInt32(&s.taskCount, -1)
-		s.taskMap.Delete(key)
 
 		id, isIdOk := key.(int32)
 		task, isTaskOk := value.(*dbTask)
@@ -113,7 +169,7 @@ func (s *storageDb) isOpen() bool {
 
 // lastUsedSec returns the time elapsed since the last use of this database
 func (s *storageDb) lastUsedSec() int64 {
-	return time.Now().Unix() - s.lastUsedEpoch
+	return time.Now().Unix() - atomic.LoadInt64(&s.lastUsedEpoch)
 }
 
 // updateSize updates the size of the database
@@ -154,7 +210,7 @@ func (s *storageDb) updateSize() error {
 
 // closeSafe checks if the database can be safely closed
 func (s *storageDb) closeSafe() bool {
-	if s.lastUsedSec() < 2 {
+	if s.lastUsedSec() < 2 || atomic.LoadInt32(&s.readers) > 0 {
 		return false
 	}
 	return s.close()
@@ -177,57 +233,299 @@ func (s *storageDb) remove() {
 func (s *storageDb) connect(options map[string]string) error {
 	if atomic.CompareAndSwapInt32(&s.status, db_closed, db_loading) {
 
-		// file:test.db?cache=shared&mode=memory
-		connString := "file:" + s.filePath
-		if len(options) > 0 {
-			connString += "?"
-			i := 0
-			for k, v := range options {
-				if i > 0 {
-					connString += "&"
-				}
-				connString += k + "=" + v
-				i++
+		db, err := sql.Open(s.driver, connString(s.filePath, options))
+		if err != nil {
+			atomic.StoreInt32(&s.status, db_closed)
+			return err
+		}
+
+		version, err := migrate(db)
+		if err != nil {
+			db.Close()
+			atomic.StoreInt32(&s.status, db_closed)
+			return err
+		}
+		s.schemaVersion = version
+
+		if err := s.loadContentType(db); err != nil {
+			db.Close()
+			atomic.StoreInt32(&s.status, db_closed)
+			return err
+		}
+
+		s.db = db
+		s.readOnly = false
+		s.meta.Store(nil) // receives new entries
+		atomic.StoreInt64(&s.lastUsedEpoch, time.Now().Unix())
+		atomic.StoreInt32(&s.status, db_open)
+	}
+	return nil
+}
+
+// connectReadOnly opens an archived database in read-only mode (mode=ro, immutable=1), the file is never
+// changed (no schema creation, vacuum or rename), so it can live on read-only media.
+// Databases closed without a checkpoint are opened without immutable, which would ignore the entries of the WAL.
+// Databases with an older schema are migrated on a temporary copy (see migrateCopy).
+// The metadata of the database is loaded on the first open (see dbMeta).
+func (s *storageDb) connectReadOnly(options map[string]string) error {
+	if atomic.CompareAndSwapInt32(&s.status, db_closed, db_loading) {
+		roOptions := map[string]string{"mode": "ro", "immutable": "1"}
+		if info, err := os.Stat(s.filePath + "-wal"); err == nil && info.Size() > 0 {
+			delete(roOptions, "immutable")
+		}
+		for k, v := range options {
+			if !readOnlyIgnoredOptions[k] {
+				roOptions[k] = v
 			}
 		}
 
-		db, err := sql.Open(s.driver, connString)
+		db, err := sql.Open(s.driver, connString(s.filePath, roOptions))
 		if err != nil {
 			atomic.StoreInt32(&s.status, db_closed)
 			return err
 		}
 
-		if _, err := db.Exec(sqlCreateTable); err != nil {
+		version, err := schemaVersion(db)
+		if err == nil && version > dbSchemaVersion {
+			err = fmt.Errorf("[sqlog] database schema version %d is newer than %d", version, dbSchemaVersion)
+		}
+		if err == nil && version < dbSchemaVersion {
+			// the archived file is never written (read-only media, attached or uploaded), the queries use a
+			// migrated copy, removed on close
+			db.Close()
+			var copyPath string
+			if copyPath, _, err = migrateCopy(s.driver, s.filePath, options); err == nil {
+				delete(roOptions, "immutable")
+				if db, err = sql.Open(s.driver, connString(copyPath, roOptions)); err != nil {
+					removeCopy(copyPath)
+				} else {
+					s.migratedPath = copyPath
+				}
+			}
+			if err != nil {
+				err = errors.Join(fmt.Errorf("[sqlog] unable to migrate the database %s (schema version %d)", s.filePath, version), err)
+				atomic.StoreInt32(&s.status, db_closed)
+				return err
+			}
+		}
+		if err != nil {
 			db.Close()
 			atomic.StoreInt32(&s.status, db_closed)
 			return err
 		}
+		s.schemaVersion = version
 
-		if _, err := db.Exec(sqlCreateIndex); err != nil {
+		if err := s.readMeta(db); err != nil {
 			db.Close()
+			if s.migratedPath != "" {
+				removeCopy(s.migratedPath)
+				s.migratedPath = ""
+			}
 			atomic.StoreInt32(&s.status, db_closed)
 			return err
 		}
 
 		s.db = db
+		s.readOnly = true
 		atomic.StoreInt64(&s.lastUsedEpoch, time.Now().Unix())
 		atomic.StoreInt32(&s.status, db_open)
 	}
 	return nil
 }
 
-// query prepares and executes a query on the database
-func (s *storageDb) query(sql string, args []any) (*sql.Stmt, *sql.Rows, error) {
+// open connects the database, archived databases are opened read-only
+func (s *storageDb) open(options map[string]string) error {
+	if s.live {
+		return s.connect(options)
+	}
+	return s.connectReadOnly(options)
+}
+
+// readMeta reads the meta table of the database without changing it: the content type and the metadata saved when
+// the database was archived (see saveMeta). Databases created before the meta table are JSON, the metadata is
+// computed when it was not saved.
+func (s *storageDb) readMeta(db *sql.DB) error {
+	var (
+		count  int
+		values = map[string]string{}
+	)
+	if err := db.QueryRow(sqlHasMeta).Scan(&count); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if count > 0 {
+		rows, err := db.Query(sqlSelectMetaValues)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key, value string
+			if err := rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			values[key] = value
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	s.contentType = values["content_type"]
+	if s.contentType == "" {
+		s.contentType = sqlog.ContentTypeJSON
+	}
+
+	if s.meta.Load() != nil {
+		return nil
+	}
+	if meta := parseDbMeta(values); meta != nil {
+		s.meta.Store(meta)
+		return nil
+	}
+	meta, err := queryMeta(db)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		s.meta.Store(meta)
+	}
+	return nil
+}
+
+// saveMeta computes the metadata of the database and saves it on the meta table, so archived databases are
+// described without a full scan.
+func (s *storageDb) saveMeta() error {
+	meta, err := queryMeta(s.db)
+	if err != nil || meta == nil {
+		return err
+	}
+	s.meta.Store(meta)
+
+	levels, _ := json.Marshal(meta.Levels)
+	_, err = s.db.Exec(sqlSaveMeta,
+		"rows", strconv.FormatInt(meta.Rows, 10),
+		"epoch_min", strconv.FormatInt(meta.EpochMin, 10),
+		"epoch_max", strconv.FormatInt(meta.EpochMax, 10),
+		"levels", string(levels),
+		"schema_version", strconv.Itoa(s.schemaVersion),
+		"size", strconv.FormatInt(atomic.LoadInt64(&s.size), 10),
+	)
+	return err
+}
+
+// queryMeta computes the metadata of the database (row count, epoch range and level histogram), nil if unknown
+func queryMeta(db *sql.DB) (*dbMeta, error) {
+	meta := &dbMeta{}
+	err := db.QueryRow(sqlSelectMeta).Scan(&meta.Rows, &meta.EpochMin, &meta.EpochMax, &meta.Levels[0], &meta.Levels[1], &meta.Levels[2], &meta.Levels[3])
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// parseDbMeta reads the metadata saved on the meta table (see saveMeta), nil if not saved
+func parseDbMeta(values map[string]string) *dbMeta {
+	if values["rows"] == "" {
+		return nil
+	}
+	var (
+		meta = &dbMeta{}
+		errs []error
+		err  error
+	)
+	meta.Rows, err = strconv.ParseInt(values["rows"], 10, 64)
+	errs = append(errs, err)
+	meta.EpochMin, err = strconv.ParseInt(values["epoch_min"], 10, 64)
+	errs = append(errs, err)
+	meta.EpochMax, err = strconv.ParseInt(values["epoch_max"], 10, 64)
+	errs = append(errs, err)
+	errs = append(errs, json.Unmarshal([]byte(values["levels"]), &meta.Levels))
+	if errors.Join(errs...) != nil {
+		return nil
+	}
+	return meta
+}
+
+// skip checks, using the metadata, if the database can't have entries in the epoch range (inclusive) with the levels
+// ["debug","info","warn","error"]. Without metadata the file name range is used.
+func (s *storageDb) skip(epochStart, epochEnd int64, levels []string) bool {
+	meta := s.meta.Load()
+	if meta == nil {
+		return epochEnd < s.epochStart || (s.epochEnd != 0 && s.epochEnd < epochStart)
+	}
+	if meta.Rows == 0 || epochEnd < meta.EpochMin || meta.EpochMax < epochStart {
+		return true
+	}
+	if len(levels) == 0 {
+		return false
+	}
+	for _, level := range levels {
+		if i := slices.Index(dbMetaLevels, level); i < 0 || meta.Levels[i] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// connString returns the connection string of the database with the options.
+// Ex. "file:test.db?cache=shared&mode=memory"
+func connString(filePath string, options map[string]string) string {
+	connString := "file:" + filePath
+	if len(options) > 0 {
+		connString += "?"
+		i := 0
+		for k, v := range options {
+			if i > 0 {
+				connString += "&"
+			}
+			connString += k + "=" + v
+			i++
+		}
+	}
+	return connString
+}
+
+// loadContentType reads the content type of the database, saving it on new databases.
+// Databases created before the meta table are JSON.
+func (s *storageDb) loadContentType(db *sql.DB) error {
+	if _, err := db.Exec(sqlCreateMeta); err != nil {
+		return err
+	}
+
+	if s.contentType != "" {
+		if _, err := db.Exec(sqlInsertContentType, s.contentType); err != nil {
+			return err
+		}
+	}
+
+	var contentType string
+	if err := db.QueryRow(sqlSelectContentType).Scan(&contentType); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if contentType != "" {
+		s.contentType = contentType
+	} else if s.contentType == "" {
+		s.contentType = sqlog.ContentTypeJSON
+	}
+	return nil
+}
+
+// query prepares and executes a query on the database, the statement is interrupted when the context is done
+func (s *storageDb) query(ctx context.Context, sql string, args []any) (*sql.Stmt, *sql.Rows, error) {
 	if s.db == nil {
 		return nil, nil, errors.New("db is closed")
 	}
 
-	stm, err := s.db.Prepare(sql)
+	stm, err := s.db.PrepareContext(ctx, sql)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rows, err := stm.Query(args...)
+	rows, err := stm.QueryContext(ctx, args...)
 	if err != nil {
 		stm.Close()
 		return nil, nil, err
@@ -258,8 +556,15 @@ func (s *storageDb) flush(chunk *sqlog.Chunk) error {
 		if epoch < maxChunkAge {
 			continue
 		}
-		values = append(values, epoch, e.Time.Nanosecond(), e.Level, e.Content)
-		size += int64(len(e.Content))
+		content := e.Content
+		if s.crypt != nil {
+			var err error
+			if content, err = s.crypt.encrypt(content); err != nil {
+				return err
+			}
+		}
+		values = append(values, epoch, e.Time.Nanosecond(), e.Level, content)
+		size += int64(len(content))
 	}
 
 	if len(values) == 0 {
@@ -285,7 +590,7 @@ func (s *storageDb) flush(chunk *sqlog.Chunk) error {
 		tx.Commit()
 
 		atomic.AddInt64(&s.size, size)
-		s.epochEnd = max(chunk.Last(), s.epochEnd)
+		atomic.StoreInt64(&s.epochEnd, max(chunk.Last(), atomic.LoadInt64(&s.epochEnd)))
 		if chunkEpochStart := chunk.First(); chunkEpochStart < s.newEpochStart {
 			// db will renamed during close
 			s.newEpochStart = chunkEpochStart
@@ -318,6 +623,16 @@ func (s *storageDb) checkpoint(mode string) {
 func (s *storageDb) close() bool {
 	if atomic.CompareAndSwapInt32(&s.status, db_open, db_closing) {
 
+		if !s.readOnly {
+			if err := s.saveMeta(); err != nil {
+				slog.Warn(
+					"[sqlog] error saving database meta",
+					slog.String("path", s.filePath),
+					slog.Any("error", err),
+				)
+			}
+		}
+
 		if s.live {
 			if err := s.vacuum(); err != nil {
 				slog.Warn(
@@ -331,7 +646,12 @@ func (s *storageDb) close() bool {
 		s.db.Close()
 		s.db = nil
 
-		if s.newEpochStart < s.epochStart {
+		if s.migratedPath != "" {
+			removeCopy(s.migratedPath)
+			s.migratedPath = ""
+		}
+
+		if !s.readOnly && s.newEpochStart < s.epochStart {
 			// need to rename DB
 			newPath := path.Join(s.fileDir, fmt.Sprintf("%s_%d.db", s.filePrefix, s.newEpochStart))
 			if err := os.Rename(s.filePath, newPath); err != nil {
@@ -341,6 +661,9 @@ func (s *storageDb) close() bool {
 					slog.String("newpath", newPath),
 					slog.Any("error", err),
 				)
+			} else {
+				s.filePath = newPath
+				s.epochStart = s.newEpochStart
 			}
 		}
 
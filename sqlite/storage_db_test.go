@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_ReadOnly(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	for _, name := range []string{"test_1000_1999.db", "test_3000.db"} {
+		testWriteDb(t, path.Join(storageDir, name), nil)
+	}
+
+	var (
+		mu      sync.Mutex
+		dsns    []string
+		queries int
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !strings.Contains(dsn, "test_1000_1999.db") {
+			return nil, nil, false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		dsns = append(dsns, dsn)
+
+		switch {
+		case q == sqlSelectMeta:
+			return []string{"rows", "min", "max", "debug", "info", "warn", "error"}, [][]any{
+				{int64(5), int64(1000), int64(1500), int64(0), int64(5), int64(0), int64(0)},
+			}, true
+		case strings.HasPrefix(q, string(sqlSeekPageBefore)):
+			queries++
+			return []string{"epoch_secs", "nanos", "level", "content"}, [][]any{
+				{int64(1500), int64(0), int64(0), []byte(`{"msg":"archived"}`)},
+			}, true
+		}
+		return nil, nil, false
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, MaxOpenedDB: 1})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, Level: []string{"info"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Entries))
+	assert.Equal(t, 1, queries)
+
+	for _, dsn := range dsns {
+		assert.Contains(t, dsn, "mode=ro")
+		assert.Contains(t, dsn, "immutable=1")
+		assert.NotContains(t, dsn, "_journal_mode")
+	}
+
+	var archived *storageDb
+	for _, d := range storage.dbs {
+		if !d.live {
+			archived = d
+		}
+	}
+	assert.True(t, archived.readOnly)
+	assert.Equal(t, &dbMeta{Rows: 5, EpochMin: 1000, EpochMax: 1500, Levels: [4]int64{0, 5, 0, 0}}, archived.meta.Load())
+
+	// answered by the metadata, without querying the file
+	out, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: 5000, Level: []string{"error"}})
+	assert.Nil(t, err)
+	assert.Empty(t, out.Entries)
+	assert.True(t, archived.skip(1600, 1900, nil))
+	assert.False(t, archived.skip(1400, 1900, []string{"warn", "info"}))
+
+	// the file is not renamed on close
+	archived.lastUsedEpoch = 0
+	assert.True(t, archived.closeSafe())
+	_, err = os.Stat(path.Join(storageDir, "test_1000_1999.db"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, queries)
+}
+
+func Test_Sqlite_ReadOnlyWAL(t *testing.T) {
+	dir := t.TempDir()
+	file := path.Join(dir, "test_1000_1999.db")
+	testWriteDb(t, file, nil)
+
+	var dsns []string
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		dsns = append(dsns, dsn)
+		return nil, nil, false
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	db := &storageDb{filePath: file, driver: "sqlite3", epochStart: 1000, epochEnd: 1999}
+	assert.Nil(t, db.connectReadOnly(nil))
+	assert.Contains(t, dsns[0], "immutable=1")
+	db.close()
+
+	// closed without a checkpoint, the entries of the WAL are read
+	assert.Nil(t, os.WriteFile(file+"-wal", []byte("entries"), 0644))
+	dsns = nil
+	db = &storageDb{filePath: file, driver: "sqlite3", epochStart: 1000, epochEnd: 1999}
+	assert.Nil(t, db.connectReadOnly(nil))
+	assert.Contains(t, dsns[0], "mode=ro")
+	assert.NotContains(t, dsns[0], "immutable")
+	db.close()
+}
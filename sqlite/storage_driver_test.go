@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// the mock driver is registered as "sqlite3", these tests run the SQL on a real SQLite
+const testRealDriver = "sqlite"
+
+func testRealStorage(t *testing.T, dir string) *storage {
+	storage, err := New(&Config{
+		Dir:                      dir,
+		Prefix:                   storagePrefix,
+		Driver:                   testRealDriver,
+		SQLiteOptions:            map[string]string{"_pragma": "journal_mode(WAL)"},
+		IntervalScheduledTasksMs: 1000000,
+	})
+	assert.Nil(t, err)
+
+	chunk := sqlog.NewChunk(100)
+	now := time.Now()
+	for i, content := range []string{
+		`{"msg":"a","route":"/users","duration":10}`,
+		`{"msg":"b","route":"/users","duration":20.5}`,
+		`{"msg":"c","route":"/users","duration":"slow"}`,
+		`{"msg":"d","route":"/orders","duration":30,"user":{"id":7},"a.b":{"c":1},"x-id":"1"}`,
+		`{"msg":"e","route":"/orders"}`,
+	} {
+		chunk.Put(&sqlog.Entry{Time: now.Add(time.Duration(i) * time.Millisecond), Level: int8(i / 3 * 8), Content: []byte(content)})
+	}
+	assert.Nil(t, storage.Flush(chunk))
+	return storage
+}
+
+func Test_Sqlite_Driver_Aggregate(t *testing.T) {
+	storage := testRealStorage(t, t.TempDir())
+	defer storage.Close()
+
+	input := &sqlog.AggregateInput{
+		EpochEnd: time.Now().Unix() + 60,
+		Aggregations: []sqlog.Aggregation{
+			{Func: sqlog.AggCount},
+			{Func: sqlog.AggAvg, Field: "duration"},
+			{Func: sqlog.AggMax, Field: "duration"},
+			{Func: sqlog.AggP50, Field: "duration"},
+		},
+		GroupBy: []string{"route"},
+	}
+	assert.Nil(t, input.Validate())
+
+	out, err := storage.Aggregate(input)
+	assert.Nil(t, err)
+	assert.False(t, out.Scheduled)
+	assert.Equal(t, 2, len(out.Aggregate))
+
+	// the text values of the field are ignored
+	assert.Equal(t, []any{"/orders"}, out.Aggregate[0].Groups)
+	assert.Equal(t, []any{int64(2), 30.0, 30.0, 30.0}, out.Aggregate[0].Values)
+	assert.Equal(t, []any{"/users"}, out.Aggregate[1].Groups)
+	assert.Equal(t, []any{int64(3), 15.25, 20.5, 15.25}, out.Aggregate[1].Values)
+
+	// levels
+	input = &sqlog.AggregateInput{EpochEnd: time.Now().Unix() + 60, Level: []string{"error"}, GroupBy: []string{"route"}}
+	assert.Nil(t, input.Validate())
+	out, err = storage.Aggregate(input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Aggregate))
+	assert.Equal(t, []any{"/orders"}, out.Aggregate[0].Groups)
+	assert.Equal(t, []any{int64(2)}, out.Aggregate[0].Values)
+
+	// only the top values
+	input = &sqlog.AggregateInput{EpochEnd: time.Now().Unix() + 60, GroupBy: []string{"route"}, Top: 1}
+	assert.Nil(t, input.Validate())
+	out, err = storage.Aggregate(input)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Aggregate))
+	assert.Equal(t, []any{"/users"}, out.Aggregate[0].Groups)
+	assert.Equal(t, []any{int64(3)}, out.Aggregate[0].Values)
+}
+
+func Test_Sqlite_Driver_Levels(t *testing.T) {
+	storage := testRealStorage(t, t.TempDir())
+	defer storage.Close()
+
+	for _, level := range [][]string{{"error"}, {"info"}, {"debug", "warn"}, {"info", "warn", "error"}} {
+		expected := map[string]int{"error": 2, "info": 3}[level[0]]
+		if len(level) == 3 {
+			expected = 5
+		}
+
+		out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", EpochStart: time.Now().Unix() + 60, MaxResult: 10, Level: level})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, len(out.Entries), level)
+
+		out, err = storage.Ticks(&sqlog.TicksInput{EpochEnd: time.Now().Unix() + 60, IntervalSec: 3600, MaxResult: 1, Level: level})
+		assert.Nil(t, err)
+		if expected == 0 {
+			assert.Empty(t, out.Ticks, level)
+		} else {
+			assert.Equal(t, int64(expected), out.Ticks[0].Count, level)
+		}
+	}
+}
+
+func Test_Sqlite_Driver_Fields(t *testing.T) {
+	storage := testRealStorage(t, t.TempDir())
+	defer storage.Close()
+
+	input := &sqlog.FieldsInput{EpochEnd: time.Now().Unix() + 60}
+	assert.Nil(t, input.Validate())
+	out, err := storage.Fields(input)
+	assert.Nil(t, err)
+
+	fields := map[string]string{}
+	for _, f := range out.Fields {
+		fields[fmt.Sprintf("%s:%s", f.Name, f.Type)] = fmt.Sprint(f.Count)
+	}
+	assert.Equal(t, "5", fields["msg:string"])
+	assert.Equal(t, "5", fields["route:string"])
+	assert.Equal(t, "3", fields["duration:number"])
+	assert.Equal(t, "1", fields["duration:string"])
+	assert.Equal(t, "1", fields["user.id:number"])
+	assert.Equal(t, "1", fields["x-id:string"])
+
+	// keys that can't be used as fields
+	for name := range fields {
+		assert.NotContains(t, name, `"`)
+		assert.NotContains(t, name, "a.b")
+	}
+}
+
+func Test_Sqlite_Driver_Backup(t *testing.T) {
+	var (
+		dir       = t.TempDir()
+		backupDir = t.TempDir()
+	)
+	storage := testRealStorage(t, dir)
+	defer storage.Close()
+
+	assert.Nil(t, storage.Backup(context.Background(), backupDir))
+
+	// the entries of the WAL are in the copy
+	db, err := sql.Open(testRealDriver, path.Join(backupDir, path.Base(storage.liveDbs[0].filePath)))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	var count int
+	assert.Nil(t, db.QueryRow("SELECT COUNT(*) FROM entries").Scan(&count))
+	assert.Equal(t, 5, count)
+}
+
+func Test_Sqlite_Driver_TicksStreams(t *testing.T) {
+	storage := testRealStorage(t, t.TempDir())
+	defer storage.Close()
+
+	chunk := sqlog.NewChunk(100)
+	for i := 0; i < 3; i++ {
+		chunk.Put(&sqlog.Entry{Time: time.Now(), Stream: "billing", Level: 8, Content: []byte(`{"msg":"billing"}`)})
+	}
+	assert.Nil(t, storage.Flush(chunk))
+
+	// the ticks of the databases of the streams are merged by index
+	out, err := storage.Ticks(&sqlog.TicksInput{EpochEnd: time.Now().Unix() + 60, IntervalSec: 3600, MaxResult: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Ticks))
+	assert.Equal(t, int64(8), out.Ticks[0].Count)
+	assert.Equal(t, int64(3), out.Ticks[0].Info)
+	assert.Equal(t, int64(5), out.Ticks[0].Error)
+
+	out, err = storage.Ticks(&sqlog.TicksInput{EpochEnd: time.Now().Unix() + 60, IntervalSec: 3600, MaxResult: 1, Streams: []string{"billing"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out.Ticks))
+	assert.Equal(t, int64(3), out.Ticks[0].Count)
+}
@@ -0,0 +1,165 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// manifest is the directory-level index of the databases ("{prefix}_manifest.json"), kept consistent on rotation
+// and removal. On start, the epoch range and the metadata of the archived databases are read from it.
+type manifest struct {
+	Databases []*manifestDb `json:"databases"`
+}
+
+// manifestDb is the entry of a database in the manifest
+type manifestDb struct {
+	File          string  `json:"file"`                   // File name, relative to the directory
+	EpochStart    int64   `json:"epoch_start"`            //
+	EpochEnd      int64   `json:"epoch_end"`              // Zero when unknown (live database)
+	Live          bool    `json:"live,omitempty"`         // Database receiving logs
+	Size          int64   `json:"size"`                   // Size in bytes
+	SchemaVersion int     `json:"schema_version"`         //
+	ContentType   string  `json:"content_type,omitempty"` //
+	Meta          *dbMeta `json:"meta,omitempty"`         // Row count, epoch range and level counts, when known
+	Uploaded      bool    `json:"uploaded,omitempty"`     // Saved on the ArchiveStore
+	Remote        bool    `json:"remote,omitempty"`       // Evicted from the local disk, on the ArchiveStore only
+}
+
+// manifestPath returns the path of the manifest of the directory
+func manifestPath(dir, prefix string) string {
+	return path.Join(dir, prefix+"_manifest.json")
+}
+
+// readManifest reads the manifest of the directory, nil if it does not exist
+func readManifest(dir, prefix string) (*manifest, error) {
+	return readManifestFile(manifestPath(dir, prefix))
+}
+
+func readManifestFile(file string) (*manifest, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// apply sets the epoch range and the metadata of the databases listed on the manifest
+func (m *manifest) apply(dbs []*storageDb) {
+	files := map[string]*manifestDb{}
+	for _, e := range m.Databases {
+		files[e.File] = e
+	}
+	for _, db := range dbs {
+		e, exists := files[filepath.Base(db.filePath)]
+		if !exists {
+			continue
+		}
+		if db.epochEnd == 0 {
+			db.epochEnd = e.EpochEnd
+		}
+		if db.schemaVersion == 0 {
+			db.schemaVersion = e.SchemaVersion
+		}
+		if e.ContentType != "" {
+			db.contentType = e.ContentType
+		}
+		if e.Meta != nil {
+			db.meta.Store(e.Meta)
+		}
+		if e.Uploaded {
+			db.uploaded.Store(true)
+		}
+	}
+}
+
+// saveManifest writes the manifest with the current databases (write to a temporary file and rename)
+func (s *storage) saveManifest() {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	s.mu.Lock()
+	dbs := append([]*storageDb{}, s.dbs...)
+	s.mu.Unlock()
+
+	m := &manifest{Databases: []*manifestDb{}}
+	for _, db := range dbs {
+		status := atomic.LoadInt32(&db.status)
+		if status == db_removing {
+			continue
+		}
+		m.Databases = append(m.Databases, &manifestDb{
+			File:          filepath.Base(db.filePath),
+			EpochStart:    db.epochStart,
+			EpochEnd:      atomic.LoadInt64(&db.epochEnd),
+			Live:          db.live,
+			Size:          atomic.LoadInt64(&db.size),
+			SchemaVersion: db.schemaVersion,
+			ContentType:   db.contentType,
+			Meta:          db.meta.Load(),
+			Uploaded:      db.uploaded.Load(),
+			Remote:        status == db_remote || status == db_fetching,
+		})
+	}
+
+	file := manifestPath(s.config.Dir, s.config.Prefix)
+	if err := writeManifest(file, m); err != nil {
+		slog.Warn("[sqlog] error saving manifest", slog.String("file", file), slog.Any("error", err))
+	}
+}
+
+func writeManifest(file string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// loadEpochRange sets the epoch range of the archived databases (all but the newest) from the manifest, or from
+// the meta table of the database when it is not listed.
+func loadEpochRange(dbs []*storageDb, config *Config) {
+	loadManifest(dbs, config.Dir, config.Prefix)
+	readEpochRange(dbs[:max(0, len(dbs)-1)], config.SQLiteOptions)
+	sortDbs(dbs)
+}
+
+// loadManifest applies the manifest of the directory, when it exists
+func loadManifest(dbs []*storageDb, dir, prefix string) {
+	if m, err := readManifest(dir, prefix); err != nil {
+		slog.Warn("[sqlog] error reading manifest", slog.String("dir", dir), slog.Any("error", err))
+	} else if m != nil {
+		m.apply(dbs)
+		sortDbs(dbs)
+	}
+}
+
+// readEpochRange opens read-only the databases with unknown epoch end, reading it from the meta table
+func readEpochRange(dbs []*storageDb, options map[string]string) {
+	for _, db := range dbs {
+		if db.epochEnd != 0 {
+			continue
+		}
+		if err := db.connectReadOnly(options); err != nil {
+			slog.Warn("[sqlog] error reading database meta", slog.String("file", db.filePath), slog.Any("error", err))
+			continue
+		}
+		if meta := db.meta.Load(); meta != nil {
+			db.epochEnd = max(meta.EpochMax, db.epochStart)
+		}
+		db.close()
+	}
+}
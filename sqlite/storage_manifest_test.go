@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Manifest(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	assert.Nil(t, os.MkdirAll(storageDir, 0755))
+	for _, name := range []string{"test_1000.db", "test_2000.db", "test_3000.db"} {
+		assert.Nil(t, os.WriteFile(path.Join(storageDir, name), nil, 0644))
+	}
+	assert.Nil(t, writeManifest(manifestPath(storageDir, storagePrefix), &manifest{Databases: []*manifestDb{
+		{File: "test_1000.db", EpochStart: 1000, EpochEnd: 1999, Meta: &dbMeta{Rows: 3, EpochMin: 1000, EpochMax: 1999, Levels: [4]int64{0, 3, 0, 0}}},
+		{File: "test_2000.db", EpochStart: 2000, EpochEnd: 2999},
+	}}))
+
+	var (
+		mu    sync.Mutex
+		saved []driver.Value
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if q != sqlSelectMeta || !strings.Contains(dsn, "test_3000.db") {
+			return nil, nil, false
+		}
+		return []string{"rows", "min", "max", "debug", "info", "warn", "error"}, [][]any{
+			{int64(7), int64(3000), int64(3100), int64(0), int64(7), int64(0), int64(0)},
+		}, true
+	}
+	mockExecHook = func(dsn string, q string, a []driver.Value) {
+		if q == sqlSaveMeta && strings.Contains(dsn, "test_3000.db") {
+			mu.Lock()
+			saved = a
+			mu.Unlock()
+		}
+	}
+	defer func() {
+		mockQueryDbHook = nil
+		mockExecHook = nil
+	}()
+
+	storage, err := New(&Config{
+		Dir:                      storageDir,
+		Prefix:                   storagePrefix,
+		MaxSizeTotalMB:           1,
+		IntervalSizeCheckSec:     1000,
+		IntervalScheduledTasksMs: 1000000,
+	})
+	assert.Nil(t, err)
+
+	// epoch range from the manifest
+	var ranges [][2]int64
+	for _, d := range storage.dbs {
+		ranges = append(ranges, [2]int64{d.epochStart, d.epochEnd})
+	}
+	assert.Equal(t, [][2]int64{{1000, 1999}, {2000, 2999}, {3000, 0}}, ranges)
+	assert.Equal(t, int64(3), storage.dbs[0].meta.Load().Rows)
+	assert.True(t, storage.dbs[2].live)
+
+	m, err := readManifest(storageDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(m.Databases))
+	assert.Equal(t, "test_3000.db", m.Databases[2].File)
+	assert.True(t, m.Databases[2].Live)
+	assert.Equal(t, dbSchemaVersion, m.Databases[2].SchemaVersion)
+
+	// removal of the oldest database (MaxSizeTotalMB)
+	storage.dbs[0].size = 2000000
+	storage.doRoutineSizeCheck()
+	assert.NoFileExists(t, path.Join(storageDir, "test_1000.db"))
+
+	m, err = readManifest(storageDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(m.Databases))
+	assert.Equal(t, "test_2000.db", m.Databases[0].File)
+
+	// meta saved on close
+	assert.Nil(t, storage.Close())
+	assert.Equal(t, []driver.Value{
+		"rows", "7", "epoch_min", "3000", "epoch_max", "3100", "levels", "[0,7,0,0]", "schema_version", "1", "size", "0",
+	}, saved)
+
+	m, err = readManifest(storageDir, storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, &dbMeta{Rows: 7, EpochMin: 3000, EpochMax: 3100, Levels: [4]int64{0, 7, 0, 0}}, m.Databases[1].Meta)
+}
+
+func Test_Sqlite_ParseDbMeta(t *testing.T) {
+	assert.Nil(t, parseDbMeta(map[string]string{"content_type": "json"}))
+	assert.Nil(t, parseDbMeta(map[string]string{"rows": "x"}))
+	assert.Equal(t, &dbMeta{Rows: 2, EpochMin: 10, EpochMax: 20, Levels: [4]int64{1, 0, 0, 1}}, parseDbMeta(map[string]string{
+		"rows": "2", "epoch_min": "10", "epoch_max": "20", "levels": "[1,0,0,1]",
+	}))
+}
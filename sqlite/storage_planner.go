@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nidorx/sqlog"
+)
+
+// planEntries queries the databases (sorted in the direction of the search) in parallel, in waves of the size of
+// the connection pool, merging the results (k-way merge on epoch_secs, nanos) until the page is complete.
+//
+// Archived databases are opened on demand, at most MaxOpenedDB at the same time (see acquire).
+func (s *storage) planEntries(ctx context.Context, dbs []*storageDb, before bool, maxResult int, query *dbQuery) ([]*sqlog.EntryView, error) {
+	var (
+		wave = cap(s.archives)
+		list = []*sqlog.EntryView{}
+	)
+
+	for i := 0; i < len(dbs); i += wave {
+		if len(list) >= maxResult && pageComplete(dbs[i:], list[maxResult-1], before) {
+			break
+		}
+
+		var (
+			wg    sync.WaitGroup
+			batch = dbs[i:min(i+wave, len(dbs))]
+			lists = make([][]*sqlog.EntryView, len(batch)+1)
+			errs  = make([]error, len(batch))
+		)
+		lists[0] = list
+
+		for j, db := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				release, err := s.acquire(ctx, db)
+				if err != nil {
+					errs[j] = err
+					return
+				}
+				defer release()
+
+				q, args, err := query.of(db.contentType)
+				if err != nil {
+					errs[j] = err
+					return
+				}
+				lists[j+1], errs[j] = listEntries(ctx, db, q, args)
+			}()
+		}
+		wg.Wait()
+
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		list = mergeEntries(lists, before, maxResult)
+	}
+
+	return list, nil
+}
+
+// pageComplete checks if the remaining databases can't have entries before the last entry of the page
+func pageComplete(rest []*storageDb, last *sqlog.EntryView, before bool) bool {
+	for _, db := range rest {
+		if before {
+			if !db.skip(last.Epoch, math.MaxInt64, nil) {
+				return false
+			}
+		} else if !db.skip(0, last.Epoch, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeEntries merges the lists (each one sorted in the direction of the search) up to maxResult entries
+func mergeEntries(lists [][]*sqlog.EntryView, before bool, maxResult int) []*sqlog.EntryView {
+	var (
+		heads  = make([]int, len(lists))
+		merged = make([]*sqlog.EntryView, 0, maxResult)
+	)
+	for len(merged) < maxResult {
+		next := -1
+		for i, l := range lists {
+			if heads[i] >= len(l) {
+				continue
+			}
+			if next < 0 || entryFirst(l[heads[i]], lists[next][heads[next]], before) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		merged = append(merged, lists[next][heads[next]])
+		heads[next]++
+	}
+	return merged
+}
+
+// entryFirst checks if the entry a comes before b in the direction of the search
+func entryFirst(a, b *sqlog.EntryView, before bool) bool {
+	if before {
+		return a.Epoch > b.Epoch || (a.Epoch == b.Epoch && a.Nanos > b.Nanos)
+	}
+	return a.Epoch < b.Epoch || (a.Epoch == b.Epoch && a.Nanos < b.Nanos)
+}
+
+// acquire ensures the database is open for the query, the returned function must be called after the query.
+//
+// Archived databases take a slot of the connection pool while in use, the connection is closed later
+// by the scheduler routine (CloseIdleSec, MaxOpenedDB).
+func (s *storage) acquire(ctx context.Context, db *storageDb) (release func(), err error) {
+	atomic.AddInt32(&db.readers, 1)
+	done := func() {
+		atomic.StoreInt64(&db.lastUsedEpoch, time.Now().Unix())
+		atomic.AddInt32(&db.readers, -1)
+	}
+
+	if db.isOpen() {
+		return done, nil
+	}
+
+	select {
+	case s.archives <- struct{}{}:
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+	release = func() {
+		done()
+		<-s.archives
+	}
+
+	for !db.isOpen() {
+		if atomic.LoadInt32(&db.status) == db_removing {
+			release()
+			return nil, errors.New("db is removed")
+		}
+		if atomic.LoadInt32(&db.status) == db_remote {
+			// evicted from the local disk, downloaded from the ArchiveStore
+			if err = s.fetch(db); err != nil {
+				release()
+				return nil, err
+			}
+			continue
+		}
+		if err = db.open(s.config.SQLiteOptions); err != nil {
+			release()
+			return nil, err
+		}
+		if db.isOpen() {
+			break
+		}
+		// loading or closing by another goroutine
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return release, nil
+}
+
+// dbQuery is the SQL of a query by the content type of the database (see storageDb.contentType), the expression and
+// the extraction of the fields depend on how the content is encoded. The SQL is built once for each content type.
+type dbQuery struct {
+	mu      sync.Mutex
+	build   func(contentType string) (string, []any, error)
+	queries map[string]*builtQuery
+}
+
+type builtQuery struct {
+	sql  string
+	args []any
+	err  error
+}
+
+// newDbQuery creates the query, built for the content type of the config so that invalid expressions fail fast
+func (s *storage) newDbQuery(build func(contentType string) (string, []any, error)) (*dbQuery, error) {
+	q := &dbQuery{build: build, queries: map[string]*builtQuery{}}
+	if _, _, err := q.of(s.config.ContentType); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// of returns the SQL and args of the query for the content type
+func (q *dbQuery) of(contentType string) (string, []any, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	b, exists := q.queries[contentType]
+	if !exists {
+		b = &builtQuery{}
+		b.sql, b.args, b.err = q.build(contentType)
+		q.queries[contentType] = b
+	}
+	return b.sql, b.args, b.err
+}
+
+// exprBuilder returns the expression builder of the content type, Config.ExprBuilder when set
+func (s *storage) exprBuilder(contentType string) func(expression string) (*Expr, error) {
+	if s.config.ExprBuilder != nil {
+		return s.config.ExprBuilder
+	}
+	if s.config.KeyProvider != nil {
+		return newExprBuilderFn(extractFunction(contentType), sqlDecryptContent)
+	}
+	if contentType == sqlog.ContentTypeMsgpack {
+		return MsgpackExpBuilderFn
+	}
+	return ExpBuilderFn
+}
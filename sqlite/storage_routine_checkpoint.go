@@ -15,13 +15,15 @@ func (s *storage) routineWalCheckpoint() {
 
 		case <-tick.C:
 			var liveOpenDbs []*storageDb
-			s.mu.Lock()
-			for _, db := range s.liveDbs {
-				if db.isOpen() {
-					liveOpenDbs = append(liveOpenDbs, db)
+			for _, p := range s.partitions() {
+				p.mu.Lock()
+				for _, db := range p.liveDbs {
+					if db.isOpen() {
+						liveOpenDbs = append(liveOpenDbs, db)
+					}
 				}
+				p.mu.Unlock()
 			}
-			s.mu.Unlock()
 
 			for _, db := range liveOpenDbs {
 				db.checkpoint(s.config.WalCheckpointMode)
@@ -14,7 +14,10 @@ func (s *storage) routineSizeCheck() {
 		select {
 
 		case <-tick.C:
-			s.doRoutineSizeCheck()
+			// each stream has its own limits
+			for _, p := range s.partitions() {
+				p.doRoutineSizeCheck()
+			}
 			tick.Reset(d)
 
 			// @TODO: compress DB
@@ -26,11 +29,15 @@ func (s *storage) routineSizeCheck() {
 }
 
 func (s *storage) doRoutineSizeCheck() {
+	changed := false
+
 	// archiving dbs
 	if s.liveDbs[len(s.liveDbs)-1].size > int64(s.config.MaxFilesizeMB)*1000000 {
 		nextStart := time.Now().Add(time.Duration(s.config.IntervalSizeCheckSec * 2 * int32(time.Second)))
-		ndb := newDb(s.config.Driver, s.config.Dir, s.config.Prefix, nextStart, s.config.MaxChunkAgeSec)
+		ndb := newDb(s.config.Driver, s.config.Dir, s.config.Prefix, s.config.ContentType, nextStart, s.config.MaxChunkAgeSec)
 		ndb.live = true
+		ndb.stream = s.name
+		ndb.crypt = s.crypt
 		if err := ndb.connect(s.config.SQLiteOptions); err != nil {
 			slog.Warn(
 				"[sqlog] error creating live database",
@@ -42,6 +49,7 @@ func (s *storage) doRoutineSizeCheck() {
 			s.dbs = append(s.dbs, ndb)
 			s.liveDbs = append(s.liveDbs, ndb)
 			s.mu.Unlock()
+			changed = true
 		}
 	}
 
@@ -68,6 +76,7 @@ func (s *storage) doRoutineSizeCheck() {
 		for _, d := range liveDbsInvalid {
 			d.live = false // can be closed
 		}
+		changed = true
 		s.mu.Unlock()
 	}
 
@@ -76,12 +85,22 @@ func (s *storage) doRoutineSizeCheck() {
 		totalSizeBytes += db.size
 	}
 
-	if totalSizeBytes > int64(s.config.MaxSizeTotalMB)*1000000 {
+	if s.config.ArchiveStore != nil {
+		// uploaded instead of deleted, MaxSizeTotalMB is the local disk budget
+		if s.archive() {
+			changed = true
+		}
+	} else if totalSizeBytes > int64(s.config.MaxSizeTotalMB)*1000000 {
 		if olderDb := s.dbs[0]; !olderDb.live {
 			olderDb.remove()
 			s.mu.Lock()
 			s.dbs = s.dbs[1:]
 			s.mu.Unlock()
+			changed = true
 		}
 	}
+
+	if changed {
+		s.saveManifest()
+	}
 }
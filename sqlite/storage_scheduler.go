@@ -1,6 +1,9 @@
 package sqlite
 
 import (
+	"context"
+	"errors"
+	"math"
 	"sort"
 	"sync/atomic"
 	"time"
@@ -16,45 +19,109 @@ const (
 )
 
 type dbTask struct {
-	db       *storageDb                            // Reference to the storage database associated with the task
-	state    int32                                 // Task state: 0=created, 1=processing, 2=finished, 3=canceled
-	output   *sqlog.Output                         // Output of the task
-	callback func(*storageDb, *sqlog.Output) error // Callback function to execute the task logic
+	db       *storageDb                                             // Reference to the storage database associated with the task
+	state    int32                                                  // Task state: 0=created, 1=processing, 2=finished, 3=canceled
+	running  int32                                                  // 1 while the task holds a slot of MaxRunningTasks
+	accessed int64                                                  // Last time (unix) the task was created, polled or finished
+	progress *taskProgress                                          // Progress shared by the tasks of the same search
+	ctx      context.Context                                        // Context of the task, done when the task is canceled
+	cancel   context.CancelFunc                                     // Interrupts the task execution
+	output   *sqlog.Output                                          // Output of the task
+	callback func(context.Context, *storageDb, *sqlog.Output) error // Callback function to execute the task logic
+}
+
+// taskProgress tracks the scheduled tasks of the same search
+type taskProgress struct {
+	epochStart int64 // Time range of the search, zero for the range of the databases
+	epochEnd   int64 //
+	databases  int32 // Number of databases scheduled
+	scanned    int32 // Number of databases already scanned
+	rows       int64 // Rows returned by the databases already scanned
+	total      int64 // Seconds of the time range of the search
+	pending    int64 // Seconds of the time range not covered yet (databases not scanned)
+}
+
+// done registers the scan of the database
+func (p *taskProgress) done(seconds int64, rows int64) {
+	atomic.AddInt32(&p.scanned, 1)
+	atomic.AddInt64(&p.rows, rows)
+	atomic.AddInt64(&p.pending, -seconds)
+}
+
+func (p *taskProgress) get() *sqlog.Progress {
+	progress := &sqlog.Progress{
+		Databases:        int(atomic.LoadInt32(&p.databases)),
+		DatabasesScanned: int(atomic.LoadInt32(&p.scanned)),
+		RowsReturned:     atomic.LoadInt64(&p.rows),
+		Percent:          100,
+	}
+	if p.total > 0 {
+		progress.Percent = math.Round(float64(p.total-atomic.LoadInt64(&p.pending))*10000/float64(p.total)) / 100
+	}
+	return progress
 }
 
 // Result retrieves the result of an asynchronous task processing.
 // If the task has finished or has been canceled, it returns the task output and removes the task from taskMap.
-// Otherwise, it returns a status indicating that the task is still scheduled.
+// Otherwise, it returns a status indicating that the task is still scheduled, with the progress of the search.
+//
+// Finished results are removed after TaskResultTTLSec (see evictTasks).
 func (s *storage) Result(taskId int32) (*sqlog.Output, error) {
 	if v, loaded := s.taskMap.Load(taskId); loaded {
 		task := v.(*dbTask)
-		if task.state == task_finished || task.state == task_canceled {
+		state := atomic.LoadInt32(&task.state)
+		if state == task_finished || state == task_canceled {
 			s.taskMap.Delete(taskId)
+			task.output.Progress = task.progress.get()
 			return task.output, nil
 		} else {
-			return &sqlog.Output{Scheduled: true, TaskIds: []int32{taskId}}, nil
+			atomic.StoreInt64(&task.accessed, time.Now().Unix())
+			return &sqlog.Output{Scheduled: true, TaskIds: []int32{taskId}, Progress: task.progress.get()}, nil
 		}
 	}
 	return nil, nil
 }
 
 // Cancel aborts an asynchronous task processing.
+// A running task has its query interrupted and its slot of MaxRunningTasks is released immediately.
 func (s *storage) Cancel(taskId int32) error {
-	if v, loaded := s.taskMap.Load(taskId); loaded {
+	if v, loaded := s.taskMap.LoadAndDelete(taskId); loaded {
 		task := v.(*dbTask)
 		atomic.StoreInt32(&task.state, task_canceled)
-		task.db.cancel(taskId)
-		s.taskMap.Delete(taskId)
+		task.cancel()
+		s.taskReleased(task)
+		if task.db != nil {
+			task.db.cancel(taskId)
+		}
 	}
 	return nil
 }
 
+// queryContext returns the context used on the execution of the queries, limited by QueryTimeoutSec
+func (s *storage) queryContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, time.Duration(s.config.QueryTimeoutSec)*time.Second)
+}
+
 // schedule creates and schedules a task for each database in the list.
 // The provided callback will be executed for each scheduled task.
-func (s *storage) schedule(dbs []*storageDb, callback func(*storageDb, *sqlog.Output) error) (taskIds []int32) {
+//
+// The time range of the search (epochStart, epochEnd) is used for the progress, when zero the range
+// of the databases is used.
+func (s *storage) schedule(epochStart, epochEnd int64, dbs []*storageDb, callback func(context.Context, *storageDb, *sqlog.Output) error) (taskIds []int32) {
+	progress := &taskProgress{epochStart: epochStart, epochEnd: epochEnd, databases: int32(len(dbs))}
+	for _, db := range dbs {
+		progress.pending += dbSeconds(db, epochStart, epochEnd)
+	}
+	progress.total = progress.pending
+	if epochStart > 0 && epochEnd > epochStart {
+		progress.total = max(progress.pending, epochEnd-epochStart)
+	}
+
+	now := time.Now().Unix()
 	for _, db := range dbs {
 		id := atomic.AddInt32(&s.taskIdSeq, 1)
-		task := &dbTask{callback: callback, output: &sqlog.Output{}}
+		ctx, cancel := context.WithCancel(context.Background())
+		task := &dbTask{db: db, ctx: ctx, cancel: cancel, accessed: now, progress: progress, callback: callback, output: &sqlog.Output{}}
 		s.taskMap.Store(id, task)
 		db.schedule(id, task)
 		taskIds = append(taskIds, id)
@@ -97,8 +164,9 @@ func (s *storage) doRoutineScheduledTasks() {
 		closedWithTasks []*storageDb
 	)
 
-	// Gather information about tasks and databases
-	for _, db := range s.dbs {
+	// Gather information about tasks and databases, including the attached sources
+	dbs := s.allDbs()
+	for _, db := range dbs {
 		tasks := db.tasks()
 		totalTasks += tasks
 		if db.isOpen() {
@@ -113,6 +181,8 @@ func (s *storage) doRoutineScheduledTasks() {
 		}
 	}
 
+	s.evictTasks()
+
 	closedAnyDb := false
 
 	// Process tasks in the currently open databases
@@ -121,29 +191,19 @@ func (s *storage) doRoutineScheduledTasks() {
 		// Maximum number of tasks that can be processed in parallel
 		qtMaxTasks := s.config.MaxRunningTasks - s.numActiveTasks
 		if qtMaxTasks > 0 {
-
-			onDbTask := func(taskId int32, complete bool) {
-				if complete {
-					// @TODO: remove result from taskMap after n seconds
-					atomic.AddInt32(&s.numActiveTasks, -1)
-				} else {
-					atomic.AddInt32(&s.numActiveTasks, 1)
-				}
-			}
-
 			for _, db := range openWithTasks {
 				numTasks := db.tasks()
 				if numTasks == 0 {
 					continue
 				}
 				maxForThisDb := max(1, numTasks/totalTasks*qtMaxTasks)
-				s.executeDbTasks(db, maxForThisDb, onDbTask)
+				s.executeDbTasks(db, maxForThisDb)
 			}
 		}
 	}
 
 	// Close idle databases
-	for _, db := range s.dbs {
+	for _, db := range dbs {
 		if !db.live && db.lastUsedSec() > s.config.CloseIdleSec && db.closeSafe() {
 			totalOpen--
 			closedAnyDb = true
@@ -188,7 +248,7 @@ func (s *storage) doRoutineScheduledTasks() {
 		if totalOpen > s.config.MaxOpenedDB {
 			// Open the database with the fewest tasks
 			for _, db := range closedWithTasks {
-				if err := db.connect(s.config.SQLiteOptions); err == nil {
+				if err := s.openDb(db); err == nil {
 					break
 				}
 			}
@@ -198,7 +258,7 @@ func (s *storage) doRoutineScheduledTasks() {
 				if totalOpen > s.config.MaxOpenedDB {
 					break
 				}
-				if err := db.connect(s.config.SQLiteOptions); err == nil {
+				if err := s.openDb(db); err == nil {
 					totalOpen++
 				}
 			}
@@ -207,16 +267,29 @@ func (s *storage) doRoutineScheduledTasks() {
 
 	// If any database was closed, re-sort the database lists
 	if closedAnyDb {
-		s.mu.Lock()
-		sortDbs(s.dbs)
-		sortDbs(s.liveDbs)
-		s.mu.Unlock()
+		for _, p := range s.partitions() {
+			p.mu.Lock()
+			sortDbs(p.dbs)
+			sortDbs(p.liveDbs)
+			p.mu.Unlock()
+			p.saveManifest() // archived databases saved their meta on close
+		}
 	}
 }
 
+// openDb opens the database for the scheduled tasks. Databases evicted from the local disk are fetched from the
+// ArchiveStore in background, being opened on a next execution of the routine.
+func (s *storage) openDb(db *storageDb) error {
+	if status := atomic.LoadInt32(&db.status); status == db_remote || status == db_fetching {
+		go s.fetch(db)
+		return errors.New("db is remote")
+	}
+	return db.open(s.config.SQLiteOptions)
+}
+
 // executeDbTasks executes a set number of tasks for the given database.
-// Tasks are executed asynchronously, and the task completion is managed via the onTask callback.
-func (s *storage) executeDbTasks(db *storageDb, maxForThisDb int32, onTask func(taskId int32, complete bool)) {
+// Tasks are executed asynchronously, each one holding a slot of MaxRunningTasks until it completes or is canceled.
+func (s *storage) executeDbTasks(db *storageDb, maxForThisDb int32) {
 	i := int32(0)
 	db.execute(func(id int32, task *dbTask) (stops bool) {
 		i++
@@ -225,50 +298,107 @@ func (s *storage) executeDbTasks(db *storageDb, maxForThisDb int32, onTask func(
 			return
 		}
 
-		retries := 0
-		var exec func()
-		exec = func() {
-			if !atomic.CompareAndSwapInt32(&task.state, task_created, task_process) {
-				onTask(id, true)
-				return
-			}
+		if !atomic.CompareAndSwapInt32(&task.state, task_created, task_process) {
+			return
+		}
 
-			if !db.isOpen() {
-				// If the database closed during the task execution
-				if atomic.CompareAndSwapInt32(&task.state, task_process, task_created) {
-					db.schedule(id, task) // Reschedule the task
-				}
-				onTask(id, true)
-				return
-			}
+		s.taskStarted(task)
+		go s.executeTask(db, id, task)
 
-			if err := task.callback(db, task.output); err != nil {
-				if !db.isOpen() {
-					// If the database closed during task execution
-					if atomic.CompareAndSwapInt32(&task.state, task_process, task_created) {
-						db.schedule(id, task) // Reschedule the task
-					}
-					onTask(id, true)
-					return
-				}
+		return
+	})
+}
 
-				if retries < 3 {
-					retries++
-					go exec()
-				} else {
-					task.output.Error = err
-					atomic.CompareAndSwapInt32(&task.state, task_process, task_finished)
-					onTask(id, true)
-				}
-			} else {
-				atomic.CompareAndSwapInt32(&task.state, task_process, task_finished)
-				onTask(id, true)
+// executeTask runs the task callback, retrying up to 3 times on failure.
+// The query is interrupted when the task is canceled or exceeds QueryTimeoutSec, timeouts are not retried.
+// The task finishes with the error when the database is closed during the execution.
+func (s *storage) executeTask(db *storageDb, id int32, task *dbTask) {
+	defer s.taskReleased(task)
+
+	for retries := 0; ; retries++ {
+		if !db.isOpen() {
+			// If the database closed before or during the task execution
+			if atomic.CompareAndSwapInt32(&task.state, task_process, task_created) {
+				db.schedule(id, task) // Reschedule the task
 			}
+			return
 		}
-		onTask(id, false)
 
-		go exec()
+		ctx, cancel := s.queryContext(task.ctx)
+		err := task.callback(ctx, db, task.output)
+		timeout := ctx.Err() != nil
+		cancel()
 
-		return
+		if err == nil {
+			s.taskFinished(task)
+			return
+		}
+
+		if task.ctx.Err() != nil {
+			return // canceled
+		}
+
+		// the error of the interrupted query doesn't always wrap the context error
+		if timeout || errors.Is(err, context.DeadlineExceeded) || !db.isOpen() || retries >= 3 {
+			task.output.Error = err
+			s.taskFinished(task)
+			return
+		}
+	}
+}
+
+// taskStarted reserves a slot of MaxRunningTasks for the task
+func (s *storage) taskStarted(task *dbTask) {
+	if atomic.CompareAndSwapInt32(&task.running, 0, 1) {
+		atomic.AddInt32(&s.numActiveTasks, 1)
+	}
+}
+
+// taskReleased frees the slot of the task, only once (on completion or cancellation)
+func (s *storage) taskReleased(task *dbTask) {
+	if atomic.CompareAndSwapInt32(&task.running, 1, 0) {
+		atomic.AddInt32(&s.numActiveTasks, -1)
+	}
+}
+
+// taskFinished completes the task and updates the progress of the search
+func (s *storage) taskFinished(task *dbTask) {
+	if atomic.CompareAndSwapInt32(&task.state, task_process, task_finished) {
+		atomic.StoreInt64(&task.accessed, time.Now().Unix())
+		o, p := task.output, task.progress
+		p.done(dbSeconds(task.db, p.epochStart, p.epochEnd), int64(len(o.Ticks)+len(o.Entries)+len(o.Aggregate)+len(o.Fields)))
+	}
+}
+
+// evictTasks removes the finished results not retrieved and cancels the pending tasks not polled
+// within TaskResultTTLSec
+func (s *storage) evictTasks() {
+	limit := time.Now().Unix() - int64(s.config.TaskResultTTLSec)
+	s.taskMap.Range(func(key, value any) bool {
+		task := value.(*dbTask)
+		if atomic.LoadInt64(&task.accessed) >= limit {
+			return true
+		}
+		if atomic.LoadInt32(&task.state) == task_finished {
+			s.taskMap.Delete(key)
+		} else {
+			s.Cancel(key.(int32))
+		}
+		return true
 	})
 }
+
+// dbSeconds returns the seconds of the database time range, limited to the range of the search (when not zero)
+func dbSeconds(db *storageDb, epochStart, epochEnd int64) int64 {
+	start, end := db.epochStart, db.epochEnd
+	if end == 0 {
+		end = time.Now().Unix()
+	}
+	if epochStart > 0 {
+		start = max(start, epochStart)
+	}
+	if epochEnd > 0 {
+		end = min(end, epochEnd)
+	}
+	return max(end-start, 1)
+}
@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_QueryTimeout(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	mockQueryWait = func(query string) bool {
+		return strings.HasPrefix(query, "SELECT e.epoch_secs")
+	}
+	defer func() { mockQueryWait = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, QueryTimeoutSec: 1})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	start := time.Now()
+	_, err = storage.Entries(&sqlog.EntriesInput{EpochStart: time.Now().Unix()})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	// interrupted by the context of the caller
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = storage.EntriesContext(ctx, &sqlog.EntriesInput{EpochStart: time.Now().Unix()})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func Test_Sqlite_CancelTask(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	mockQueryWait = func(query string) bool {
+		return query == "SELECT 1"
+	}
+	defer func() { mockQueryWait = nil }()
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, IntervalScheduledTasksMs: 10})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	var (
+		interrupted atomic.Value
+		done        = make(chan struct{})
+	)
+	taskIds := storage.schedule(0, 0, storage.dbs[:1], func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+		defer close(done)
+		_, _, err := db.query(ctx, "SELECT 1", nil)
+		interrupted.Store(err)
+		return err
+	})
+	assert.Equal(t, 1, len(taskIds))
+
+	waitMax(3*time.Second, func() bool {
+		return atomic.LoadInt32(&storage.numActiveTasks) == 1
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&storage.numActiveTasks))
+
+	assert.Nil(t, storage.Cancel(taskIds[0]))
+
+	// the slot is released immediately, the query is interrupted
+	assert.Equal(t, int32(0), atomic.LoadInt32(&storage.numActiveTasks))
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("task not interrupted")
+	}
+	assert.ErrorIs(t, interrupted.Load().(error), context.Canceled)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&storage.numActiveTasks))
+
+	out, err := storage.Result(taskIds[0])
+	assert.Nil(t, err)
+	assert.Nil(t, out)
+}
+
+func Test_Sqlite_TaskErrors(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, IntervalScheduledTasksMs: 10, QueryTimeoutSec: 1})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	result := func(id int32) *sqlog.Output {
+		var out *sqlog.Output
+		waitMax(5*time.Second, func() bool {
+			out, _ = storage.Result(id)
+			return out != nil && !out.Scheduled
+		})
+		return out
+	}
+
+	// timed out, the error of the driver doesn't wrap the context error
+	var attempts int32
+	taskIds := storage.schedule(0, 0, storage.dbs[:1], func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+		atomic.AddInt32(&attempts, 1)
+		<-ctx.Done()
+		return errors.New("interrupted")
+	})
+	out := result(taskIds[0])
+	assert.NotNil(t, out)
+	assert.EqualError(t, out.Error, "interrupted")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// the database closed during the execution
+	db := &storageDb{filePath: "unknown.db", driver: "sqlite3", status: db_open}
+	taskIds = storage.schedule(0, 0, []*storageDb{db}, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+		atomic.StoreInt32(&db.status, db_closed)
+		return errors.New("database is closed")
+	})
+	v, _ := storage.taskMap.Load(taskIds[0])
+	task := v.(*dbTask)
+	task.state = task_process
+	storage.executeTask(db, taskIds[0], task)
+	out = result(taskIds[0])
+	assert.NotNil(t, out)
+	assert.EqualError(t, out.Error, "database is closed")
+}
+
+func Test_Sqlite_TaskProgress(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, IntervalScheduledTasksMs: 10})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	var (
+		release = make(chan struct{})
+		end     = time.Now().Unix()
+		db      = storage.dbs[0]
+	)
+	db.epochStart = end - 100
+
+	taskIds := storage.schedule(end-400, end, []*storageDb{db}, func(ctx context.Context, db *storageDb, o *sqlog.Output) error {
+		<-release
+		o.Entries = []*sqlog.EntryView{{}, {}, {}}
+		return nil
+	})
+
+	out, err := storage.Result(taskIds[0])
+	assert.Nil(t, err)
+	assert.True(t, out.Scheduled)
+	assert.Equal(t, &sqlog.Progress{Databases: 1, Percent: 75}, out.Progress)
+
+	close(release)
+	waitMax(3*time.Second, func() bool {
+		out, _ = storage.Result(taskIds[0])
+		return !out.Scheduled
+	})
+	assert.False(t, out.Scheduled)
+	assert.Equal(t, 3, len(out.Entries))
+	assert.Equal(t, &sqlog.Progress{Databases: 1, DatabasesScanned: 1, RowsReturned: 3, Percent: 100}, out.Progress)
+}
+
+func Test_Sqlite_TaskEviction(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	// tasks are not executed during the test
+	storage, err := New(&Config{Dir: storageDir, Prefix: storagePrefix, IntervalScheduledTasksMs: 60000})
+	assert.Nil(t, err)
+	defer storage.Close()
+
+	callback := func(ctx context.Context, db *storageDb, o *sqlog.Output) error { return nil }
+	finished := storage.schedule(0, 0, storage.dbs[:1], callback)[0]
+	pending := storage.schedule(0, 0, storage.dbs[:1], callback)[0]
+
+	v, _ := storage.taskMap.Load(finished)
+	task := v.(*dbTask)
+	atomic.StoreInt32(&task.state, task_finished)
+
+	storage.evictTasks()
+	_, exists := storage.taskMap.Load(finished)
+	assert.True(t, exists)
+
+	// not retrieved/polled within TaskResultTTLSec
+	for _, id := range []int32{finished, pending} {
+		v, _ := storage.taskMap.Load(id)
+		atomic.StoreInt64(&v.(*dbTask).accessed, time.Now().Unix()-int64(storage.config.TaskResultTTLSec)-1)
+	}
+
+	pendingTask, _ := storage.taskMap.Load(pending)
+
+	storage.evictTasks()
+	_, exists = storage.taskMap.Load(finished)
+	assert.False(t, exists)
+	_, exists = storage.taskMap.Load(pending)
+	assert.False(t, exists)
+	assert.Equal(t, task_canceled, atomic.LoadInt32(&pendingTask.(*dbTask).state))
+	assert.NotNil(t, pendingTask.(*dbTask).ctx.Err())
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/nidorx/sqlog"
+)
+
+// streamsDir is the directory of the partitions of the streams, inside Config.Dir
+const streamsDir = "streams"
+
+// streamName normalizes the name of the stream, the default stream has an empty name.
+// The characters other than [a-z0-9_-] are replaced by "_", so "a.b" and "a_b" are the same stream.
+func streamName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == sqlog.DefaultStream {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// streamConfig returns the config of the partition of the stream, inheriting the limits not set on Config.Streams
+func (s *storage) streamConfig(name string) *Config {
+	config := *s.config
+	config.Dir = path.Join(s.config.Dir, streamsDir, name)
+	config.Streams = nil
+
+	for key, limits := range s.config.Streams {
+		if streamName(key) != name || limits == nil {
+			continue
+		}
+		if limits.MaxChunkAgeSec > 0 {
+			config.MaxChunkAgeSec = limits.MaxChunkAgeSec
+		}
+		if limits.MaxFilesizeMB > 0 {
+			config.MaxFilesizeMB = limits.MaxFilesizeMB
+		}
+		if limits.MaxSizeTotalMB > 0 {
+			config.MaxSizeTotalMB = limits.MaxSizeTotalMB
+		}
+	}
+	return &config
+}
+
+// declaredStream checks if the stream is declared on Config.Streams
+func (s *storage) declaredStream(name string) bool {
+	for key := range s.config.Streams {
+		if streamName(key) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stream returns the partition of the stream, creating it on the first use. Above Config.MaxStreams, the streams
+// not declared on Config.Streams are saved on the default stream.
+func (s *storage) stream(name string) (*storage, error) {
+	name = streamName(name)
+	if name == "" {
+		return s, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, exists := s.streams[name]; exists {
+		return p, nil
+	}
+
+	if len(s.streams) >= s.config.MaxStreams && !s.declaredStream(name) {
+		if !s.streamsFull {
+			s.streamsFull = true
+			slog.Warn(
+				"[sqlog] maximum number of streams reached, new streams are saved on the default stream",
+				slog.Int("max", s.config.MaxStreams),
+				slog.String("stream", name),
+			)
+		}
+		return s, nil
+	}
+
+	return s.startStream(name)
+}
+
+// startStream starts the partition of the stream, must be called with s.mu locked
+func (s *storage) startStream(name string) (*storage, error) {
+	p, err := newPartition(s.streamConfig(name), name)
+	if err != nil {
+		return nil, errors.Join(errors.New("[sqlog] unable to start stream "+name), err)
+	}
+	s.streams[name] = p
+	p.saveManifest()
+	return p, nil
+}
+
+// loadStreams starts the partitions of the streams saved on the previous executions
+func (s *storage) loadStreams() error {
+	entries, err := os.ReadDir(path.Join(s.config.Dir, streamsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || streamName(entry.Name()) != entry.Name() {
+			continue
+		}
+		// the streams saved are always loaded, even above MaxStreams
+		s.mu.Lock()
+		_, err := s.startStream(entry.Name())
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitions returns this storage (default stream) followed by the partitions of the streams, sorted by name
+func (s *storage) partitions() []*storage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []*storage{s}
+	for _, p := range s.streams {
+		list = append(list, p)
+	}
+	slices.SortFunc(list[1:], func(a, b *storage) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return list
+}
+
+// Streams lists the names of the streams, the default stream first
+func (s *storage) Streams() []string {
+	names := []string{sqlog.DefaultStream}
+	for _, p := range s.partitions()[1:] {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// streamDbs returns the databases of the streams, all the streams when empty.
+// Streams that have not received entries are ignored.
+func (s *storage) streamDbs(streams []string) []*storageDb {
+	var dbs []*storageDb
+	for _, p := range s.partitions() {
+		if len(streams) > 0 && !slices.ContainsFunc(streams, func(name string) bool {
+			return streamName(name) == p.name
+		}) {
+			continue
+		}
+		p.mu.Lock()
+		dbs = append(dbs, p.dbs...)
+		p.mu.Unlock()
+	}
+	return dbs
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nidorx/sqlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sqlite_Streams(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	config := &Config{
+		Dir:    storageDir,
+		Prefix: storagePrefix,
+		Streams: map[string]*StreamConfig{
+			"Billing": {MaxSizeTotalMB: 5},
+		},
+	}
+	storage, err := New(config)
+	assert.Nil(t, err)
+
+	chunk := sqlog.NewChunk(10)
+	for i, stream := range []string{"", "Billing", "api", "default", "billing"} {
+		chunk.Put(&sqlog.Entry{Time: time.Now(), Stream: stream, Content: []byte(fmt.Sprintf(`{"msg":"%d"}`, i))})
+	}
+	assert.Nil(t, storage.Flush(chunk))
+
+	assert.Equal(t, []string{"default", "api", "billing"}, storage.Streams())
+
+	billing, err := storage.stream("billing")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(storageDir, "streams", "billing"), billing.config.Dir)
+	assert.Equal(t, int32(5), billing.config.MaxSizeTotalMB)
+	assert.Equal(t, config.MaxFilesizeMB, billing.config.MaxFilesizeMB)
+
+	api, err := storage.stream("api")
+	assert.Nil(t, err)
+	assert.Equal(t, config.MaxSizeTotalMB, api.config.MaxSizeTotalMB)
+
+	// entries routed to the partition of the stream
+	content := func(db *storageDb) string {
+		b, _ := os.ReadFile(db.filePath + "-wal")
+		return string(b)
+	}
+	assert.Contains(t, content(storage.liveDbs[0]), `{"msg":"0"}`)
+	assert.Contains(t, content(storage.liveDbs[0]), `{"msg":"3"}`)
+	assert.NotContains(t, content(storage.liveDbs[0]), `{"msg":"1"}`)
+	assert.Contains(t, content(billing.liveDbs[0]), `{"msg":"1"}`)
+	assert.Contains(t, content(billing.liveDbs[0]), `{"msg":"4"}`)
+	assert.NotContains(t, content(billing.liveDbs[0]), `{"msg":"2"}`)
+	assert.Contains(t, content(api.liveDbs[0]), `{"msg":"2"}`)
+
+	assert.Equal(t, 1, len(storage.streamDbs([]string{"billing"})))
+	assert.Equal(t, "billing", storage.streamDbs([]string{"billing"})[0].stream)
+	assert.Equal(t, 2, len(storage.streamDbs([]string{"default", "api", "unknown"})))
+	assert.Equal(t, 3, len(storage.streamDbs(nil)))
+
+	// queries target one stream, several or all
+	var (
+		mu      sync.Mutex
+		queried []string
+	)
+	mockQueryDbHook = func(dsn string, q string, a []driver.Value) ([]string, [][]any, bool) {
+		if !bytes.HasPrefix([]byte(q), sqlSeekPageBefore) {
+			return nil, nil, false
+		}
+		dir := filepath.Base(path.Dir(strings.Split(strings.TrimPrefix(dsn, "file:"), "?")[0]))
+		mu.Lock()
+		queried = append(queried, dir)
+		mu.Unlock()
+		return []string{"epoch_secs", "nanos", "level", "content"}, [][]any{
+			{time.Now().Unix(), int64(0), int64(0), []byte(`{"msg":"` + dir + `"}`)},
+		}, true
+	}
+	defer func() { mockQueryDbHook = nil }()
+
+	out, err := storage.Entries(&sqlog.EntriesInput{Direction: "before", MaxResult: 10, Streams: []string{"billing"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"billing"}, queried)
+	assert.Equal(t, 1, len(out.Entries))
+	assert.Equal(t, "billing", out.Entries[0].Stream)
+
+	queried = nil
+	out, err = storage.Entries(&sqlog.EntriesInput{Direction: "before", MaxResult: 10})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"logs", "api", "billing"}, queried)
+	assert.Equal(t, 3, len(out.Entries))
+
+	// each stream is copied to its directory
+	backupDir := "testdata/backup"
+	testClearDir(backupDir)
+	defer testClearDir(backupDir)
+	assert.Nil(t, storage.Backup(context.Background(), backupDir))
+	m, err := readManifest(path.Join(backupDir, "streams", "billing"), storagePrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(m.Databases))
+	assert.FileExists(t, path.Join(backupDir, "streams", "billing", m.Databases[0].File))
+
+	storage.Close()
+
+	// streams of the previous execution
+	storage, err = New(config)
+	assert.Nil(t, err)
+	defer storage.Close()
+	assert.Equal(t, []string{"default", "api", "billing"}, storage.Streams())
+
+	m, err = readManifest(path.Join(storageDir, "streams", "billing"), storagePrefix)
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+}
+
+func Test_Sqlite_MaxStreams(t *testing.T) {
+	testClearDir(storageDir)
+	defer testClearDir(storageDir)
+
+	config := &Config{
+		Dir:        storageDir,
+		Prefix:     storagePrefix,
+		MaxStreams: 1,
+		Streams:    map[string]*StreamConfig{"billing": {}},
+	}
+	storage, err := New(config)
+	assert.Nil(t, err)
+
+	for i, stream := range []string{"api", "web", "billing"} {
+		chunk := sqlog.NewChunk(10)
+		chunk.Put(&sqlog.Entry{Time: time.Now(), Stream: stream, Content: []byte(fmt.Sprintf(`{"msg":"%d"}`, i))})
+		assert.Nil(t, storage.Flush(chunk))
+	}
+
+	// declared streams are always accepted, the others above the limit are saved on the default stream
+	assert.Equal(t, []string{"default", "api", "billing"}, storage.Streams())
+
+	web, err := storage.stream("web")
+	assert.Nil(t, err)
+	assert.Equal(t, storage, web)
+	wal, _ := os.ReadFile(storage.liveDbs[0].filePath + "-wal")
+	assert.Equal(t, 1, strings.Count(string(wal), `{"msg":`))
+
+	storage.Close()
+
+	// the streams saved are loaded even above the limit
+	config.Streams = nil
+	storage, err = New(config)
+	assert.Nil(t, err)
+	defer storage.Close()
+	assert.Equal(t, 3, len(storage.Streams()))
+}
+
+func Test_Sqlite_StreamName(t *testing.T) {
+	assert.Equal(t, "", streamName(""))
+	assert.Equal(t, "", streamName(sqlog.DefaultStream))
+	assert.Equal(t, "", streamName(" Default "))
+	assert.Equal(t, "billing", streamName("Billing"))
+	assert.Equal(t, "tenant_a_api", streamName("tenant/a.api"))
+	assert.Equal(t, "web-1", streamName("web-1"))
+
+	// different names, same stream
+	assert.Equal(t, streamName("a.b"), streamName("A_B"))
+}
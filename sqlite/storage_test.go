@@ -20,10 +20,12 @@ const (
 	storagePrefix = "test"
 )
 
+var testDriver = &mockDriver{
+	conns: make(map[string]*mockDriverConn),
+}
+
 func init() {
-	sql.Register("sqlite3", &mockDriver{
-		conns: make(map[string]*mockDriverConn),
-	})
+	sql.Register("sqlite3", testDriver)
 }
 
 func Test_Sqlite_Simple(t *testing.T) {
@@ -220,6 +222,14 @@ func Test_Sqlite_WALCheckpoint(t *testing.T) {
 	assert.Greater(t, testGetFileSize(db.filePath), int64(1000*1024))
 }
 
+// testWriteDb creates a database file with the current schema version, archives with older versions are migrated on
+// a temporary copy when opened (see Test_Sqlite_MigrateReadOnly)
+func testWriteDb(t *testing.T, file string, content []byte) {
+	assert.Nil(t, os.WriteFile(file, content, 0644))
+	testDriver.versions.Store(file, dbSchemaVersion)
+	t.Cleanup(func() { testDriver.versions.Delete(file) })
+}
+
 func testClearDir(dir string) {
 	if err := os.RemoveAll(dir); err != nil {
 		panic(err)
@@ -263,3 +273,20 @@ func randString(n int) string {
 
 	return *(*string)(unsafe.Pointer(&b))
 }
+
+func Test_Sqlite_SortDbs(t *testing.T) {
+	dbs := []*storageDb{
+		{filePath: "live", epochStart: 40},
+		{filePath: "newer", epochStart: 20, epochEnd: 30},
+		{filePath: "older", epochStart: 1, epochEnd: 10},
+		{filePath: "middle", epochStart: 11, epochEnd: 19},
+	}
+	sortDbs(dbs)
+
+	var files []string
+	for _, db := range dbs {
+		files = append(files, db.filePath)
+	}
+	// the oldest is the first removed by MaxSizeTotalMB
+	assert.Equal(t, []string{"older", "middle", "newer", "live"}, files)
+}
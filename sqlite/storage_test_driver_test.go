@@ -1,19 +1,22 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 )
 
 type mockDriver struct {
-	mu    sync.Mutex
-	conns map[string]*mockDriverConn
+	mu       sync.Mutex
+	conns    map[string]*mockDriverConn
+	versions sync.Map // PRAGMA user_version by file
 }
 
 func (d *mockDriver) Open(dsn string) (driver.Conn, error) {
@@ -29,13 +32,19 @@ func (d *mockDriver) Open(dsn string) (driver.Conn, error) {
 		return nil, err
 	}
 
+	// "file:relative/path.db" or "file:/absolute/path.db"
+	name := url.Opaque
+	if name == "" {
+		name = url.Path
+	}
+
 	// simulate sqlite wal
-	file, err := os.OpenFile(url.Opaque, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0755)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	wal, err := os.OpenFile(url.Opaque+"-wal", os.O_CREATE|os.O_RDWR, 0755)
+	wal, err := os.OpenFile(name+"-wal", os.O_CREATE|os.O_RDWR, 0755)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +136,21 @@ func (s *mockStmt) NumInput() int {
 	return -1
 }
 
+// mockExecHook allows tests to inspect the executed statements
+var mockExecHook func(dsn string, query string, args []driver.Value)
+
 func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if hook := mockExecHook; hook != nil {
+		hook(s.conn.dsn, s.query, args)
+	}
+	if version, found := strings.CutPrefix(s.query, sqlUserVersion+" = "); found {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, err
+		}
+		s.conn.driver.versions.Store(s.conn.file.Name(), v)
+		return &mockResult{}, nil
+	}
 	if strings.Contains(s.query, "INSERT INTO entries") { // (epoch_secs, nanos, level, content)
 		if s.conn.tx == nil {
 			return nil, errors.New("transaction required")
@@ -169,6 +192,23 @@ func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
 		})
 
 		return &mockResult{last: id, rows: rows}, nil
+	} else if s.query == "VACUUM INTO ?" {
+		// snapshot of db + wal
+		s.conn.mu.Lock()
+		defer s.conn.mu.Unlock()
+
+		db, err := os.ReadFile(s.conn.file.Name())
+		if err != nil {
+			return nil, err
+		}
+		wal, err := os.ReadFile(s.conn.wal.Name())
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(args[0].(string), append(db, wal...), 0644); err != nil {
+			return nil, err
+		}
+		return &mockResult{}, nil
 	} else if s.query == "VACUUM" || strings.Contains(s.query, "PRAGMA wal_checkpoint") {
 		// copy from wal to db
 		if s.conn.tx != nil {
@@ -195,7 +235,30 @@ func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
 	return &mockResult{}, nil
 }
 
+// mockQueryHook allows tests to return rows for SELECT queries
+var mockQueryHook func(query string, args []driver.Value) (columns []string, values [][]any, ok bool)
+
+// mockQueryDbHook same as mockQueryHook, also receiving the dsn of the database
+var mockQueryDbHook func(dsn string, query string, args []driver.Value) (columns []string, values [][]any, ok bool)
+
 func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query == sqlUserVersion {
+		version, _ := s.conn.driver.versions.Load(s.conn.file.Name())
+		if version == nil {
+			version = 0
+		}
+		return &mockRows{columns: []string{"user_version"}, values: [][]any{{int64(version.(int))}}}, nil
+	}
+	if hook := mockQueryDbHook; hook != nil {
+		if columns, values, ok := hook(s.conn.dsn, s.query, args); ok {
+			return &mockRows{columns: columns, values: values}, nil
+		}
+	}
+	if hook := mockQueryHook; hook != nil {
+		if columns, values, ok := hook(s.query, args); ok {
+			return &mockRows{columns: columns, values: values}, nil
+		}
+	}
 	if strings.Contains(s.query, "page_count * page_size") {
 		s.conn.mu.Lock()
 		defer s.conn.mu.Unlock()
@@ -211,6 +274,21 @@ func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
 	return &mockRows{}, nil
 }
 
+// mockQueryWait allows tests to block a query until its context is done
+var mockQueryWait func(query string) bool
+
+func (s *mockStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if wait := mockQueryWait; wait != nil && wait(s.query) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return s.Query(values)
+}
+
 type mockResult struct {
 	last int64
 	rows int64
@@ -254,6 +332,9 @@ func (r *mockRows) Next(dest []driver.Value) error {
 }
 
 func testGetFileSize(file string) int64 {
-	info, _ := os.Stat(file)
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0 // removed
+	}
 	return info.Size()
 }
@@ -3,6 +3,7 @@ package sqlite
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path"
@@ -13,7 +14,7 @@ import (
 	"time"
 )
 
-func newDb(driver, dir, prefix string, start time.Time, maxChunkAgeSec int64) *storageDb {
+func newDb(driver, dir, prefix, contentType string, start time.Time, maxChunkAgeSec int64) *storageDb {
 
 	epochStart := start.Unix()
 	name := fmt.Sprintf("%s_%d.db", prefix, epochStart)
@@ -29,6 +30,7 @@ func newDb(driver, dir, prefix string, start time.Time, maxChunkAgeSec int64) *s
 		maxChunkAgeSec: maxChunkAgeSec,
 		epochEnd:       0,
 		driver:         driver,
+		contentType:    contentType,
 	}
 }
 
@@ -43,6 +45,9 @@ func initDbs(driver, dir, prefix string) (dbs []*storageDb, err error) {
 			return err
 		}
 		if info.IsDir() {
+			if filepath != dir {
+				return fs.SkipDir // streams and other storages
+			}
 			return nil
 		}
 
@@ -51,34 +56,22 @@ func initDbs(driver, dir, prefix string) (dbs []*storageDb, err error) {
 			return nil
 		}
 
-		var (
-			epochStart int64
-			epochEnd   int64
-		)
-
-		epochs := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, prefix+"_"), ".db"), "_")
-
-		epochStart, err = strconv.ParseInt(epochs[0], 10, 64)
+		epochStart, epochEnd, err := parseDbName(prefix, name)
 		if err != nil {
 			slog.Warn("[sqlog] invalid database name", slog.String("filepath", filepath), slog.Any("err", err))
 			return nil
 		}
 
-		if len(epochs) > 1 {
-			epochEnd, err = strconv.ParseInt(epochs[1], 10, 64)
-			if err != nil {
-				slog.Warn("[sqlog] invalid database name", slog.String("filepath", filepath), slog.Any("err", err))
-				return nil
-			}
-		}
-
 		dbs = append(dbs, &storageDb{
-			filePath:   path.Join(dir, name),
-			size:       info.Size(), // live db will updated during execution
-			status:     db_closed,
-			epochStart: epochStart,
-			epochEnd:   epochEnd,
-			driver:     driver,
+			fileDir:       dir,
+			filePath:      path.Join(dir, name),
+			filePrefix:    prefix,
+			size:          info.Size(), // live db will updated during execution
+			status:        db_closed,
+			epochStart:    epochStart,
+			newEpochStart: epochStart,
+			epochEnd:      epochEnd,
+			driver:        driver,
 		})
 
 		return nil
@@ -94,6 +87,22 @@ func initDbs(driver, dir, prefix string) (dbs []*storageDb, err error) {
 	return
 }
 
+// parseDbName returns the epoch range of the database file name ("{prefix}_{start}.db" or "{prefix}_{start}_{end}.db")
+func parseDbName(prefix, name string) (epochStart int64, epochEnd int64, err error) {
+	epochs := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, prefix+"_"), ".db"), "_")
+
+	if epochStart, err = strconv.ParseInt(epochs[0], 10, 64); err != nil {
+		return
+	}
+	if len(epochs) > 1 {
+		epochEnd, err = strconv.ParseInt(epochs[1], 10, 64)
+	}
+	return
+}
+
+// sortDbs sorts the databases from the oldest to the newest, the databases without epochEnd (live) last.
+// The size check removes the first database (the oldest) when MaxSizeTotalMB is exceeded, and the storage
+// starts with the last one as live.
 func sortDbs(dbs []*storageDb) {
 	sort.SliceStable(dbs, func(i, j int) bool {
 		ae := dbs[i].epochEnd
@@ -110,6 +119,37 @@ func sortDbs(dbs []*storageDb) {
 			return false
 		}
 
-		return ae > be
+		return ae < be
 	})
 }
+
+// sqlLevelsFilter returns the SQL condition for the levels ["debug","info","warn","error"]
+func sqlLevelsFilter(level []string) string {
+	var (
+		levels  = map[string]bool{}
+		clauses []string
+	)
+	for _, v := range level {
+		levels[v] = true
+	}
+	if len(levels) == 0 || len(levels) == 4 {
+		return ""
+	}
+
+	if levels["debug"] {
+		clauses = append(clauses, "e.level < 0")
+	}
+	if levels["info"] {
+		clauses = append(clauses, "(e.level BETWEEN 0 AND 3)")
+	}
+	if levels["warn"] {
+		clauses = append(clauses, "(e.level BETWEEN 4 AND 7)")
+	}
+	if levels["error"] {
+		clauses = append(clauses, "e.level >= 8")
+	}
+	if len(clauses) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")"
+}
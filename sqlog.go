@@ -1,6 +1,8 @@
 package sqlog
 
 import (
+	"context"
+	"iter"
 	"log/slog"
 	"net/http"
 	"os"
@@ -11,6 +13,7 @@ type Config struct {
 	Storage  Storage
 	Handler  *HandlerConfig
 	Ingester *IngesterConfig
+	Alerts   *AlertsConfig
 }
 
 // Log SQLog interface
@@ -23,8 +26,19 @@ type Log interface {
 	// Handler returns the primary log handler
 	Handler() slog.Handler
 
+	// WithStream returns a handler whose records are routed to the stream, a partition of the storage
+	// with its own retention and size limits (Ex. tenant or component). See DefaultStream.
+	WithStream(name string) slog.Handler
+
+	// Levels returns the registry used to change the log level at runtime
+	Levels() *LevelRegistry
+
+	// Alerts returns the alerting engine, used to manage the alert rules
+	Alerts() *Alerts
+
 	// Fanout distributes logs to multiple slog.Handler instances in parallel.
 	// This allows logs to be processed by several handlers simultaneously.
+	// Use NewFanout to configure each handler individually.
 	Fanout(...slog.Handler)
 
 	// Ticks api
@@ -33,6 +47,33 @@ type Log interface {
 	// Entries api
 	Entries(*EntriesInput) (*Output, error)
 
+	// Query iterates over the entries, walking the archived databases and honouring the context cancellation
+	Query(ctx context.Context, input QueryInput) iter.Seq2[EntryView, error]
+
+	// GetEntry api, entry by id (see EntryID)
+	GetEntry(id string) (*EntryView, error)
+
+	// EntriesContext api, entries surrounding an entry
+	EntriesContext(*EntriesContextInput) (*Output, error)
+
+	// Aggregate api, waits for the scheduled results
+	Aggregate(*AggregateInput) (*Output, error)
+
+	// Pipeline executes a pipe-style expression (Ex. "status:>=500 | stats count() by route | sort -count | head 10")
+	Pipeline(*PipelineInput) (*Table, error)
+
+	// Fields api, attributes seen in the matching entries
+	Fields(*FieldsInput) ([]*Field, error)
+
+	// Facets api, top values of a field
+	Facets(*FacetsInput) ([]*Facet, error)
+
+	// Sources api, sets of logs attached to the storage (see StorageWithSources)
+	Sources() []*Source
+
+	// Streams api, names of the streams of the storage (see StorageWithStreams)
+	Streams() []string
+
 	// Result scheduled result api
 	Result(taskId int32) (*Output, error)
 
@@ -49,11 +90,41 @@ type Log interface {
 	// ServeHTTPEntries handles HTTP requests for Entries api
 	ServeHTTPEntries(w http.ResponseWriter, r *http.Request)
 
+	// ServeHTTPEntry handles HTTP requests for GetEntry api
+	ServeHTTPEntry(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPEntriesContext handles HTTP requests for EntriesContext api
+	ServeHTTPEntriesContext(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPAggregate handles HTTP requests for Aggregate api
+	ServeHTTPAggregate(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPPipeline handles HTTP requests for Pipeline api
+	ServeHTTPPipeline(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPFields handles HTTP requests for Fields api
+	ServeHTTPFields(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPFacets handles HTTP requests for Facets api
+	ServeHTTPFacets(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPSources handles HTTP requests for Sources api
+	ServeHTTPSources(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPStreams handles HTTP requests for Streams api
+	ServeHTTPStreams(w http.ResponseWriter, r *http.Request)
+
 	// ServeHTTPEntries handles HTTP requests for scheduled result api
 	ServeHTTPResult(w http.ResponseWriter, r *http.Request)
 
 	// ServeHTTPEntries handles HTTP requests to cancel scheduled result api
 	ServeHTTPCancel(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPLevel handles HTTP requests to get (GET) and change (PUT) the log level
+	ServeHTTPLevel(w http.ResponseWriter, r *http.Request)
+
+	// ServeHTTPAlerts handles HTTP requests to list (GET), save (POST, PUT) and delete (DELETE) alert rules
+	ServeHTTPAlerts(w http.ResponseWriter, r *http.Request)
 }
 
 type sqlog struct {
@@ -62,6 +133,7 @@ type sqlog struct {
 	handler  *handler
 	storage  Storage
 	ingester *ingester
+	alerts   *Alerts
 }
 
 func New(config *Config) (*sqlog, error) {
@@ -79,10 +151,17 @@ func New(config *Config) (*sqlog, error) {
 		return nil, err
 	}
 
+	alerts, err := newAlerts(config.Alerts, storage)
+	if err != nil {
+		ingester.Close()
+		return nil, err
+	}
+
 	return &sqlog{
 		config:   config,
 		storage:  storage,
 		ingester: ingester,
+		alerts:   alerts,
 		handler:  newHandler(ingester, config.Handler),
 	}, nil
 }
@@ -91,6 +170,18 @@ func (l *sqlog) Handler() slog.Handler {
 	return l.handler
 }
 
+func (l *sqlog) WithStream(name string) slog.Handler {
+	return l.handler.WithStream(name)
+}
+
+func (l *sqlog) Levels() *LevelRegistry {
+	return l.handler.levels
+}
+
+func (l *sqlog) Alerts() *Alerts {
+	return l.alerts
+}
+
 func (l *sqlog) Fanout(handlers ...slog.Handler) {
 	l.handler.fanout(handlers...)
 }
@@ -101,6 +192,8 @@ func (l *sqlog) Stop() {
 			// we will no longer be able to write the log
 			slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 		}
+		l.alerts.close()
+		l.handler.close()
 		if err := l.ingester.Close(); err != nil {
 			slog.Warn(
 				"[sqlog] error closing",
@@ -1,5 +1,10 @@
 package sqlog
 
+import (
+	"context"
+	"time"
+)
+
 type Tick struct {
 	Index int   `json:"index"`
 	Start int64 `json:"epoch_start"`
@@ -17,6 +22,8 @@ type TicksInput struct {
 	EpochEnd    int64    `json:"epoch"`
 	IntervalSec int      `json:"interval"`
 	MaxResult   int      `json:"limit"`
+	Source      string   `json:"source"`  // Label of the attached source, empty for the live storage
+	Streams     []string `json:"streams"` // Names of the streams (Default: all)
 }
 
 type EntriesInput struct {
@@ -26,14 +33,28 @@ type EntriesInput struct {
 	EpochStart int64    `json:"epoch"` // @TODO: add epochMax
 	NanosStart int      `json:"nanos"`
 	MaxResult  int      `json:"limit"`
+	Source     string   `json:"source"`  // Label of the attached source, empty for the live storage
+	Streams    []string `json:"streams"` // Names of the streams (Default: all)
+}
+
+// Progress of the scheduled tasks of a search
+type Progress struct {
+	Databases        int     `json:"databases"`         // Number of databases scheduled
+	DatabasesScanned int     `json:"databases_scanned"` // Number of databases already scanned
+	RowsReturned     int64   `json:"rows_returned"`     // Rows returned by the databases already scanned
+	Percent          float64 `json:"percent"`           // Percent (0-100) of the time range covered
 }
 
 type Output struct {
-	Scheduled bool    `json:"scheduled,omitempty"` // Indicates that this is a partial result
-	TaskIds   []int32 `json:"tasks,omitempty"`     // The id so that the result can be retrieved in the future
-	Error     error   `json:"-"`                   // The last error occurred
-	Ticks     []*Tick `json:"ticks,omitempty"`     // The ticks available in this response
-	Entries   []any   `json:"entries,omitempty"`   // The log records available in this response
+	Scheduled bool         `json:"scheduled,omitempty"` // Indicates that this is a partial result
+	TaskIds   []int32      `json:"tasks,omitempty"`     // The id so that the result can be retrieved in the future
+	Error     error        `json:"-"`                   // The last error occurred
+	Ticks     []*Tick      `json:"ticks,omitempty"`     // The ticks available in this response
+	Entries   []*EntryView `json:"entries,omitempty"`   // The log records available in this response
+
+	Aggregate []*AggregateRow `json:"aggregate,omitempty"` // The aggregation rows available in this response
+	Fields    []*Field        `json:"fields,omitempty"`    // The fields seen in the sampled entries of this response
+	Progress  *Progress       `json:"progress,omitempty"`  // Progress of the search, when scheduled
 }
 
 func (l *sqlog) Entries(input *EntriesInput) (*Output, error) {
@@ -50,6 +71,51 @@ func (l *sqlog) Ticks(input *TicksInput) (*Output, error) {
 	return &Output{}, nil
 }
 
+// Aggregate computes the aggregations, waiting for the scheduled results (up to 30 seconds)
+func (l *sqlog) Aggregate(input *AggregateInput) (*Output, error) {
+	s, ok := l.storage.(StorageWithApi)
+	if !ok {
+		return &Output{}, nil
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	out, err := s.Aggregate(input)
+	if err != nil || out == nil || !out.Scheduled {
+		return out, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows := out.Aggregate
+	err = waitScheduled(ctx, s, out.TaskIds, func(result *Output) error {
+		rows = MergeAggregateRows(rows, result.Aggregate)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Output{Aggregate: FinalizeAggregateRows(input, rows)}, nil
+}
+
+// Streams lists the streams of the storage (see StorageWithStreams)
+func (l *sqlog) Streams() []string {
+	if s, ok := l.storage.(StorageWithStreams); ok {
+		return s.Streams()
+	}
+	return []string{DefaultStream}
+}
+
+// Sources lists the sources attached to the storage (see StorageWithSources)
+func (l *sqlog) Sources() []*Source {
+	if s, ok := l.storage.(StorageWithSources); ok {
+		return s.Sources()
+	}
+	return []*Source{}
+}
+
 func (l *sqlog) Result(taskId int32) (*Output, error) {
 	if s, ok := l.storage.(StorageWithApi); ok {
 		return s.Result(taskId)
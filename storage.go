@@ -1,5 +1,7 @@
 package sqlog
 
+import "context"
+
 // Storage storage contract
 type Storage interface {
 	Close() error             // Close storage must perform cleaning during shutdown
@@ -16,10 +18,51 @@ type StorageWithApi interface {
 	// Fetches a page of results (seek method or keyset pagination).
 	// The sorting is reversed, with the oldest result coming first.
 	Entries(input *EntriesInput) (*Output, error)
+
+	// Fetches a single entry by id (see EntryID)
+	GetEntry(id string) (*Output, error)
+
+	// Computes aggregations (count, sum, avg, min, max, percentiles) grouped by time bucket and fields.
+	// The rows are partial when the result is scheduled, see MergeAggregateRows.
+	Aggregate(input *AggregateInput) (*Output, error)
+
+	// Lists the attributes (name and type) seen in a sample of the matching entries.
+	// The fields are partial when the result is scheduled, see MergeFields.
+	Fields(input *FieldsInput) (*Output, error)
+
 	Result(taskId int32) (*Output, error)
 	Cancel(taskId int32) error
 }
 
+// StorageWithContext contract for storage whose searches are interrupted when the context is done (see Query)
+type StorageWithContext interface {
+	EntriesContext(ctx context.Context, input *EntriesInput) (*Output, error)
+}
+
+// StorageWithSources contract for storage that allows attaching other sets of logs for read-only querying.
+// The attached source is selected by the Source of the inputs.
+type StorageWithSources interface {
+	Sources() []*Source
+}
+
+// Source is a set of logs attached to the storage
+type Source struct {
+	Name       string `json:"name"`        // Label of the source
+	Dir        string `json:"dir"`         // Directory of the files
+	Databases  int    `json:"databases"`   // Number of databases
+	EpochStart int64  `json:"epoch_start"` // Epoch of the oldest database
+	EpochEnd   int64  `json:"epoch_end"`   // Epoch of the newest entry, when known
+}
+
+// DefaultStream is the name of the stream of the records logged without stream (see Log.WithStream)
+const DefaultStream = "default"
+
+// StorageWithStreams contract for storage that partitions the entries by stream (see Entry.Stream).
+// The queried streams are selected by the Streams of the inputs, all streams by default.
+type StorageWithStreams interface {
+	Streams() []string
+}
+
 type DummyStorage struct {
 }
 
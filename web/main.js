@@ -23,14 +23,19 @@
 
     let momentStart = moment().startOf('hour');
     let momentEnd = moment();
-    let expression = '';
+    let expression = ''; // filter expression (before the first "|")
+    let pipeline = ''; // full expression, when it has pipeline stages
     let levels = new Set(['debug', 'info', 'warn', 'error']);
+    let source = ''; // label of the attached source being browsed, empty for the live logs
 
     let $bars;
     let $count;
     let $chart;
     let $container;
     let $content;
+    let $pipeline;
+    let $facets;
+    let $exp;
     let $needle;
 
     $(function () {
@@ -39,13 +44,20 @@
         $count = $('> .count', $chart);
         $needle = $(".needle", $chart);
         $container = $("#tab-content");
-        $content = $("> table", $container);
+        $content = $("> table.entries", $container);
+        $pipeline = $("> table.pipeline", $container);
+        $facets = $("#facets > ul");
 
-        let $exp = $('#expression')
+        $exp = $('#expression')
         $exp.keyup(debounce(() => {
             let newExp = $exp.val().trim();
-            if (newExp != expression) {
-                expression = $exp.val();
+            let parts = splitPipeline(newExp);
+            let newPipeline = parts.length > 1 ? newExp : '';
+            if (parts[0].trim() != expression || newPipeline != pipeline) {
+                expression = parts[0].trim();
+                pipeline = newPipeline;
+                $content.toggleClass('active', pipeline == '');
+                $pipeline.toggleClass('active', pipeline != '');
                 clearEntries(true);
                 updateTick();
             }
@@ -162,6 +174,36 @@
 
         $container.on("scroll", debounce(checkScroll, 20));
 
+        document.getElementById('off-canvas-level').addEventListener('show.bs.offcanvas', loadLevels);
+        $('#level-form').on('submit', (e) => {
+            e.preventDefault();
+            updateLevel({
+                name: $('#level-name').val().trim(),
+                level: $('#level-level').val(),
+                ttl: parseInt($('#level-ttl').val(), 10),
+            });
+        });
+        loadLevels();
+
+        $('#source').on('change', (e) => {
+            source = $(e.target).val();
+            clearEntries(true);
+            updateTick();
+        });
+        loadSources();
+
+        // permalink "/entry/{id}"
+        let permalink = location.pathname.match(/\/entry\/([^/]+)$/);
+        if (permalink) {
+            loadEntryContext(decodeURIComponent(permalink[1]), '', true);
+        }
+
+        $('#event-attributes .context form').on('submit', (e) => {
+            e.preventDefault();
+            const $form = $(e.currentTarget);
+            loadEntryContext($form.data('id'), $('input', $form).val().trim(), false);
+        });
+
         window.addEventListener('resize', debounce(() => {
             onUpdateRange(momentStart, momentEnd);
         }));
@@ -308,6 +350,8 @@
         });
 
         requestTicks();
+        loadPipeline();
+        loadFields();
     }
 
     /**
@@ -326,6 +370,7 @@
             "epoch": EPOCH_END,
             "interval": INTERVAL,
             "limit": NUM_TICKS,
+            "source": source,
         };
         if (levels.size != 4) {
             params["level"] = Array.prototype.join.call(levels.values().toArray());
@@ -481,6 +526,11 @@
       */
     function loadEntries(direction) {
 
+        if (pipeline != '') {
+            // pipeline results are rendered by loadPipeline
+            return
+        }
+
         if (direction == 'before') {
             if (IS_LOADING_BEFORE || !HAS_MORE_BEFORE) {
                 return
@@ -516,12 +566,14 @@
             "epoch": epoch,
             "nanos": nanos,
             "limit": PAGE_SIZE,
+            "source": source,
         }).toString();
 
         const filterId = FILTER_ID;
 
         fetch(url)
             .then(data => data.json())
+            .then(result => waitTasks(result, filterId))
             .then((result) => {
                 if (filterId != FILTER_ID) {
                     return
@@ -536,32 +588,7 @@
                     return
                 }
 
-                let entries = result.entries.map((it) => {
-                    let data = JSON.parse(it[3])
-                    let level = it[2];
-                    if (level < 0) {
-                        level = 'DEBUG';
-                    } else if (level < 4) {
-                        level = 'INFO';
-                    } else if (level < 8) {
-                        level = 'WARN';
-                    } else {
-                        level = 'ERROR';
-                    }
-
-                    let entry = {
-                        Epoch: it[0],
-                        Nanos: it[1],
-                        Message: data.msg,
-                        Level: level,
-                        Date: moment(new Date(it[0] * 1000 + it[1] / 1000000)),
-                        Data: data,
-                        Element: null,
-                        Overview: getTags(data)
-                    }
-
-                    return entry
-                });
+                let entries = result.entries.map(toEntry);
 
                 // EPOCH_END = end.unix();
                 // EPOCH_START = start.unix();
@@ -610,8 +637,93 @@
             });
     }
 
+    /**
+      * Waits for the scheduled tasks of the result (archived databases), showing the progress of the search.
+      * The pending tasks are canceled when the filter changes.
+      */
+    function waitTasks(result, filterId) {
+        if (!result.tasks || result.tasks.length == 0) {
+            return Promise.resolve(result);
+        }
+
+        const $progress = $('#search-progress');
+        let pending = result.tasks.slice();
+        let entries = result.entries || [];
+
+        return new Promise((resolve) => {
+            const poll = () => {
+                if (filterId != FILTER_ID) {
+                    pending.forEach(id => fetch("./api/cancel?id=" + id).catch(console.error));
+                    $progress.addClass('hidden');
+                    resolve(result);
+                    return
+                }
+
+                Promise.all(pending.map(id => fetch("./api/result?id=" + id).then(data => data.json())))
+                    .then((outputs) => {
+                        let percent = 100;
+                        let rows = 0;
+                        pending = pending.filter((id, i) => {
+                            let output = outputs[i];
+                            if (!output) {
+                                return false // expired
+                            }
+                            if (output.progress) {
+                                percent = Math.min(percent, output.progress.percent);
+                                rows += output.progress.rows_returned;
+                            }
+                            if (output.scheduled) {
+                                return true
+                            }
+                            entries = entries.concat(output.entries || []);
+                            return false
+                        });
+
+                        if (pending.length == 0) {
+                            $progress.addClass('hidden');
+                            resolve({ entries: entries });
+                            return
+                        }
+
+                        $progress.removeClass('hidden');
+                        $progress.find('.bar').css('width', percent + '%');
+                        $progress.find('.label').text(`Searching archived logs... ${percent}% (${rows} rows)`);
+                        setTimeout(poll, 300);
+                    })
+                    .catch((err) => {
+                        console.error(err);
+                        $progress.addClass('hidden');
+                        resolve({ entries: entries });
+                    });
+            };
+            poll();
+        });
+    }
+
+    /**
+      * Converts the api entry {id, time, epoch, nanos, level, msg, attrs} to the view entry
+      */
+    function toEntry(it) {
+        let data = it.attrs || {};
+
+        // "INFO", "WARN+2", "DEBUG-4"
+        let level = (/^[A-Z]+/.exec(it.level) || ['INFO'])[0];
+
+        return {
+            Id: it.id,
+            Epoch: it.epoch,
+            Nanos: it.nanos,
+            Message: it.msg,
+            Level: level,
+            Date: moment(new Date(it.epoch * 1000 + it.nanos / 1000000)),
+            Data: data,
+            Element: null,
+            Overview: getTags(data)
+        }
+    }
+
     function renderEntries(entries, direction) {
-        const tbody = $('#tab-content > table tbody');
+        const tbody = $('> tbody', $content);
         const rowTemplate = document.querySelector("#tpl-tab-row").content;
 
         let trs = entries.map(entry => {
@@ -625,8 +737,8 @@
             tds[2].textContent = entry.Message;
             tds[3].innerHTML = entry.Overview;
 
-            $('.tag', tds[3]).on('click', (e, el) => {
-                console.log(e, el);
+            $('.tag', tds[3]).on('click', (e) => {
+                addFilter($('.key', e.currentTarget).text(), $('.value', e.currentTarget).text());
                 return false
             })
 
@@ -690,6 +802,207 @@
         }
     }
 
+    /**
+      * Splits the expression on unquoted "|". Ex. 'status:>=500 | stats count() by route'
+      */
+    function splitPipeline(exp) {
+        let parts = [];
+        let start = 0;
+        let quoted = false;
+        for (let i = 0; i < exp.length; i++) {
+            let c = exp[i];
+            if (c == '\\') {
+                i++;
+            } else if (c == '"') {
+                quoted = !quoted;
+            } else if (c == '|' && !quoted) {
+                parts.push(exp.substring(start, i));
+                start = i + 1;
+            }
+        }
+        parts.push(exp.substring(start));
+        return parts;
+    }
+
+    /**
+      * Executes the pipeline (stats, sort, head, fields) and renders the tabular result
+      */
+    function loadPipeline() {
+        $("> thead tr, > tbody tr", $pipeline).remove();
+
+        if (pipeline == '') {
+            return
+        }
+
+        let params = {
+            "expr": pipeline,
+            "start": EPOCH_START,
+            "epoch": EPOCH_END,
+            "source": source,
+        };
+        if (levels.size != 4) {
+            params["level"] = Array.prototype.join.call(levels.values().toArray());
+        }
+
+        const url = "./api/pipeline?" + new URLSearchParams(params).toString();
+        const filterId = FILTER_ID;
+
+        fetch(url)
+            .then(data => data.json())
+            .then((result) => {
+                if (filterId != FILTER_ID) {
+                    return
+                }
+
+                const thead = $('> thead', $pipeline);
+                const tbody = $('> tbody', $pipeline);
+
+                if (result.error) {
+                    const tr = document.createElement('tr');
+                    const td = document.createElement('td');
+                    td.classList.add('error');
+                    td.textContent = result.error;
+                    tr.appendChild(td);
+                    tbody.append(tr);
+                    return
+                }
+
+                const tr = document.createElement('tr');
+                (result.columns || []).forEach(column => {
+                    const td = document.createElement('td');
+                    td.textContent = column.toUpperCase();
+                    tr.appendChild(td);
+                });
+                thead.append(tr);
+
+                (result.rows || []).forEach(row => {
+                    const tr = document.createElement('tr');
+                    row.forEach(value => {
+                        const td = document.createElement('td');
+                        if (value === null || value === undefined) {
+                            td.textContent = '-';
+                        } else if (typeof (value) == 'object') {
+                            td.textContent = JSON.stringify(value);
+                        } else if (typeof (value) == 'number' && !Number.isInteger(value)) {
+                            td.textContent = value.toFixed(2);
+                        } else {
+                            td.textContent = value;
+                        }
+                        tr.appendChild(td);
+                    });
+                    tbody.append(tr);
+                });
+            })
+            .catch(console.error);
+    }
+
+    /**
+      * Loads the attributes of the matching entries, rendered in the facet sidebar
+      */
+    function loadFields() {
+        let params = {
+            "expr": expression,
+            "start": EPOCH_START,
+            "epoch": EPOCH_END,
+            "source": source,
+        };
+        if (levels.size != 4) {
+            params["level"] = Array.prototype.join.call(levels.values().toArray());
+        }
+
+        const url = "./api/fields?" + new URLSearchParams(params).toString();
+        const filterId = FILTER_ID;
+
+        fetch(url)
+            .then(data => data.json())
+            .then((fields) => {
+                if (filterId != FILTER_ID) {
+                    return
+                }
+                $facets.empty();
+
+                if (!Array.isArray(fields)) {
+                    return
+                }
+
+                fields.forEach(field => {
+                    if (field.type == 'object' || field.name == 'time' || field.name == 'level') {
+                        return
+                    }
+
+                    const $li = $('<li></li>');
+                    const $field = $('<div class="field"></div>');
+                    $field.append($('<span class="name"></span>').text(field.name));
+                    $field.append($('<span class="type"></span>').text(field.type));
+                    $field.on('click', () => {
+                        if ($li.hasClass('open')) {
+                            $li.removeClass('open');
+                            $('> .value', $li).remove();
+                        } else {
+                            $li.addClass('open');
+                            loadFacets(field.name, $li);
+                        }
+                    });
+                    $li.append($field);
+                    $facets.append($li);
+                });
+            })
+            .catch(console.error);
+    }
+
+    /**
+      * Loads the top values of the field. Clicking a value adds "field:value" to the expression
+      */
+    function loadFacets(field, $li) {
+        let params = {
+            "expr": expression,
+            "start": EPOCH_START,
+            "epoch": EPOCH_END,
+            "field": field,
+            "source": source,
+        };
+        if (levels.size != 4) {
+            params["level"] = Array.prototype.join.call(levels.values().toArray());
+        }
+
+        const url = "./api/facets?" + new URLSearchParams(params).toString();
+
+        fetch(url)
+            .then(data => data.json())
+            .then((facets) => {
+                if (!Array.isArray(facets)) {
+                    return
+                }
+                facets.forEach(facet => {
+                    const $value = $('<div class="value" title="Add to filter"></div>');
+                    $value.append($('<span class="text"></span>').text(facet.value));
+                    $value.append($('<span class="count"></span>').text(facet.count));
+                    $value.on('click', () => {
+                        addFilter(field, facet.value);
+                    });
+                    $li.append($value);
+                });
+            })
+            .catch(console.error);
+    }
+
+    /**
+      * Adds "field:value" to the filter part of the expression
+      */
+    function addFilter(field, value) {
+        value = String(value);
+        if (/[\s:"()]/.test(value)) {
+            value = '"' + value.replace(/"/g, '\\"') + '"';
+        }
+        let parts = splitPipeline($exp.val());
+        parts[0] = (parts[0].trim() + ' ' + field + ':' + value).trim();
+        if (parts.length > 1) {
+            parts[0] += ' ';
+        }
+        $exp.val(parts.join('|'));
+        $exp.trigger('keyup');
+    }
+
     function getTags(json) {
         let out = [];
         for (const [key, value] of Object.entries(json)) {
@@ -766,6 +1079,77 @@
 
 
 
+    /**
+      * Lists the attached sources, the selector is only displayed when there are sources other than the live logs
+      */
+    function loadSources() {
+        fetch('./api/sources')
+            .then(data => data.json())
+            .then((sources) => {
+                if (!sources || sources.length == 0) {
+                    return
+                }
+                const $source = $('#source');
+                $source.empty().append($('<option>').val('').text('Live'));
+                sources.forEach(it => {
+                    $source.append($('<option>').val(it.name).text(it.name).attr('title', it.dir));
+                });
+                $source.val(source).removeClass('hidden');
+            })
+            .catch(console.error);
+    }
+
+    function loadLevels() {
+        fetch('./api/level')
+            .then(data => data.json())
+            .then(renderLevels)
+            .catch(console.error);
+    }
+
+    /**
+      * Changes the log level at runtime
+      * 
+      * @param {object} input {name, level, ttl}, an empty level removes the override
+      */
+    function updateLevel(input) {
+        fetch('./api/level', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(input)
+        })
+            .then(data => data.json())
+            .then(renderLevels)
+            .catch(console.error);
+    }
+
+    function renderLevels(result) {
+        if (!result || !result.level) {
+            return
+        }
+
+        $('#level-button .current').text(result.level);
+
+        const $tbody = $('#level-overrides tbody');
+        $tbody.empty();
+
+        let rows = [{ name: '', level: result.level }].concat(result.overrides || []);
+        rows.forEach(it => {
+            const $tr = $('<tr>');
+            $tr.append($('<td>').append(it.name ? $('<code>').text(it.name) : $('<em>').text('global')));
+            $tr.append($('<td>').text(it.level));
+            $tr.append($('<td>').text(it.expires ? moment(new Date(it.expires * 1000)).fromNow() : ''));
+
+            const $action = $('<td>');
+            if (it.name) {
+                $('<button type="button" class="btn btn-outline-secondary btn-sm">Remove</button>')
+                    .on('click', () => updateLevel({ name: it.name, level: '' }))
+                    .appendTo($action);
+            }
+            $tr.append($action);
+            $tbody.append($tr);
+        });
+    }
+
     let overlayClickHandler;
 
     function showEventAttributes(entry) {
@@ -794,7 +1178,81 @@
         let info = `<strong>${entry.Level}</strong> - ${entry.Date.format('YY-MM-DD HH:mm:ss.SSS')}`;
 
         $panel.querySelector('.container .info').innerHTML = info;
-        $panel.querySelector('.container .json').textContent = JSON.stringify(entry.Data, null, 3);
+
+        // permalink and surrounding entries
+        const $context = $('.container .context', $panel);
+        if (entry.Id) {
+            const base = location.pathname.replace(/entry\/[^/]+$/, '');
+            $('.permalink', $context).attr('href', location.origin + base + 'entry/' + encodeURIComponent(entry.Id));
+            $('form', $context).data('id', entry.Id);
+            $context.removeClass('hidden');
+        } else {
+            $context.addClass('hidden');
+        }
+        $('table tbody', $context).empty();
+
+        // error.stack is rendered collapsed, outside the json
+        let data = entry.Data;
+        const $stack = $panel.querySelector('.container .stack');
+        if (data && data['error.stack']) {
+            data = Object.assign({}, data);
+            $stack.querySelector('pre').textContent = data['error.stack'];
+            delete data['error.stack'];
+            $stack.open = false;
+            $stack.classList.remove('hidden');
+        } else {
+            $stack.classList.add('hidden');
+        }
+
+        $panel.querySelector('.container .json').textContent = JSON.stringify(data, null, 3);
+    }
+
+    /**
+      * Loads the entries before and after the entry, ignoring the current search
+      *
+      * @param {string} id entry id
+      * @param {string} expr filter of the surrounding entries (Ex. host:web-1)
+      * @param {boolean} open opens the entry (permalink)
+      */
+    function loadEntryContext(id, expr, open) {
+        const url = "./api/entries/context?" + new URLSearchParams({
+            "id": id,
+            "expr": expr,
+            "source": source,
+        }).toString();
+
+        fetch(url)
+            .then(data => data.json())
+            .then((result) => {
+                if (result.error) {
+                    console.error(result.error);
+                    return
+                }
+
+                let entries = (result.entries || []).map(toEntry);
+                let entry = entries.find(it => it.Id == id);
+                if (open && entry) {
+                    showEventAttributes(entry);
+                }
+
+                const tbody = $('#event-attributes .context table tbody');
+                tbody.empty();
+                entries.forEach(it => {
+                    const $tr = $('<tr></tr>').addClass(it.Level.toLowerCase());
+                    if (it.Id == id) {
+                        $tr.addClass('highlight');
+                    }
+                    $tr.append($('<td class="date"></td>').text(it.Date.format('HH:mm:ss.SSS')));
+                    $tr.append($('<td class="level"></td>').text(it.Level));
+                    $tr.append($('<td class="message"></td>').text(it.Message));
+                    $tr.on('click', () => {
+                        showEventAttributes(it);
+                        loadEntryContext(it.Id, expr, false);
+                    });
+                    tbody.append($tr);
+                });
+            })
+            .catch(console.error);
     }
 
     function map(in_min, in_max, out_min, out_max) {